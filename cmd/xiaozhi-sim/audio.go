@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// audioParams hello消息中上报的音频参数
+type audioParams struct {
+	Format        string `json:"format"`
+	SampleRate    int    `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	FrameDuration int    `json:"frame_duration"`
+}
+
+// frameBytes 一帧PCM数据的字节数
+func (p audioParams) frameBytes() int {
+	return p.SampleRate * p.Channels * 2 * p.FrameDuration / 1000
+}
+
+// loadAudioFrames 读取音频文件并切分为按params发送的二进制帧。
+// .wav 按params编码为Opus或切分为PCM帧；.opus/.ogg 直接使用Ogg中的Opus包。
+func loadAudioFrames(path string, params audioParams) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取音频文件失败: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		pcm, sampleRate, channels, err := parseWav(data)
+		if err != nil {
+			return nil, err
+		}
+		if sampleRate != params.SampleRate || channels != params.Channels {
+			return nil, fmt.Errorf("WAV文件为%dHz %d声道，与audio_params的%dHz %d声道不一致",
+				sampleRate, channels, params.SampleRate, params.Channels)
+		}
+		return encodePCMFrames(pcm, params)
+	case ".opus", ".ogg":
+		if params.Format != "opus" {
+			return nil, fmt.Errorf("Opus文件只能以opus格式发送")
+		}
+		return parseOggOpus(data)
+	default:
+		return nil, fmt.Errorf("不支持的音频文件: %s，仅支持.wav/.opus/.ogg", path)
+	}
+}
+
+// silenceFrames 生成n帧静音
+func silenceFrames(n int, params audioParams) ([][]byte, error) {
+	return encodePCMFrames(make([]byte, params.frameBytes()*n), params)
+}
+
+// encodePCMFrames 将16位PCM数据按帧时长切分，opus格式时编码为Opus帧，不足一帧的部分补零
+func encodePCMFrames(pcm []byte, params audioParams) ([][]byte, error) {
+	encoder, err := utils.NewAudioFrameEncoder(params.Format, params.SampleRate, params.Channels, params.FrameDuration)
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+
+	frames, err := encoder.Encode(pcm)
+	if err != nil {
+		return nil, err
+	}
+	last, err := encoder.Flush()
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		frames = append(frames, last)
+	}
+	return frames, nil
+}
+
+// parseWav 解析16位PCM WAV文件，返回PCM数据、采样率和声道数
+func parseWav(data []byte) ([]byte, int, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, 0, fmt.Errorf("不是有效的WAV文件")
+	}
+
+	var sampleRate, channels, bitsPerSample int
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := data[offset+8:]
+		if size > len(body) {
+			size = len(body)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, 0, fmt.Errorf("WAV格式块长度错误")
+			}
+			if format := binary.LittleEndian.Uint16(body[0:2]); format != 1 {
+				return nil, 0, 0, fmt.Errorf("仅支持PCM编码的WAV文件，当前编码: %d", format)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			if sampleRate == 0 {
+				return nil, 0, 0, fmt.Errorf("WAV文件缺少格式块")
+			}
+			if bitsPerSample != 16 {
+				return nil, 0, 0, fmt.Errorf("仅支持16位WAV文件，当前: %d位", bitsPerSample)
+			}
+			return body[:size], sampleRate, channels, nil
+		}
+		// 块按偶数字节对齐
+		offset += 8 + size + size%2
+	}
+	return nil, 0, 0, fmt.Errorf("WAV文件缺少数据块")
+}
+
+// parseOggOpus 从Ogg Opus文件中取出音频包，跳过OpusHead和OpusTags
+func parseOggOpus(data []byte) ([][]byte, error) {
+	var packets [][]byte
+	var packet []byte
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 27 || string(data[offset:offset+4]) != "OggS" {
+			return nil, fmt.Errorf("Ogg页头错误，偏移: %d", offset)
+		}
+		segments := int(data[offset+26])
+		if len(data)-offset < 27+segments {
+			return nil, fmt.Errorf("Ogg页不完整，偏移: %d", offset)
+		}
+		lacing := data[offset+27 : offset+27+segments]
+		offset += 27 + segments
+
+		for _, size := range lacing {
+			if offset+int(size) > len(data) {
+				return nil, fmt.Errorf("Ogg数据不完整")
+			}
+			packet = append(packet, data[offset:offset+int(size)]...)
+			offset += int(size)
+			// 长度小于255的段表示包结束，否则包延续到下一段
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+
+	var frames [][]byte
+	for _, p := range packets {
+		if bytes.HasPrefix(p, []byte("OpusHead")) || bytes.HasPrefix(p, []byte("OpusTags")) {
+			continue
+		}
+		frames = append(frames, p)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("Ogg文件中没有Opus音频")
+	}
+	return frames, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+func TestLoadAudioFramesWav(t *testing.T) {
+	params := audioParams{Format: "pcm", SampleRate: 16000, Channels: 1, FrameDuration: 60}
+	// 2.5帧数据，最后一帧补零
+	pcm := bytes.Repeat([]byte{1, 2}, params.frameBytes()*5/4)
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := utils.SaveAudioToWavFile(pcm, path, params.SampleRate, params.Channels, 16); err != nil {
+		t.Fatalf("SaveAudioToWavFile() error = %v", err)
+	}
+
+	frames, err := loadAudioFrames(path, params)
+	if err != nil {
+		t.Fatalf("loadAudioFrames() error = %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("帧数 = %d, want 3", len(frames))
+	}
+	for i, frame := range frames {
+		if len(frame) != params.frameBytes() {
+			t.Errorf("第%d帧长度 = %d, want %d", i, len(frame), params.frameBytes())
+		}
+	}
+	if !bytes.Equal(bytes.Join(frames, nil)[:len(pcm)], pcm) {
+		t.Error("PCM数据不一致")
+	}
+
+	params.SampleRate = 24000
+	if _, err := loadAudioFrames(path, params); err == nil {
+		t.Error("采样率不一致时应返回错误")
+	}
+}
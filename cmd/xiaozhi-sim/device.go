@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// abortSettle 发送abort后等待服务端残留消息的静默时长
+const abortSettle = 300 * time.Millisecond
+
+// event 服务端下发的一条消息，at为收到的时间
+type event struct {
+	kind  string // 消息type，二进制音频帧为audio
+	state string
+	text  string
+	at    time.Time
+}
+
+// device 一台模拟设备，一个连接上按顺序进行多轮对话
+type device struct {
+	id      string
+	opts    *options
+	frames  [][]byte // 每轮发送的音频帧
+	silence []byte   // 一帧静音，用于auto模式的尾部静音和realtime模式的持续拾音
+	rec     *recorder
+
+	conn         *websocket.Conn
+	events       chan event
+	readErr      error // 在events关闭前写入
+	disconnected bool  // 连接已断开，后续轮次无法进行
+}
+
+// run 连接服务端并完成所有轮次，结果写入recorder
+func (d *device) run() {
+	if err := d.connect(); err != nil {
+		d.rec.connectFailed(err, d.opts.rounds)
+		return
+	}
+	defer d.conn.Close()
+
+	for i := 0; i < d.opts.rounds; i++ {
+		if i > 0 && d.opts.interval > 0 {
+			time.Sleep(d.opts.interval)
+		}
+		err := d.round()
+		d.rec.roundDone(err)
+		if d.disconnected {
+			// 连接已断开，剩余轮次计为失败
+			for j := i + 1; j < d.opts.rounds; j++ {
+				d.rec.roundDone(err)
+			}
+			return
+		}
+	}
+}
+
+// connect 建立WebSocket连接并完成hello握手
+func (d *device) connect() error {
+	header := http.Header{}
+	header.Set("Device-Id", d.id)
+	header.Set("Client-Id", d.id)
+	header.Set("Protocol-Version", "1")
+	if d.opts.token != "" {
+		header.Set("Authorization", "Bearer "+d.opts.token)
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: d.opts.timeout}
+	conn, _, err := dialer.Dial(d.opts.url, header)
+	if err != nil {
+		return fmt.Errorf("连接失败: %v", err)
+	}
+	d.conn = conn
+	d.events = make(chan event, 1024)
+	go d.readLoop()
+
+	start := time.Now()
+	if err := d.sendJSON(map[string]interface{}{
+		"type":         "hello",
+		"version":      1,
+		"transport":    "websocket",
+		"audio_params": d.opts.audio,
+	}); err != nil {
+		conn.Close()
+		return err
+	}
+
+	timeout := time.After(d.opts.timeout)
+	for {
+		select {
+		case ev, ok := <-d.events:
+			if !ok {
+				conn.Close()
+				return fmt.Errorf("hello握手时连接断开: %v", d.readErr)
+			}
+			if ev.kind == "hello" {
+				d.rec.observe(metricHello, ev.at.Sub(start))
+				return nil
+			}
+		case <-timeout:
+			conn.Close()
+			return fmt.Errorf("等待hello响应超时")
+		}
+	}
+}
+
+// readLoop 读取服务端消息并转为事件，连接断开时关闭events
+func (d *device) readLoop() {
+	defer close(d.events)
+	for {
+		messageType, data, err := d.conn.ReadMessage()
+		if err != nil {
+			d.readErr = err
+			return
+		}
+		at := time.Now()
+		if messageType == websocket.BinaryMessage {
+			d.events <- event{kind: "audio", at: at}
+			continue
+		}
+
+		var msg struct {
+			Type  string `json:"type"`
+			State string `json:"state"`
+			Text  string `json:"text"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" || msg.Type == "mcp" {
+			continue
+		}
+		d.events <- event{kind: msg.Type, state: msg.State, text: msg.Text, at: at}
+	}
+}
+
+func (d *device) sendJSON(msg map[string]interface{}) error {
+	d.conn.SetWriteDeadline(time.Now().Add(d.opts.timeout))
+	if err := d.conn.WriteJSON(msg); err != nil {
+		d.disconnected = true
+		return fmt.Errorf("发送%v消息失败: %v", msg["type"], err)
+	}
+	return nil
+}
+
+func (d *device) sendAudio(frame []byte) error {
+	d.conn.SetWriteDeadline(time.Now().Add(d.opts.timeout))
+	if err := d.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		d.disconnected = true
+		return fmt.Errorf("发送音频失败: %v", err)
+	}
+	return nil
+}
+
+// drain 丢弃上一轮残留的事件
+func (d *device) drain() {
+	for {
+		select {
+		case _, ok := <-d.events:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// round 进行一轮对话：开始拾音，按帧时长发送音频，等待识别和回复结束。
+// 时延从音频发送完毕开始计算。
+func (d *device) round() error {
+	d.drain()
+	mode := d.opts.mode
+	if err := d.sendJSON(map[string]interface{}{"type": "listen", "state": "start", "mode": mode}); err != nil {
+		return err
+	}
+
+	frameDuration := time.Duration(d.opts.audio.FrameDuration) * time.Millisecond
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+	for _, frame := range d.frames {
+		if err := d.sendAudio(frame); err != nil {
+			return err
+		}
+		<-ticker.C
+	}
+	sentAt := time.Now()
+
+	if mode == "manual" {
+		if err := d.sendJSON(map[string]interface{}{"type": "listen", "state": "stop", "mode": mode}); err != nil {
+			return err
+		}
+	}
+
+	var sttAt, sentenceAt, audioAt, abortAt time.Time
+	timeout := time.NewTimer(d.opts.timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// auto模式发送静音直到服务端识别出语句结束，realtime模式持续拾音
+			if (mode == "auto" && sttAt.IsZero()) || mode == "realtime" {
+				if err := d.sendAudio(d.silence); err != nil {
+					return err
+				}
+			}
+		case ev, ok := <-d.events:
+			if !ok {
+				d.disconnected = true
+				return fmt.Errorf("连接断开: %v", d.readErr)
+			}
+			switch {
+			case ev.kind == "stt" && sttAt.IsZero():
+				sttAt = ev.at
+				d.rec.observe(metricSTT, ev.at.Sub(sentAt))
+			case ev.kind == "tts" && ev.state == "sentence_start" && sentenceAt.IsZero():
+				sentenceAt = ev.at
+				d.rec.observe(metricFirstSentence, ev.at.Sub(sentAt))
+			case ev.kind == "audio" && audioAt.IsZero():
+				audioAt = ev.at
+				d.rec.observe(metricFirstAudio, ev.at.Sub(sentAt))
+				if d.opts.abort {
+					abortAt = time.Now()
+					if err := d.sendJSON(map[string]interface{}{"type": "abort"}); err != nil {
+						return err
+					}
+				}
+			case ev.kind == "tts" && ev.state == "stop" && !sttAt.IsZero():
+				// 识别前的tts stop来自上一轮的中止，不是本轮的回复
+				if abortAt.IsZero() {
+					d.rec.observe(metricRound, ev.at.Sub(sentAt))
+					return nil
+				}
+				d.rec.observe(metricAbort, ev.at.Sub(abortAt))
+				d.settle()
+				return nil
+			}
+		case <-timeout.C:
+			switch {
+			case sttAt.IsZero():
+				return fmt.Errorf("等待识别结果超时")
+			case audioAt.IsZero():
+				return fmt.Errorf("等待TTS音频超时")
+			default:
+				return fmt.Errorf("等待tts stop超时")
+			}
+		}
+	}
+}
+
+// settle 中止后服务端可能仍在下发已合成的音频，等待连接静默再开始下一轮
+func (d *device) settle() {
+	quiet := time.NewTimer(abortSettle)
+	defer quiet.Stop()
+	for {
+		select {
+		case _, ok := <-d.events:
+			if !ok {
+				return
+			}
+			quiet.Reset(abortSettle)
+		case <-quiet.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// xiaozhi-sim 模拟多台设备并发连接服务端，统计识别和合成时延。
+//
+// 每台设备建立WebSocket连接并发送hello握手，然后按轮次开始拾音、
+// 按帧时长发送音频文件，等待识别结果和TTS回复，最后输出时延和错误报告。
+// 可用于评估pool_config的容量，以及发现ConnectionHandler的并发问题。
+//
+// 用法:
+//
+//	go run ./cmd/xiaozhi-sim -url ws://127.0.0.1:8000/ -devices 20 -rounds 5 -file test.wav
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// options 命令行参数
+type options struct {
+	url      string
+	token    string
+	devices  int
+	rounds   int
+	interval time.Duration
+	ramp     time.Duration
+	timeout  time.Duration
+	prefix   string
+	file     string
+	speech   time.Duration
+	mode     string
+	abort    bool
+	json     bool
+	audio    audioParams
+}
+
+func parseOptions() (*options, error) {
+	opts := &options{}
+	flag.StringVar(&opts.url, "url", "ws://127.0.0.1:8000/", "服务端WebSocket地址")
+	flag.StringVar(&opts.token, "token", "", "认证token，以Authorization: Bearer发送")
+	flag.IntVar(&opts.devices, "devices", 1, "并发设备数")
+	flag.IntVar(&opts.rounds, "rounds", 1, "每台设备的对话轮次")
+	flag.DurationVar(&opts.interval, "interval", time.Second, "每轮对话之间的间隔")
+	flag.DurationVar(&opts.ramp, "ramp", 0, "在该时长内逐步启动所有设备，0表示同时启动")
+	flag.DurationVar(&opts.timeout, "timeout", 30*time.Second, "连接和每轮对话的超时时间")
+	flag.StringVar(&opts.prefix, "device-prefix", "sim-", "设备ID前缀，后接设备序号")
+	flag.StringVar(&opts.file, "file", "", "发送的音频文件(.wav/.opus/.ogg)，为空时发送静音")
+	flag.DurationVar(&opts.speech, "speech", time.Second, "未指定音频文件时发送的静音时长")
+	flag.StringVar(&opts.mode, "mode", "auto", "拾音模式: auto/manual/realtime")
+	flag.BoolVar(&opts.abort, "abort", false, "收到首帧音频后发送abort，统计中止时延")
+	flag.BoolVar(&opts.json, "json", false, "以JSON格式输出报告")
+	flag.StringVar(&opts.audio.Format, "format", "opus", "音频格式: opus/pcm")
+	flag.IntVar(&opts.audio.SampleRate, "sample-rate", 16000, "音频采样率")
+	flag.IntVar(&opts.audio.Channels, "channels", 1, "音频声道数")
+	flag.IntVar(&opts.audio.FrameDuration, "frame-duration", 60, "音频帧时长(毫秒)")
+	flag.Parse()
+
+	switch opts.mode {
+	case "auto", "manual", "realtime":
+	default:
+		return nil, fmt.Errorf("不支持的拾音模式: %s", opts.mode)
+	}
+	if opts.audio.Format != "opus" && opts.audio.Format != "pcm" {
+		return nil, fmt.Errorf("不支持的音频格式: %s", opts.audio.Format)
+	}
+	if opts.devices <= 0 || opts.rounds <= 0 {
+		return nil, fmt.Errorf("devices和rounds必须大于0")
+	}
+	if opts.audio.SampleRate <= 0 || opts.audio.Channels <= 0 || opts.audio.FrameDuration <= 0 {
+		return nil, fmt.Errorf("audio_params参数必须大于0")
+	}
+	return opts, nil
+}
+
+func main() {
+	opts, err := parseOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	silence, err := silenceFrames(1, opts.audio)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成静音帧失败: %v\n", err)
+		os.Exit(1)
+	}
+	var frames [][]byte
+	if opts.file != "" {
+		frames, err = loadAudioFrames(opts.file, opts.audio)
+	} else {
+		frames, err = silenceFrames(int(opts.speech.Milliseconds())/opts.audio.FrameDuration, opts.audio)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	rec := newRecorder()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.devices; i++ {
+		if i > 0 && opts.ramp > 0 {
+			time.Sleep(opts.ramp / time.Duration(opts.devices))
+		}
+		d := &device{
+			id:      fmt.Sprintf("%s%04d", opts.prefix, i+1),
+			opts:    opts,
+			frames:  frames,
+			silence: silence[0],
+			rec:     rec,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.run()
+		}()
+	}
+	wg.Wait()
+
+	rep := rec.report(opts.devices, time.Since(start))
+	if opts.json {
+		if err := rep.writeJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "输出报告失败: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		rep.writeText(os.Stdout)
+	}
+	if rep.Failures > 0 {
+		os.Exit(1)
+	}
+}
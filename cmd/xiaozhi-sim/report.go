@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// 统计的时延指标，按输出顺序排列
+const (
+	metricHello         = "hello"          // 发送hello到收到响应
+	metricSTT           = "stt"            // 音频发送完毕到收到识别结果
+	metricFirstSentence = "first_sentence" // 音频发送完毕到首个tts sentence_start
+	metricFirstAudio    = "first_audio"    // 音频发送完毕到首帧音频
+	metricRound         = "round"          // 音频发送完毕到tts stop
+	metricAbort         = "abort"          // 发送abort到收到tts stop
+)
+
+var metricOrder = []string{metricHello, metricSTT, metricFirstSentence, metricFirstAudio, metricRound, metricAbort}
+
+// recorder 并发收集各设备的时延和错误
+type recorder struct {
+	mu       sync.Mutex
+	samples  map[string][]time.Duration
+	errors   map[string]int
+	rounds   int
+	failures int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		samples: make(map[string][]time.Duration),
+		errors:  make(map[string]int),
+	}
+}
+
+// observe 记录一次时延，提前到达的事件记为0
+func (r *recorder) observe(metric string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples[metric] = append(r.samples[metric], max(d, 0))
+}
+
+// roundDone 记录一轮对话的结果
+func (r *recorder) roundDone(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rounds++
+	if err != nil {
+		r.failures++
+		r.errors[err.Error()]++
+	}
+}
+
+// connectFailed 记录设备连接失败，该设备的所有轮次都计为失败
+func (r *recorder) connectFailed(err error, rounds int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rounds += rounds
+	r.failures += rounds
+	r.errors[err.Error()] += rounds
+}
+
+// latencyStats 单个指标的统计
+type latencyStats struct {
+	Metric string
+	Count  int
+	Min    time.Duration
+	Avg    time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// report 压测报告
+type report struct {
+	Devices  int
+	Rounds   int
+	Failures int
+	Elapsed  time.Duration
+	Latency  []latencyStats
+	Errors   map[string]int
+}
+
+func (r *recorder) report(devices int, elapsed time.Duration) report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := report{
+		Devices:  devices,
+		Rounds:   r.rounds,
+		Failures: r.failures,
+		Elapsed:  elapsed,
+		Errors:   r.errors,
+	}
+	for _, metric := range metricOrder {
+		if samples := r.samples[metric]; len(samples) > 0 {
+			rep.Latency = append(rep.Latency, summarize(metric, samples))
+		}
+	}
+	return rep
+}
+
+// summarize 计算时延的最小、平均、分位和最大值
+func summarize(metric string, samples []time.Duration) latencyStats {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return latencyStats{
+		Metric: metric,
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Avg:    total / time.Duration(len(sorted)),
+		P50:    percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+		P99:    percentile(sorted, 99),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// percentile 最近秩法计算分位数，sorted需已升序排列
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
+
+// writeText 以表格输出报告
+func (rep report) writeText(w io.Writer) {
+	fmt.Fprintf(w, "设备数: %d, 对话轮次: %d, 成功: %d, 失败: %d, 总耗时: %s\n\n",
+		rep.Devices, rep.Rounds, rep.Rounds-rep.Failures, rep.Failures, rep.Elapsed.Round(time.Millisecond))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "指标\t次数\t最小\t平均\tP50\tP90\tP99\t最大\t")
+	for _, s := range rep.Latency {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", s.Metric, s.Count,
+			ms(s.Min), ms(s.Avg), ms(s.P50), ms(s.P90), ms(s.P99), ms(s.Max))
+	}
+	tw.Flush()
+
+	if len(rep.Errors) > 0 {
+		fmt.Fprintln(w, "\n错误:")
+		messages := make([]string, 0, len(rep.Errors))
+		for msg := range rep.Errors {
+			messages = append(messages, msg)
+		}
+		sort.Slice(messages, func(i, j int) bool { return rep.Errors[messages[i]] > rep.Errors[messages[j]] })
+		for _, msg := range messages {
+			fmt.Fprintf(w, "  %5d  %s\n", rep.Errors[msg], msg)
+		}
+	}
+}
+
+// writeJSON 以JSON输出报告，时延单位为毫秒
+func (rep report) writeJSON(w io.Writer) error {
+	type jsonStats struct {
+		Metric string  `json:"metric"`
+		Count  int     `json:"count"`
+		Min    float64 `json:"min_ms"`
+		Avg    float64 `json:"avg_ms"`
+		P50    float64 `json:"p50_ms"`
+		P90    float64 `json:"p90_ms"`
+		P99    float64 `json:"p99_ms"`
+		Max    float64 `json:"max_ms"`
+	}
+	latency := make([]jsonStats, 0, len(rep.Latency))
+	for _, s := range rep.Latency {
+		latency = append(latency, jsonStats{s.Metric, s.Count,
+			toMs(s.Min), toMs(s.Avg), toMs(s.P50), toMs(s.P90), toMs(s.P99), toMs(s.Max)})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"devices":    rep.Devices,
+		"rounds":     rep.Rounds,
+		"failures":   rep.Failures,
+		"elapsed_ms": toMs(rep.Elapsed),
+		"latency":    latency,
+		"errors":     rep.Errors,
+	})
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.0fms", toMs(d))
+}
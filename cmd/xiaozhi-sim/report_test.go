@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    latencyStats
+	}{
+		{
+			name:    "单个样本",
+			samples: []time.Duration{5},
+			want:    latencyStats{Metric: "stt", Count: 1, Min: 5, Avg: 5, P50: 5, P90: 5, P99: 5, Max: 5},
+		},
+		{
+			name:    "乱序样本",
+			samples: []time.Duration{10, 1, 9, 2, 8, 3, 7, 4, 6, 5},
+			want:    latencyStats{Metric: "stt", Count: 10, Min: 1, Avg: 5, P50: 5, P90: 9, P99: 10, Max: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize("stt", tt.samples); got != tt.want {
+				t.Errorf("summarize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package configs
 
 import (
+	"xiaozhi-server-go/src/models"
+
 	"gorm.io/gorm"
 )
 
 type ConfigDBInterface interface {
 	GetDB() *gorm.DB
-	InitServerConfig(cfgStr string) error
+	// 保存从配置文件导入的配置，fileHash为配置文件内容的SHA-256
+	ImportServerConfig(cfgStr, fileHash string) error
+	// 保存通过/api/cfg修改的配置
 	UpdateServerConfig(cfgStr string) error
-	LoadServerConfig() (string, error)
+	// 加载数据库中的配置，不存在时返回nil
+	LoadServerConfig() (*models.ServerConfig, error)
 }
@@ -1,8 +1,12 @@
 package configs
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -36,6 +40,14 @@ type Config struct {
 			IP      string `yaml:"ip" json:"ip"`
 			Port    int    `yaml:"port" json:"port"`
 		} `yaml:"websocket" json:"websocket"`
+		MqttUDP struct {
+			Enabled   bool   `yaml:"enabled" json:"enabled"`
+			IP        string `yaml:"ip" json:"ip"`                 // MQTT监听地址
+			Port      int    `yaml:"port" json:"port"`             // MQTT监听端口
+			UDPIP     string `yaml:"udp_ip" json:"udp_ip"`         // UDP监听地址
+			UDPPort   int    `yaml:"udp_port" json:"udp_port"`     // UDP监听端口
+			UDPServer string `yaml:"udp_server" json:"udp_server"` // 下发给设备的UDP地址，为空则使用设备连接MQTT时的本机地址
+		} `yaml:"mqtt_udp" json:"mqtt_udp"`
 	} `yaml:"transport" json:"transport"`
 
 	Log struct {
@@ -62,8 +74,25 @@ type Config struct {
 	UsePrivateConfig bool     `yaml:"use_private_config" json:"use_private_config"`
 	LocalMCPFun      []string `yaml:"local_mcp_fun"      json:"local_mcp_fun"` // 本地MCP函数映射
 
+	// 按设备持久化对话历史，设备重连后继续之前的对话
+	DialogueHistory struct {
+		Enabled        bool `yaml:"enabled"         json:"enabled"`
+		RetentionHours int  `yaml:"retention_hours" json:"retention_hours"` // 保留时长(小时)，超过后不再恢复并被清理，默认72
+		MaxMessages    int  `yaml:"max_messages"    json:"max_messages"`    // 恢复时最多保留的消息条数，0表示不限制
+	} `yaml:"dialogue_history" json:"dialogue_history"`
+
+	// LLM工具调用，一次回复中的多个工具并发执行
+	ToolCall struct {
+		MaxIterations int `yaml:"max_iterations" json:"max_iterations"` // 一轮对话中最多请求LLM的次数，默认5
+		Timeout       int `yaml:"timeout"        json:"timeout"`        // 单个工具调用的超时时间(秒)，默认30
+	} `yaml:"tool_call" json:"tool_call"`
+
 	SelectedModule map[string]string `yaml:"selected_module" json:"selected_module"`
 
+	// 各模块的备用提供者，selected_module中的提供者不可用时按顺序切换
+	FallbackModule map[string][]string  `yaml:"fallback_module" json:"fallback_module"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"`
+
 	PoolConfig    PoolConfig    `yaml:"pool_config"`
 	McpPoolConfig McpPoolConfig `yaml:"mcp_pool_config"`
 
@@ -72,12 +101,20 @@ type Config struct {
 	LLM   map[string]LLMConfig  `yaml:"LLM"   json:"LLM"`
 	VLLLM map[string]VLLMConfig `yaml:"VLLLM" json:"VLLLM"`
 
+	Memory map[string]MemoryConfig `yaml:"Memory" json:"Memory"` // 长期记忆配置
+
 	CMDExit []string `yaml:"CMD_exit" json:"CMD_exit"`
 
 	// 连通性检查配置
 	ConnectivityCheck ConnectivityCheckConfig `yaml:"connectivity_check" json:"connectivity_check"`
 }
 
+// CircuitBreakerConfig 提供者熔断配置
+type CircuitBreakerConfig struct {
+	FailureThreshold int `yaml:"failure_threshold" json:"failure_threshold"` // 连续失败多少次后熔断，默认3
+	Cooldown         int `yaml:"cooldown"          json:"cooldown"`          // 熔断后跳过该提供者的时长(秒)，默认60
+}
+
 type PoolConfig struct {
 	PoolMinSize       int `yaml:"pool_min_size"`
 	PoolMaxSize       int `yaml:"pool_max_size"`
@@ -111,6 +148,11 @@ type TTSConfig struct {
 	AppID           string      `yaml:"appid"            json:"appid"`            // 应用ID
 	Token           string      `yaml:"token"            json:"token"`            // API密钥
 	Cluster         string      `yaml:"cluster"          json:"cluster"`          // 集群信息
+	URL             string      `yaml:"url"              json:"url"`              // API地址，OpenAI兼容接口使用
+	APIKey          string      `yaml:"api_key"          json:"api_key"`          // API密钥，OpenAI兼容接口使用
+	Model           string      `yaml:"model"            json:"model"`            // 模型名称
+	Speed           float64     `yaml:"speed"            json:"speed"`            // 语速
+	ResponseFormat  string      `yaml:"response_format"  json:"response_format"`  // 返回的音频格式
 	SupportedVoices []VoiceInfo `yaml:"supported_voices" json:"supported_voices"` // 支持的语音列表
 }
 
@@ -123,9 +165,24 @@ type LLMConfig struct {
 	Temperature float64                `yaml:"temperature" json:"temperature"` // 温度参数
 	MaxTokens   int                    `yaml:"max_tokens"  json:"max_tokens"`  // 最大令牌数
 	TopP        float64                `yaml:"top_p"       json:"top_p"`       // TopP参数
+	Context     ContextConfig          `yaml:"context"     json:"context"`     // 上下文预算
 	Extra       map[string]interface{} `yaml:",inline"     json:"extra"`       // 额外配置
 }
 
+// ContextConfig 对话上下文预算，超出时丢弃或总结较早的对话
+type ContextConfig struct {
+	Budget   int    `yaml:"budget"   json:"budget"`   // 上下文预算，0表示不限制
+	Unit     string `yaml:"unit"     json:"unit"`     // 预算单位：tokens(估算)或chars，默认tokens
+	Strategy string `yaml:"strategy" json:"strategy"` // 超出预算时的处理：truncate丢弃或summarize总结，默认truncate
+}
+
+// MemoryConfig 长期记忆配置结构
+type MemoryConfig struct {
+	Type       string `yaml:"type"        json:"type"`        // 记忆类型
+	MaxEntries int    `yaml:"max_entries" json:"max_entries"` // 每个设备最多保留的记忆条数
+	QueryLimit int    `yaml:"query_limit" json:"query_limit"` // 每次注入对话的记忆条数
+}
+
 // SecurityConfig 图片安全配置结构
 type SecurityConfig struct {
 	MaxFileSize       int64    `yaml:"max_file_size"      json:"max_file_size"`      // 最大文件大小（字节）
@@ -180,6 +237,10 @@ func (cfg *Config) setDefaults() {
 	cfg.Transport.WebSocket.Enabled = true
 	cfg.Transport.WebSocket.IP = "0.0.0.0"
 	cfg.Transport.WebSocket.Port = 8000
+	cfg.Transport.MqttUDP.IP = "0.0.0.0"
+	cfg.Transport.MqttUDP.Port = 1883
+	cfg.Transport.MqttUDP.UDPIP = "0.0.0.0"
+	cfg.Transport.MqttUDP.UDPPort = 8884
 
 	cfg.Web.Port = 8080
 
@@ -194,52 +255,134 @@ func (cfg *Config) setDefaults() {
 	cfg.PoolConfig.PoolMaxSize = 0
 	cfg.PoolConfig.PoolCheckInterval = 30
 
+	cfg.DialogueHistory.RetentionHours = 72
+	cfg.DialogueHistory.MaxMessages = 20
+
+	cfg.ToolCall.MaxIterations = 5
+	cfg.ToolCall.Timeout = 30
 }
 
-// LoadConfig 加载配置
-// 第一次从config.yaml加载，加载后存储到数据库加载
-// 如果数据库中已存在配置，则直接加载数据库中的配置
-func LoadConfig(dbi ConfigDBInterface) (*Config, string, error) {
-	bUseDatabaseCfg := false
-	// 尝试从数据库加载配置
-	cfgStr, err := dbi.LoadServerConfig()
-	if err != nil {
-		fmt.Println("加载服务器配置失败:", err)
-		return nil, "", err
+// DialogueRetention 对话历史保留时长
+func (cfg *Config) DialogueRetention() time.Duration {
+	hours := cfg.DialogueHistory.RetentionHours
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// MaxToolIterations 一轮对话中最多请求LLM的次数，工具调用后再次请求LLM也计入
+func (cfg *Config) MaxToolIterations() int {
+	if cfg.ToolCall.MaxIterations <= 0 {
+		return 5
 	}
+	return cfg.ToolCall.MaxIterations
+}
 
-	config := &Config{}
+// ToolCallTimeout 单个工具调用的超时时间
+func (cfg *Config) ToolCallTimeout() time.Duration {
+	seconds := cfg.ToolCall.Timeout
+	if seconds <= 0 {
+		seconds = 30
+	}
+	return time.Duration(seconds) * time.Second
+}
 
-	path := "database:serverConfig"
-	if cfgStr != "" {
-		config.FromString(cfgStr)
-		Cfg = config
-		if bUseDatabaseCfg {
-			return Cfg, path, nil
+// ModuleChain 模块的提供者列表，selected_module中的提供者在前，备用提供者按配置顺序在后
+func (cfg *Config) ModuleChain(module string) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{cfg.SelectedModule[module]}, cfg.FallbackModule[module]...) {
+		if name == "" || seen[name] {
+			continue
 		}
+		seen[name] = true
+		chain = append(chain, name)
 	}
+	return chain
+}
 
-	// 尝试从文件读取
-	path = ".config.yaml"
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		path = "config.yaml"
+// HasProvider 模块中是否配置了该名称的提供者
+func (cfg *Config) HasProvider(module, name string) bool {
+	var ok bool
+	switch module {
+	case "ASR":
+		_, ok = cfg.ASR[name]
+	case "TTS":
+		_, ok = cfg.TTS[name]
+	case "LLM":
+		_, ok = cfg.LLM[name]
+	case "VLLLM":
+		_, ok = cfg.VLLLM[name]
 	}
+	return ok
+}
+
+// dbConfigSource 使用数据库中的配置时返回的配置来源
+const dbConfigSource = "database:serverConfig"
+
+// ErrConfigConflict 配置文件和数据库中的配置都修改过，以数据库为准，配置文件的修改被忽略
+var ErrConfigConflict = errors.New("配置文件的修改与通过/api/cfg保存的配置冲突")
 
+// LoadConfig 加载配置
+// 第一次从config.yaml加载并存储到数据库，之后以数据库中的配置为准，优先级见resolveConfig
+func LoadConfig(dbi ConfigDBInterface) (*Config, string, error) {
+	path := ConfigFilePath()
 	data, err := os.ReadFile(path)
 	if err != nil {
 		// 读取配置文件失败，使用默认配置
+		config := &Config{}
 		config.setDefaults()
 		data, _ = yaml.Marshal(config)
-	} else {
-		if err := yaml.Unmarshal(data, config); err != nil {
-			return nil, path, err
-		}
 	}
 
-	err = dbi.InitServerConfig(string(data))
+	config, source, fromFile, err := resolveConfig(dbi, path, data)
+	if err != nil && !errors.Is(err, ErrConfigConflict) {
+		return nil, source, err
+	}
 	if err != nil {
-		fmt.Println("初始化服务器配置到数据库失败:", err)
+		fmt.Println(err)
+	}
+	if fromFile {
+		if err := dbi.ImportServerConfig(string(data), fileHash(data)); err != nil {
+			fmt.Println("初始化服务器配置到数据库失败:", err)
+		}
 	}
 	Cfg = config
-	return config, path, nil
+	return config, source, nil
+}
+
+// resolveConfig 按统一的优先级决定使用配置文件还是数据库中的配置，fromFile为true时调用方需将配置文件导入数据库：
+//   - 数据库中没有配置，或配置文件自上次导入后已修改且数据库中的配置未通过/api/cfg修改过时，使用配置文件
+//   - 配置文件自上次导入后未修改时，使用数据库中的配置（包括通过/api/cfg保存的修改）
+//   - 两边都修改过时使用数据库中的配置，同时返回ErrConfigConflict
+func resolveConfig(dbi ConfigDBInterface, path string, data []byte) (config *Config, source string, fromFile bool, err error) {
+	stored, err := dbi.LoadServerConfig()
+	if err != nil {
+		return nil, dbConfigSource, false, fmt.Errorf("加载数据库中的配置失败: %v", err)
+	}
+
+	hash := fileHash(data)
+	if stored != nil && stored.CfgStr != "" && (stored.FileHash == hash || stored.Edited) {
+		config = &Config{}
+		if err := config.FromString(stored.CfgStr); err != nil {
+			return nil, dbConfigSource, false, fmt.Errorf("解析数据库中的配置失败: %v", err)
+		}
+		if stored.FileHash != hash {
+			return config, dbConfigSource, false, fmt.Errorf("%w，已忽略 %s，如需以配置文件为准请通过/api/cfg提交", ErrConfigConflict, path)
+		}
+		return config, dbConfigSource, false, nil
+	}
+
+	config = &Config{}
+	if err := config.FromString(string(data)); err != nil {
+		return nil, path, false, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return config, path, true, nil
+}
+
+// fileHash 配置文件内容的SHA-256
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// activationCodeTTL 激活码有效期，过期后设备下次请求OTA时重新生成
+const activationCodeTTL = time.Hour
+
+// DeviceDB 设备登记存储
+type DeviceDB struct {
+	db *gorm.DB
+}
+
+var deviceDB *DeviceDB
+
+// GetDeviceDB 获取设备存储，数据库未初始化时返回nil
+func GetDeviceDB() *DeviceDB {
+	return deviceDB
+}
+
+func NewDeviceDB(db *gorm.DB) *DeviceDB {
+	deviceDB = &DeviceDB{db: db}
+	return deviceDB
+}
+
+// TouchDevice 登记设备并更新最后在线时间，device中为空的字段不覆盖已有记录
+func (d *DeviceDB) TouchDevice(device models.Device) error {
+	device.ID = 0
+	device.UserID = nil
+	device.LastSeen = time.Now()
+	columns := []string{"last_seen", "updated_at"}
+	for column, value := range map[string]string{
+		"client_id":        device.ClientID,
+		"board":            device.Board,
+		"firmware_version": device.FirmwareVersion,
+		"last_ip":          device.LastIP,
+	} {
+		if value != "" {
+			columns = append(columns, column)
+		}
+	}
+	err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&device).Error
+	if err != nil {
+		return fmt.Errorf("登记设备失败: %v", err)
+	}
+	return nil
+}
+
+// ListDevices 列出所有设备，最近在线的在前
+func (d *DeviceDB) ListDevices() ([]models.Device, error) {
+	var devices []models.Device
+	if err := d.db.Order("last_seen DESC").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("查询设备列表失败: %v", err)
+	}
+	return devices, nil
+}
+
+// GetDevice 获取设备，不存在时返回nil
+func (d *DeviceDB) GetDevice(deviceID string) (*models.Device, error) {
+	var device models.Device
+	err := d.db.Where("device_id = ?", deviceID).First(&device).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询设备失败: %v", err)
+	}
+	return &device, nil
+}
+
+// UpdateDevice 更新设备备注名、OTA渠道和绑定的用户，为nil的字段不修改，userID为0表示解除绑定，返回设备是否存在
+func (d *DeviceDB) UpdateDevice(deviceID string, alias, channel *string, userID *uint) (bool, error) {
+	updates := make(map[string]interface{})
+	if alias != nil {
+		updates["alias"] = *alias
+	}
+	if channel != nil {
+		if *channel != "" && *channel != models.ChannelStable && *channel != models.ChannelBeta {
+			return false, fmt.Errorf("不支持的OTA渠道: %s", *channel)
+		}
+		updates["channel"] = *channel
+	}
+	if userID != nil {
+		if *userID == 0 {
+			updates["user_id"] = nil
+		} else {
+			var count int64
+			if err := d.db.Model(&models.User{}).Where("id = ?", *userID).Count(&count).Error; err != nil {
+				return false, fmt.Errorf("查询用户失败: %v", err)
+			}
+			if count == 0 {
+				return false, fmt.Errorf("用户 %d 不存在", *userID)
+			}
+			updates["user_id"] = *userID
+			updates["activation_code"] = ""
+			updates["activation_expires_at"] = nil
+		}
+	}
+
+	var count int64
+	if err := d.db.Model(&models.Device{}).Where("device_id = ?", deviceID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("查询设备失败: %v", err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if len(updates) == 0 {
+		return true, nil
+	}
+	if err := d.db.Model(&models.Device{}).Where("device_id = ?", deviceID).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("更新设备失败: %v", err)
+	}
+	return true, nil
+}
+
+// IsActivated 设备是否已激活（已绑定用户）
+func (d *DeviceDB) IsActivated(deviceID string) (bool, error) {
+	var count int64
+	err := d.db.Model(&models.Device{}).Where("device_id = ? AND user_id IS NOT NULL", deviceID).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("查询设备激活状态失败: %v", err)
+	}
+	return count > 0, nil
+}
+
+// ActivationCode 获取未激活设备的6位激活码，没有或已过期时重新生成，设备已激活时返回空
+func (d *DeviceDB) ActivationCode(deviceID string) (string, error) {
+	device, err := d.GetDevice(deviceID)
+	if err != nil {
+		return "", err
+	}
+	if device == nil {
+		device = &models.Device{DeviceID: deviceID, LastSeen: time.Now()}
+		if err := d.db.Create(device).Error; err != nil {
+			return "", fmt.Errorf("登记设备失败: %v", err)
+		}
+	}
+	if device.UserID != nil {
+		return "", nil
+	}
+	now := time.Now()
+	if device.ActivationCode != "" && device.ActivationExpiresAt != nil && now.Before(*device.ActivationExpiresAt) {
+		return device.ActivationCode, nil
+	}
+
+	code, err := d.newActivationCode()
+	if err != nil {
+		return "", err
+	}
+	err = d.db.Model(device).Updates(map[string]interface{}{
+		"activation_code":       code,
+		"activation_expires_at": now.Add(activationCodeTTL),
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("保存激活码失败: %v", err)
+	}
+	return code, nil
+}
+
+// Activate 将激活码对应的未激活设备绑定到用户并清除激活码，返回设备ID，激活码无效或已过期时返回空
+func (d *DeviceDB) Activate(code string, userID uint) (string, error) {
+	var count int64
+	if err := d.db.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return "", fmt.Errorf("查询用户失败: %v", err)
+	}
+	if count == 0 {
+		return "", fmt.Errorf("用户 %d 不存在", userID)
+	}
+
+	var device models.Device
+	err := d.db.Where("activation_code = ? AND user_id IS NULL AND activation_expires_at > ?", code, time.Now()).First(&device).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", nil
+		}
+		return "", fmt.Errorf("查询激活码失败: %v", err)
+	}
+	err = d.db.Model(&device).Updates(map[string]interface{}{
+		"user_id":               userID,
+		"activation_code":       "",
+		"activation_expires_at": nil,
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("激活设备失败: %v", err)
+	}
+	return device.DeviceID, nil
+}
+
+// newActivationCode 生成未被其他设备使用的6位数字激活码，已过期的激活码可以复用
+func (d *DeviceDB) newActivationCode() (string, error) {
+	for i := 0; i < 10; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", fmt.Errorf("生成激活码失败: %v", err)
+		}
+		code := fmt.Sprintf("%06d", n.Int64())
+		var count int64
+		err = d.db.Model(&models.Device{}).Where("activation_code = ? AND activation_expires_at > ?", code, time.Now()).Count(&count).Error
+		if err != nil {
+			return "", fmt.Errorf("查询激活码失败: %v", err)
+		}
+		if count == 0 {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("生成激活码失败: 多次重复")
+}
+
+// DeleteDevice 删除设备记录，返回是否存在
+func (d *DeviceDB) DeleteDevice(deviceID string) (bool, error) {
+	result := d.db.Where("device_id = ?", deviceID).Delete(&models.Device{})
+	if result.Error != nil {
+		return false, fmt.Errorf("删除设备失败: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDeviceDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserSetting{}, &models.Device{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	d := &DeviceDB{db: db}
+	u := &UserDB{db: db}
+
+	// OTA登记开发板和固件版本，建立会话时只更新客户端和IP，不覆盖其他字段
+	if err := d.TouchDevice(models.Device{DeviceID: "aa:bb", Board: "bread-compact-wifi", FirmwareVersion: "1.6.0", LastIP: "10.0.0.2"}); err != nil {
+		t.Fatalf("TouchDevice() error = %v", err)
+	}
+	if err := d.TouchDevice(models.Device{DeviceID: "aa:bb", ClientID: "c1", LastIP: "10.0.0.3"}); err != nil {
+		t.Fatalf("TouchDevice() error = %v", err)
+	}
+	device, err := d.GetDevice("aa:bb")
+	if err != nil || device == nil {
+		t.Fatalf("GetDevice() = %v, %v", device, err)
+	}
+	if device.Board != "bread-compact-wifi" || device.FirmwareVersion != "1.6.0" || device.ClientID != "c1" || device.LastIP != "10.0.0.3" {
+		t.Errorf("GetDevice() = %+v", device)
+	}
+	if device, _ := d.GetDevice("cc:dd"); device != nil {
+		t.Errorf("GetDevice() 未登记设备应返回nil")
+	}
+
+	// 登记不影响已有的用户绑定
+	mom, _ := u.CreateUser("mom", "secret", "user")
+	u.BindDevice(mom.ID, "aa:bb")
+	d.TouchDevice(models.Device{DeviceID: "aa:bb", LastIP: "10.0.0.4"})
+	if device, _ := d.GetDevice("aa:bb"); device.UserID == nil || *device.UserID != mom.ID {
+		t.Errorf("TouchDevice() 不应覆盖绑定的用户: %+v", device)
+	}
+
+	alias, channel := "客厅", models.ChannelBeta
+	none := uint(0)
+	if found, err := d.UpdateDevice("aa:bb", &alias, &channel, &none); err != nil || !found {
+		t.Fatalf("UpdateDevice() = %v, %v", found, err)
+	}
+	if device, _ := d.GetDevice("aa:bb"); device.Alias != "客厅" || device.Channel != "beta" || device.UserID != nil {
+		t.Errorf("UpdateDevice() = %+v, want alias, beta channel and unbound", device)
+	}
+	missing := uint(999)
+	if _, err := d.UpdateDevice("aa:bb", nil, nil, &missing); err == nil {
+		t.Errorf("UpdateDevice() 用户不存在应返回错误")
+	}
+	unknown := "nightly"
+	if _, err := d.UpdateDevice("aa:bb", nil, &unknown, nil); err == nil {
+		t.Errorf("UpdateDevice() 不支持的渠道应返回错误")
+	}
+	if found, _ := d.UpdateDevice("cc:dd", &alias, nil, nil); found {
+		t.Errorf("UpdateDevice() 设备不存在应返回false")
+	}
+
+	if list, err := d.ListDevices(); err != nil || len(list) != 1 {
+		t.Errorf("ListDevices() = %d, %v, want 1", len(list), err)
+	}
+	if found, err := d.DeleteDevice("aa:bb"); err != nil || !found {
+		t.Errorf("DeleteDevice() = %v, %v", found, err)
+	}
+	if found, _ := d.DeleteDevice("aa:bb"); found {
+		t.Errorf("DeleteDevice() 重复删除应返回false")
+	}
+}
+
+func TestDeviceActivation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserSetting{}, &models.Device{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	d := &DeviceDB{db: db}
+	u := &UserDB{db: db}
+	mom, _ := u.CreateUser("mom", "secret", "user")
+
+	code, err := d.ActivationCode("aa:bb")
+	if err != nil || len(code) != 6 {
+		t.Fatalf("ActivationCode() = %q, %v, want 6 digits", code, err)
+	}
+	if again, _ := d.ActivationCode("aa:bb"); again != code {
+		t.Errorf("ActivationCode() 未激活前应返回相同的激活码: %s != %s", again, code)
+	}
+	if activated, _ := d.IsActivated("aa:bb"); activated {
+		t.Errorf("IsActivated() 未绑定用户的设备应未激活")
+	}
+
+	// 激活码过期后不能使用，重新获取时生成新的激活码
+	db.Model(&models.Device{}).Where("device_id = ?", "aa:bb").Update("activation_expires_at", time.Now().Add(-time.Minute))
+	if deviceID, _ := d.Activate(code, mom.ID); deviceID != "" {
+		t.Errorf("Activate() 过期的激活码不能使用")
+	}
+	code, err = d.ActivationCode("aa:bb")
+	if err != nil || len(code) != 6 {
+		t.Fatalf("ActivationCode() 过期后 = %q, %v, want 6 digits", code, err)
+	}
+	if device, _ := d.GetDevice("aa:bb"); device.ActivationExpiresAt == nil || !device.ActivationExpiresAt.After(time.Now()) {
+		t.Errorf("ActivationCode() 过期后应重新设置有效期: %+v", device)
+	}
+
+	if deviceID, err := d.Activate("000000x", mom.ID); err != nil || deviceID != "" {
+		t.Errorf("Activate() 无效激活码 = %q, %v", deviceID, err)
+	}
+	if _, err := d.Activate(code, 999); err == nil {
+		t.Errorf("Activate() 用户不存在应返回错误")
+	}
+	if deviceID, err := d.Activate(code, mom.ID); err != nil || deviceID != "aa:bb" {
+		t.Fatalf("Activate() = %q, %v, want aa:bb", deviceID, err)
+	}
+	if activated, _ := d.IsActivated("aa:bb"); !activated {
+		t.Errorf("IsActivated() 激活后应为true")
+	}
+	if code, _ := d.ActivationCode("aa:bb"); code != "" {
+		t.Errorf("ActivationCode() 已激活设备应返回空, got %s", code)
+	}
+	if deviceID, _ := d.Activate(code, mom.ID); deviceID != "" {
+		t.Errorf("Activate() 激活码不能重复使用")
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DialogueDB 设备对话历史存储
+type DialogueDB struct {
+	db *gorm.DB
+}
+
+var dialogueDB *DialogueDB
+
+// GetDialogueDB 获取对话历史存储，数据库未初始化时返回nil
+func GetDialogueDB() *DialogueDB {
+	return dialogueDB
+}
+
+func NewDialogueDB(db *gorm.DB) *DialogueDB {
+	dialogueDB = &DialogueDB{db: db}
+	return dialogueDB
+}
+
+// SaveDialogue 保存设备的对话历史和较早对话的摘要，已存在时覆盖
+func (d *DialogueDB) SaveDialogue(deviceID, content, summary string, messageCount int) error {
+	record := models.Dialogue{
+		DeviceID:     deviceID,
+		Content:      content,
+		Summary:      summary,
+		MessageCount: messageCount,
+	}
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "summary", "message_count", "updated_at"}),
+	}).Create(&record).Error
+}
+
+// LoadDialogue 获取设备在since之后更新的对话历史，不存在时返回nil
+func (d *DialogueDB) LoadDialogue(deviceID string, since time.Time) (*models.Dialogue, error) {
+	var record models.Dialogue
+	err := d.db.Where("device_id = ? AND updated_at >= ?", deviceID, since).First(&record).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询对话历史失败: %v", err)
+	}
+	return &record, nil
+}
+
+// ListDialogues 列出since之后更新的对话历史，不包含对话内容
+func (d *DialogueDB) ListDialogues(since time.Time) ([]models.Dialogue, error) {
+	var records []models.Dialogue
+	err := d.db.Omit("content", "summary").
+		Where("updated_at >= ?", since).
+		Order("updated_at DESC").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询对话历史列表失败: %v", err)
+	}
+	return records, nil
+}
+
+// DeleteDialogue 删除设备的对话历史，返回是否存在
+func (d *DialogueDB) DeleteDialogue(deviceID string) (bool, error) {
+	result := d.db.Where("device_id = ?", deviceID).Delete(&models.Dialogue{})
+	if result.Error != nil {
+		return false, fmt.Errorf("删除对话历史失败: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// PurgeDialogues 清理before之前更新的对话历史
+func (d *DialogueDB) PurgeDialogues(before time.Time) (int64, error) {
+	result := d.db.Where("updated_at < ?", before).Delete(&models.Dialogue{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("清理过期对话历史失败: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDialogueDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Dialogue{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	d := &DialogueDB{db: db}
+	since := time.Now().Add(-time.Hour)
+
+	if err := d.SaveDialogue("aa:bb", `[{"role":"user","content":"你好"}]`, "", 1); err != nil {
+		t.Fatalf("SaveDialogue() error = %v", err)
+	}
+	if err := d.SaveDialogue("aa:bb", `[{"role":"user","content":"再见"}]`, "用户问过天气", 2); err != nil {
+		t.Fatalf("SaveDialogue() 覆盖 error = %v", err)
+	}
+	if err := d.SaveDialogue("cc:dd", `[]`, "", 0); err != nil {
+		t.Fatalf("SaveDialogue() error = %v", err)
+	}
+
+	record, err := d.LoadDialogue("aa:bb", since)
+	if err != nil || record == nil {
+		t.Fatalf("LoadDialogue() = %v, %v", record, err)
+	}
+	if record.MessageCount != 2 || record.Content != `[{"role":"user","content":"再见"}]` || record.Summary != "用户问过天气" {
+		t.Errorf("LoadDialogue() = %+v, want overwritten record", record)
+	}
+	if record, _ := d.LoadDialogue("aa:bb", time.Now().Add(time.Hour)); record != nil {
+		t.Errorf("LoadDialogue() 超过保留时长应返回nil")
+	}
+
+	list, err := d.ListDialogues(since)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListDialogues() = %d, %v, want 2", len(list), err)
+	}
+	if list[0].Content != "" {
+		t.Errorf("ListDialogues() 不应返回对话内容")
+	}
+
+	if found, err := d.DeleteDialogue("cc:dd"); err != nil || !found {
+		t.Errorf("DeleteDialogue() = %v, %v, want true", found, err)
+	}
+	if found, _ := d.DeleteDialogue("cc:dd"); found {
+		t.Errorf("DeleteDialogue() 重复删除应返回false")
+	}
+
+	if count, err := d.PurgeDialogues(time.Now().Add(time.Hour)); err != nil || count != 1 {
+		t.Errorf("PurgeDialogues() = %d, %v, want 1", count, err)
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// FirmwareDB OTA固件记录存储，固件文件保存在ota_bin目录
+type FirmwareDB struct {
+	db *gorm.DB
+}
+
+var firmwareDB *FirmwareDB
+
+// GetFirmwareDB 获取固件存储，数据库未初始化时返回nil
+func GetFirmwareDB() *FirmwareDB {
+	return firmwareDB
+}
+
+func NewFirmwareDB(db *gorm.DB) *FirmwareDB {
+	firmwareDB = &FirmwareDB{db: db}
+	return firmwareDB
+}
+
+// CreateFirmware 保存固件记录，同一开发板的版本号不能重复
+func (f *FirmwareDB) CreateFirmware(firmware *models.Firmware) error {
+	var count int64
+	err := f.db.Model(&models.Firmware{}).
+		Where("board = ? AND version = ?", firmware.Board, firmware.Version).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("查询固件失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("开发板 %q 的固件版本 %s 已存在", firmware.Board, firmware.Version)
+	}
+	if err := f.db.Create(firmware).Error; err != nil {
+		return fmt.Errorf("保存固件失败: %v", err)
+	}
+	return nil
+}
+
+// ListFirmwares 列出所有固件，最近上传的在前
+func (f *FirmwareDB) ListFirmwares() ([]models.Firmware, error) {
+	var firmwares []models.Firmware
+	if err := f.db.Order("id DESC").Find(&firmwares).Error; err != nil {
+		return nil, fmt.Errorf("查询固件列表失败: %v", err)
+	}
+	return firmwares, nil
+}
+
+// FirmwaresForBoard 列出适用于开发板的固件，包括不限开发板的固件
+func (f *FirmwareDB) FirmwaresForBoard(board string) ([]models.Firmware, error) {
+	var firmwares []models.Firmware
+	if err := f.db.Where("board = ? OR board = ''", board).Find(&firmwares).Error; err != nil {
+		return nil, fmt.Errorf("查询固件失败: %v", err)
+	}
+	return firmwares, nil
+}
+
+// UpdateFirmware 更新固件的渠道和灰度比例，为nil的字段不修改，返回固件是否存在
+func (f *FirmwareDB) UpdateFirmware(id uint, channel *string, rollout *int) (bool, error) {
+	updates := make(map[string]interface{})
+	if channel != nil {
+		updates["channel"] = *channel
+	}
+	if rollout != nil {
+		updates["rollout"] = *rollout
+	}
+
+	var count int64
+	if err := f.db.Model(&models.Firmware{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("查询固件失败: %v", err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if len(updates) == 0 {
+		return true, nil
+	}
+	if err := f.db.Model(&models.Firmware{ID: id}).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("更新固件失败: %v", err)
+	}
+	return true, nil
+}
+
+// DeleteFirmware 删除固件记录，返回被删除的记录，不存在时返回nil
+func (f *FirmwareDB) DeleteFirmware(id uint) (*models.Firmware, error) {
+	var firmware models.Firmware
+	if err := f.db.First(&firmware, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询固件失败: %v", err)
+	}
+	if err := f.db.Delete(&firmware).Error; err != nil {
+		return nil, fmt.Errorf("删除固件失败: %v", err)
+	}
+	return &firmware, nil
+}
+
+// ManagedFilenames 已登记固件的文件名
+func (f *FirmwareDB) ManagedFilenames() (map[string]bool, error) {
+	var filenames []string
+	if err := f.db.Model(&models.Firmware{}).Pluck("filename", &filenames).Error; err != nil {
+		return nil, fmt.Errorf("查询固件失败: %v", err)
+	}
+	managed := make(map[string]bool, len(filenames))
+	for _, name := range filenames {
+		managed[name] = true
+	}
+	return managed, nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFirmwareDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Firmware{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	f := &FirmwareDB{db: db}
+
+	for _, fw := range []models.Firmware{
+		{Board: "", Version: "1.6.0", Channel: "stable", Rollout: 100, Filename: "1.6.0.bin"},
+		{Board: "bread-compact-wifi", Version: "1.6.1", Channel: "beta", Rollout: 10, Filename: "bread-compact-wifi_1.6.1.bin"},
+		{Board: "esp-box-3", Version: "1.6.1", Channel: "stable", Rollout: 100, Filename: "esp-box-3_1.6.1.bin"},
+	} {
+		if err := f.CreateFirmware(&fw); err != nil {
+			t.Fatalf("CreateFirmware() error = %v", err)
+		}
+	}
+	if err := f.CreateFirmware(&models.Firmware{Board: "esp-box-3", Version: "1.6.1", Filename: "x.bin"}); err == nil {
+		t.Errorf("CreateFirmware() 同一开发板重复版本应返回错误")
+	}
+
+	list, err := f.FirmwaresForBoard("bread-compact-wifi")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("FirmwaresForBoard() = %d, %v, want 2", len(list), err)
+	}
+	for _, fw := range list {
+		if fw.Board == "esp-box-3" {
+			t.Errorf("FirmwaresForBoard() 不应包含其他开发板的固件")
+		}
+	}
+
+	channel, rollout := "stable", 50
+	if found, err := f.UpdateFirmware(list[1].ID, &channel, &rollout); err != nil || !found {
+		t.Fatalf("UpdateFirmware() = %v, %v", found, err)
+	}
+	if found, _ := f.UpdateFirmware(999, &channel, nil); found {
+		t.Errorf("UpdateFirmware() 不存在的固件应返回false")
+	}
+
+	managed, err := f.ManagedFilenames()
+	if err != nil || len(managed) != 3 || !managed["1.6.0.bin"] {
+		t.Errorf("ManagedFilenames() = %v, %v", managed, err)
+	}
+
+	deleted, err := f.DeleteFirmware(list[0].ID)
+	if err != nil || deleted == nil || deleted.Filename == "" {
+		t.Fatalf("DeleteFirmware() = %+v, %v", deleted, err)
+	}
+	if deleted, _ := f.DeleteFirmware(list[0].ID); deleted != nil {
+		t.Errorf("DeleteFirmware() 重复删除应返回nil")
+	}
+	if all, _ := f.ListFirmwares(); len(all) != 2 {
+		t.Errorf("ListFirmwares() = %d, want 2", len(all))
+	}
+}
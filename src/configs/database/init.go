@@ -121,6 +121,10 @@ func InitDB() (*gorm.DB, string, error) {
 	DB = db
 
 	NewServerConfigDB(db)
+	NewDialogueDB(db)
+	NewUserDB(db)
+	NewDeviceDB(db)
+	NewFirmwareDB(db)
 
 	return db, dbType, nil
 }
@@ -140,7 +144,11 @@ func migrateTables(db *gorm.DB) error {
 		&models.SystemConfig{},
 		&models.User{},
 		&models.UserSetting{},
+		&models.Device{},
+		&models.Firmware{},
 		&models.ModuleConfig{},
+		&models.Memory{},
+		&models.Dialogue{},
 	)
 }
 
@@ -36,30 +36,21 @@ func (d *ServerConfigDB) IsServerConfigExists() (bool, error) {
 	return count > 0, nil
 }
 
-func (d *ServerConfigDB) InitServerConfig(cfgStr string) error {
-	var count int64
-	if err := d.db.Model(&models.ServerConfig{}).Count(&count).Error; err != nil {
-		if strings.Contains(err.Error(), "no such table") {
-			// 创建table
-			if err := d.db.AutoMigrate(&models.ServerConfig{}); err != nil {
-				return fmt.Errorf("创建服务器配置表失败: %v", err)
-			}
-		} else {
-			return err
-		}
-	}
-	if count > 0 {
-		return nil
+// ImportServerConfig 保存从配置文件导入的配置，覆盖数据库中已有的配置并清除修改标记
+func (d *ServerConfigDB) ImportServerConfig(cfgStr, fileHash string) error {
+	if err := d.db.AutoMigrate(&models.ServerConfig{}); err != nil {
+		return fmt.Errorf("创建服务器配置表失败: %v", err)
 	}
-
-	defaultConfig := models.ServerConfig{
-		ID:     ServerConfigID,
-		CfgStr: cfgStr,
+	config := models.ServerConfig{
+		ID:       ServerConfigID,
+		CfgStr:   cfgStr,
+		FileHash: fileHash,
+		Edited:   false,
 	}
-
-	return d.db.Create(&defaultConfig).Error
+	return d.db.Save(&config).Error
 }
 
+// UpdateServerConfig 保存通过/api/cfg修改的配置，之后配置文件的修改不再覆盖数据库
 func (d *ServerConfigDB) UpdateServerConfig(cfgStr string) error {
 	// 只有一个
 	var count int64
@@ -70,25 +61,27 @@ func (d *ServerConfigDB) UpdateServerConfig(cfgStr string) error {
 		return fmt.Errorf("服务器配置未找到")
 	}
 
-	return d.db.Model(&models.ServerConfig{}).Where("id = ?", ServerConfigID).Update("cfg_str", cfgStr).Error
+	return d.db.Model(&models.ServerConfig{}).Where("id = ?", ServerConfigID).
+		Updates(map[string]interface{}{"cfg_str": cfgStr, "edited": true}).Error
 }
 
-func (d *ServerConfigDB) LoadServerConfig() (string, error) {
+// LoadServerConfig 加载数据库中的配置，不存在时返回nil
+func (d *ServerConfigDB) LoadServerConfig() (*models.ServerConfig, error) {
 	var config models.ServerConfig
 
 	if err := d.db.AutoMigrate(&models.ServerConfig{}); err != nil {
-		return "", fmt.Errorf("创建服务器配置表失败: %v", err)
+		return nil, fmt.Errorf("创建服务器配置表失败: %v", err)
 	}
 
 	if err := d.db.First(&config, ServerConfigID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return "", nil
+			return nil, nil
 		}
 		if strings.Contains(err.Error(), "no such table") {
-			return "", nil
+			return nil, nil
 		}
-		return "", fmt.Errorf("查询服务器配置失败: %v", err)
+		return nil, fmt.Errorf("查询服务器配置失败: %v", err)
 	}
 
-	return config.CfgStr, nil
+	return &config, nil
 }
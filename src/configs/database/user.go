@@ -0,0 +1,210 @@
+package database
+
+import (
+	"fmt"
+
+	"xiaozhi-server-go/src/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserDB 用户、用户设置及设备绑定存储，设备绑定保存在devices表的user_id
+type UserDB struct {
+	db *gorm.DB
+}
+
+var userDB *UserDB
+
+// GetUserDB 获取用户存储，数据库未初始化时返回nil
+func GetUserDB() *UserDB {
+	return userDB
+}
+
+func NewUserDB(db *gorm.DB) *UserDB {
+	userDB = &UserDB{db: db}
+	return userDB
+}
+
+// CreateUser 创建用户及其空设置，密码以bcrypt哈希保存
+func (u *UserDB) CreateUser(username, password, role string) (*models.User, error) {
+	var count int64
+	if err := u.db.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("用户名 %s 已存在", username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{Username: username, Password: hash, Role: role}
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		user.Setting = models.UserSetting{UserID: user.ID}
+		return tx.Create(&user.Setting).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建用户失败: %v", err)
+	}
+	user.Devices = []models.Device{}
+	return &user, nil
+}
+
+// ListUsers 列出所有用户，包含设置和绑定的设备
+func (u *UserDB) ListUsers() ([]models.User, error) {
+	var users []models.User
+	if err := u.db.Preload("Setting").Preload("Devices").Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("查询用户列表失败: %v", err)
+	}
+	return users, nil
+}
+
+// GetUser 获取用户，包含设置和绑定的设备，不存在时返回nil
+func (u *UserDB) GetUser(id uint) (*models.User, error) {
+	var user models.User
+	err := u.db.Preload("Setting").Preload("Devices").First(&user, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+	return &user, nil
+}
+
+// UpdateUser 更新用户名、密码和角色，为空的字段不修改，返回用户是否存在
+func (u *UserDB) UpdateUser(id uint, username, password, role string) (bool, error) {
+	if !u.exists(id) {
+		return false, nil
+	}
+	updates := make(map[string]interface{})
+	if username != "" {
+		var count int64
+		if err := u.db.Model(&models.User{}).Where("username = ? AND id <> ?", username, id).Count(&count).Error; err != nil {
+			return false, fmt.Errorf("查询用户失败: %v", err)
+		}
+		if count > 0 {
+			return false, fmt.Errorf("用户名 %s 已存在", username)
+		}
+		updates["username"] = username
+	}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return false, err
+		}
+		updates["password"] = hash
+	}
+	if role != "" {
+		updates["role"] = role
+	}
+
+	if len(updates) == 0 {
+		return true, nil
+	}
+	if err := u.db.Model(&models.User{ID: id}).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("更新用户失败: %v", err)
+	}
+	return true, nil
+}
+
+// DeleteUser 删除用户及其设置，并解除其设备的绑定，返回是否存在
+func (u *UserDB) DeleteUser(id uint) (bool, error) {
+	var found bool
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&models.UserSetting{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Device{}).Where("user_id = ?", id).Update("user_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.User{}, id)
+		found = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("删除用户失败: %v", err)
+	}
+	return found, nil
+}
+
+// SaveSetting 保存用户设置，已存在时覆盖，返回用户是否存在
+func (u *UserDB) SaveSetting(userID uint, setting models.UserSetting) (bool, error) {
+	if !u.exists(userID) {
+		return false, nil
+	}
+	setting.ID = 0
+	setting.UserID = userID
+	err := u.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"selected_asr", "selected_tts", "selected_llm", "selected_vlllm",
+			"prompt_override", "quick_reply_words",
+		}),
+	}).Create(&setting).Error
+	if err != nil {
+		return false, fmt.Errorf("保存用户设置失败: %v", err)
+	}
+	return true, nil
+}
+
+// BindDevice 将设备绑定到用户并清除激活码，设备未登记时先登记，已绑定其他用户时改为绑定到该用户，返回用户是否存在
+func (u *UserDB) BindDevice(userID uint, deviceID string) (bool, error) {
+	if !u.exists(userID) {
+		return false, nil
+	}
+	device := models.Device{DeviceID: deviceID, UserID: &userID}
+	err := u.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "activation_code", "activation_expires_at", "updated_at"}),
+	}).Create(&device).Error
+	if err != nil {
+		return false, fmt.Errorf("绑定设备失败: %v", err)
+	}
+	return true, nil
+}
+
+// UnbindDevice 解除设备与用户的绑定，返回绑定是否存在
+func (u *UserDB) UnbindDevice(userID uint, deviceID string) (bool, error) {
+	result := u.db.Model(&models.Device{}).
+		Where("user_id = ? AND device_id = ?", userID, deviceID).
+		Update("user_id", nil)
+	if result.Error != nil {
+		return false, fmt.Errorf("解除设备绑定失败: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeviceSetting 获取设备所属用户的设置，设备未绑定用户时返回nil
+func (u *UserDB) DeviceSetting(deviceID string) (*models.UserSetting, error) {
+	var setting models.UserSetting
+	err := u.db.Joins("JOIN devices ON devices.user_id = user_settings.user_id").
+		Where("devices.device_id = ?", deviceID).
+		First(&setting).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询设备的用户设置失败: %v", err)
+	}
+	return &setting, nil
+}
+
+func (u *UserDB) exists(id uint) bool {
+	var count int64
+	u.db.Model(&models.User{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("密码加密失败: %v", err)
+	}
+	return string(hash), nil
+}
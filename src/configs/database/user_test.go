@@ -0,0 +1,91 @@
+package database
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUserDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserSetting{}, &models.Device{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	u := &UserDB{db: db}
+
+	mom, err := u.CreateUser("mom", "secret", "user")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(mom.Password), []byte("secret")) != nil {
+		t.Errorf("CreateUser() 密码应以bcrypt哈希保存")
+	}
+	if _, err := u.CreateUser("mom", "other", "user"); err == nil {
+		t.Errorf("CreateUser() 重复用户名应返回错误")
+	}
+	kid, _ := u.CreateUser("kid", "secret", "user")
+
+	if found, err := u.BindDevice(mom.ID, "aa:bb"); err != nil || !found {
+		t.Fatalf("BindDevice() = %v, %v", found, err)
+	}
+	if found, _ := u.BindDevice(999, "aa:bb"); found {
+		t.Errorf("BindDevice() 用户不存在应返回false")
+	}
+
+	// 未设置时使用空设置，设备未绑定时返回nil
+	if setting, err := u.DeviceSetting("aa:bb"); err != nil || setting == nil || setting.SelectedLLM != "" {
+		t.Errorf("DeviceSetting() = %+v, %v, want empty setting", setting, err)
+	}
+	if setting, _ := u.DeviceSetting("cc:dd"); setting != nil {
+		t.Errorf("DeviceSetting() 未绑定设备应返回nil")
+	}
+
+	setting := models.UserSetting{SelectedLLM: "OllamaLLM", PromptOverride: "你是妈妈的助手"}
+	if found, err := u.SaveSetting(mom.ID, setting); err != nil || !found {
+		t.Fatalf("SaveSetting() = %v, %v", found, err)
+	}
+	setting.SelectedLLM = "ChatGLMLLM"
+	if _, err := u.SaveSetting(mom.ID, setting); err != nil {
+		t.Fatalf("SaveSetting() 覆盖 error = %v", err)
+	}
+	if got, _ := u.DeviceSetting("aa:bb"); got == nil || got.SelectedLLM != "ChatGLMLLM" || got.PromptOverride != "你是妈妈的助手" {
+		t.Errorf("DeviceSetting() = %+v, want overwritten setting", got)
+	}
+
+	// 绑定到其他用户时改为使用该用户的设置
+	u.BindDevice(kid.ID, "aa:bb")
+	if got, _ := u.DeviceSetting("aa:bb"); got == nil || got.UserID != kid.ID {
+		t.Errorf("DeviceSetting() = %+v, want kid's setting", got)
+	}
+	if found, _ := u.UnbindDevice(mom.ID, "aa:bb"); found {
+		t.Errorf("UnbindDevice() 其他用户的设备应返回false")
+	}
+
+	if found, err := u.UpdateUser(kid.ID, "mom", "", ""); err == nil || found {
+		t.Errorf("UpdateUser() 重复用户名应返回错误")
+	}
+	if found, err := u.UpdateUser(kid.ID, "", "", "admin"); err != nil || !found {
+		t.Errorf("UpdateUser() = %v, %v", found, err)
+	}
+	user, err := u.GetUser(kid.ID)
+	if err != nil || user == nil || user.Role != "admin" || len(user.Devices) != 1 || user.Username != "kid" {
+		t.Fatalf("GetUser() = %+v, %v", user, err)
+	}
+
+	if found, err := u.DeleteUser(kid.ID); err != nil || !found {
+		t.Errorf("DeleteUser() = %v, %v", found, err)
+	}
+	if setting, _ := u.DeviceSetting("aa:bb"); setting != nil {
+		t.Errorf("删除用户后设备绑定应被删除")
+	}
+	if users, err := u.ListUsers(); err != nil || len(users) != 1 || users[0].Setting.SelectedLLM != "ChatGLMLLM" {
+		t.Errorf("ListUsers() = %+v, %v", users, err)
+	}
+}
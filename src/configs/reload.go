@@ -0,0 +1,211 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadHandler 配置重载回调，oldCfg为重载前的配置
+type ReloadHandler func(newCfg, oldCfg *Config)
+
+var (
+	cfgMu          sync.RWMutex
+	reloadMu       sync.Mutex // 串行化重载
+	reloadHandlers []ReloadHandler
+)
+
+// Current 获取当前生效的配置
+func Current() *Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return Cfg
+}
+
+// OnReload 注册配置重载回调
+func OnReload(handler ReloadHandler) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHandlers = append(reloadHandlers, handler)
+}
+
+// ApplyConfig 将新配置设为当前配置并通知所有回调。
+// 旧配置对象不会被修改，已建立的会话继续使用旧配置，新会话使用新配置。
+func ApplyConfig(newCfg *Config) error {
+	if newCfg == nil {
+		return fmt.Errorf("配置为空")
+	}
+	if err := newCfg.Validate(); err != nil {
+		return err
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfgMu.Lock()
+	oldCfg := Cfg
+	Cfg = newCfg
+	cfgMu.Unlock()
+
+	for _, handler := range reloadHandlers {
+		handler(newCfg, oldCfg)
+	}
+	return nil
+}
+
+// ConfigFilePath 获取配置文件路径，优先使用.config.yaml
+func ConfigFilePath() string {
+	path := ".config.yaml"
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = "config.yaml"
+	}
+	return path
+}
+
+// ReloadConfig 重新读取配置文件，与启动时使用相同的优先级（见resolveConfig）：
+// 配置文件未修改时保持当前配置；数据库中的配置已通过/api/cfg修改时拒绝配置文件的修改，返回ErrConfigConflict
+func ReloadConfig(dbi ConfigDBInterface) (*Config, string, error) {
+	path := ConfigFilePath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, path, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	config, source, fromFile, err := resolveConfig(dbi, path, data)
+	if err != nil {
+		return nil, source, err
+	}
+	if !fromFile {
+		// 配置文件内容未变化，数据库中的配置已经生效
+		return Current(), source, nil
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, path, err
+	}
+	if err := dbi.ImportServerConfig(string(data), fileHash(data)); err != nil {
+		return nil, path, fmt.Errorf("同步配置到数据库失败: %v", err)
+	}
+	if err := ApplyConfig(config); err != nil {
+		return nil, path, err
+	}
+	return config, path, nil
+}
+
+// WatchConfigFile 轮询配置文件的修改时间，文件变化时调用onChange
+func WatchConfigFile(ctx context.Context, interval time.Duration, onChange func(path string)) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	path := ConfigFilePath()
+	lastMod := modTime(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := ConfigFilePath()
+			mod := modTime(current)
+			if current != path || !mod.Equal(lastMod) {
+				path, lastMod = current, mod
+				if !mod.IsZero() {
+					onChange(path)
+				}
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Validate 校验配置的完整性
+func (cfg *Config) Validate() error {
+	ports := map[string]int{
+		"server.port":                 cfg.Server.Port,
+		"transport.websocket.port":    cfg.Transport.WebSocket.Port,
+		"transport.mqtt_udp.port":     cfg.Transport.MqttUDP.Port,
+		"transport.mqtt_udp.udp_port": cfg.Transport.MqttUDP.UDPPort,
+		"web.port":                    cfg.Web.Port,
+	}
+	for name, port := range ports {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("%s 端口无效: %d", name, port)
+		}
+	}
+
+	for name, asr := range cfg.ASR {
+		if t, _ := asr["type"].(string); t == "" {
+			return fmt.Errorf("ASR.%s 缺少type", name)
+		}
+	}
+	for name, tts := range cfg.TTS {
+		if tts.Type == "" {
+			return fmt.Errorf("TTS.%s 缺少type", name)
+		}
+	}
+	for name, llm := range cfg.LLM {
+		if llm.Type == "" {
+			return fmt.Errorf("LLM.%s 缺少type", name)
+		}
+	}
+	for name, vlllm := range cfg.VLLLM {
+		if vlllm.Type == "" {
+			return fmt.Errorf("VLLLM.%s 缺少type", name)
+		}
+	}
+	for name, memory := range cfg.Memory {
+		if memory.Type == "" {
+			return fmt.Errorf("Memory.%s 缺少type", name)
+		}
+	}
+
+	// 选择的模块必须存在对应的配置
+	for module, name := range cfg.SelectedModule {
+		if name != "" && !cfg.moduleConfigExists(module, name) {
+			return fmt.Errorf("selected_module.%s 引用的配置 %s 不存在", module, name)
+		}
+	}
+	for module, names := range cfg.FallbackModule {
+		for _, name := range names {
+			if !cfg.moduleConfigExists(module, name) {
+				return fmt.Errorf("fallback_module.%s 引用的配置 %s 不存在", module, name)
+			}
+		}
+	}
+	if cfg.CircuitBreaker.FailureThreshold < 0 || cfg.CircuitBreaker.Cooldown < 0 {
+		return fmt.Errorf("circuit_breaker 配置不能为负数")
+	}
+	return nil
+}
+
+// moduleConfigExists 判断模块下是否存在指定名称的配置，未知模块不做检查
+func (cfg *Config) moduleConfigExists(module, name string) bool {
+	var exists bool
+	switch module {
+	case "ASR":
+		_, exists = cfg.ASR[name]
+	case "TTS":
+		_, exists = cfg.TTS[name]
+	case "LLM":
+		_, exists = cfg.LLM[name]
+	case "VLLLM":
+		_, exists = cfg.VLLLM[name]
+	case "Memory":
+		_, exists = cfg.Memory[name]
+	default:
+		exists = true
+	}
+	return exists
+}
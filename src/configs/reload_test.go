@@ -0,0 +1,212 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr bool
+	}{
+		{"valid", func(cfg *Config) {}, false},
+		{"invalid port", func(cfg *Config) { cfg.Server.Port = 70000 }, true},
+		{"missing llm type", func(cfg *Config) { cfg.LLM["OpenAILLM"] = LLMConfig{} }, true},
+		{"unknown selected llm", func(cfg *Config) { cfg.SelectedModule["LLM"] = "NotExist" }, true},
+		{"empty selected module", func(cfg *Config) { cfg.SelectedModule["VLLLM"] = "" }, false},
+		{"unknown selected memory", func(cfg *Config) { cfg.SelectedModule["Memory"] = "sqlite" }, true},
+		{"other selected module", func(cfg *Config) { cfg.SelectedModule["Intent"] = "function_call" }, false},
+		{"valid fallback llm", func(cfg *Config) { cfg.FallbackModule = map[string][]string{"LLM": {"OpenAILLM"}} }, false},
+		{"unknown fallback tts", func(cfg *Config) { cfg.FallbackModule = map[string][]string{"TTS": {"EdgeTTS"}} }, true},
+		{"negative cooldown", func(cfg *Config) { cfg.CircuitBreaker.Cooldown = -1 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				LLM:            map[string]LLMConfig{"OpenAILLM": {Type: "openai"}},
+				SelectedModule: map[string]string{"LLM": "OpenAILLM"},
+			}
+			tt.modify(cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	origin := Cfg
+	defer func() { Cfg = origin }()
+
+	oldCfg := &Config{Roles: []string{"old"}}
+	Cfg = oldCfg
+
+	var gotNew, gotOld *Config
+	OnReload(func(newCfg, oldCfg *Config) {
+		gotNew, gotOld = newCfg, oldCfg
+	})
+
+	invalid := &Config{SelectedModule: map[string]string{"TTS": "NotExist"}}
+	if err := ApplyConfig(invalid); err == nil {
+		t.Fatal("ApplyConfig() should reject invalid config")
+	}
+	if Current() != oldCfg || gotNew != nil {
+		t.Fatal("invalid config should not be applied")
+	}
+
+	newCfg := &Config{Roles: []string{"new"}}
+	if err := ApplyConfig(newCfg); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	if Current() != newCfg || gotNew != newCfg || gotOld != oldCfg {
+		t.Errorf("reload handler got (%p, %p), want (%p, %p)", gotNew, gotOld, newCfg, oldCfg)
+	}
+	if oldCfg.Roles[0] != "old" {
+		t.Errorf("old config should not be modified")
+	}
+}
+
+func TestModuleChain(t *testing.T) {
+	cfg := &Config{
+		SelectedModule: map[string]string{"TTS": "DoubaoTTS", "LLM": ""},
+		FallbackModule: map[string][]string{
+			"TTS": {"EdgeTTS", "DoubaoTTS", "", "EdgeTTS"},
+			"LLM": {"OllamaLLM"},
+		},
+	}
+	tests := []struct {
+		module string
+		want   []string
+	}{
+		{"TTS", []string{"DoubaoTTS", "EdgeTTS"}},
+		{"LLM", []string{"OllamaLLM"}},
+		{"ASR", nil},
+	}
+	for _, tt := range tests {
+		got := cfg.ModuleChain(tt.module)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ModuleChain(%s) = %v, want %v", tt.module, got, tt.want)
+		}
+	}
+}
+
+// memoryConfigDB 内存中的ConfigDBInterface实现
+type memoryConfigDB struct {
+	stored *models.ServerConfig
+}
+
+func (m *memoryConfigDB) GetDB() *gorm.DB { return nil }
+
+func (m *memoryConfigDB) ImportServerConfig(cfgStr, fileHash string) error {
+	m.stored = &models.ServerConfig{CfgStr: cfgStr, FileHash: fileHash}
+	return nil
+}
+
+func (m *memoryConfigDB) UpdateServerConfig(cfgStr string) error {
+	m.stored.CfgStr = cfgStr
+	m.stored.Edited = true
+	return nil
+}
+
+func (m *memoryConfigDB) LoadServerConfig() (*models.ServerConfig, error) {
+	if m.stored == nil {
+		return nil, nil
+	}
+	stored := *m.stored
+	return &stored, nil
+}
+
+func writeConfigFile(t *testing.T, port int) {
+	t.Helper()
+	data := fmt.Sprintf("server:\n  port: %d\nweb:\n  port: 8080\n", port)
+	if err := os.WriteFile("config.yaml", []byte(data), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+}
+
+func TestLoadConfigKeepsDatabaseEdits(t *testing.T) {
+	origin := Cfg
+	defer func() { Cfg = origin }()
+	t.Chdir(t.TempDir())
+
+	db := &memoryConfigDB{}
+	writeConfigFile(t, 8000)
+	config, source, err := LoadConfig(db)
+	if err != nil || config.Server.Port != 8000 || source != "config.yaml" {
+		t.Fatalf("首次LoadConfig() = %d, %s, %v", config.Server.Port, source, err)
+	}
+
+	// 通过/api/cfg修改后重启，修改不应被配置文件覆盖
+	edited := *config
+	edited.Server.Port = 9000
+	db.UpdateServerConfig(edited.ToString())
+	config, source, err = LoadConfig(db)
+	if err != nil || config.Server.Port != 9000 || source != dbConfigSource {
+		t.Errorf("重启后LoadConfig() = %d, %s, %v, want 9000 from database", config.Server.Port, source, err)
+	}
+
+	// 配置文件也修改过时以数据库为准
+	writeConfigFile(t, 7000)
+	if config, _, err := LoadConfig(db); err != nil || config.Server.Port != 9000 {
+		t.Errorf("配置冲突时LoadConfig() = %d, %v, want 9000", config.Server.Port, err)
+	}
+
+	// 数据库中的配置未修改过时，导入修改后的配置文件
+	db = &memoryConfigDB{}
+	writeConfigFile(t, 8000)
+	LoadConfig(db)
+	writeConfigFile(t, 8100)
+	if config, _, err := LoadConfig(db); err != nil || config.Server.Port != 8100 {
+		t.Errorf("配置文件修改后LoadConfig() = %d, %v, want 8100", config.Server.Port, err)
+	}
+}
+
+func TestReloadConfigPrecedence(t *testing.T) {
+	origin := Cfg
+	defer func() { Cfg = origin }()
+	t.Chdir(t.TempDir())
+
+	db := &memoryConfigDB{}
+	writeConfigFile(t, 8000)
+	if _, _, err := LoadConfig(db); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	// 未通过/api/cfg修改时，配置文件的修改重新导入并生效
+	writeConfigFile(t, 8100)
+	config, _, err := ReloadConfig(db)
+	if err != nil || config.Server.Port != 8100 || Current().Server.Port != 8100 {
+		t.Fatalf("ReloadConfig() = %v, %v, want 8100", config, err)
+	}
+
+	// 通过/api/cfg修改后，配置文件内容未变化时保持修改
+	edited := *Current()
+	edited.Server.Port = 9000
+	db.UpdateServerConfig(edited.ToString())
+	if err := ApplyConfig(&edited); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	if config, _, err := ReloadConfig(db); err != nil || config.Server.Port != 9000 {
+		t.Errorf("配置文件未变化时ReloadConfig() = %v, %v, want 9000", config, err)
+	}
+
+	// 配置文件也修改时拒绝，数据库和当前配置不变
+	writeConfigFile(t, 7000)
+	if _, _, err := ReloadConfig(db); !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("配置冲突时ReloadConfig() error = %v, want ErrConfigConflict", err)
+	}
+	stored, _ := db.LoadServerConfig()
+	if Current().Server.Port != 9000 || !strings.Contains(stored.CfgStr, "9000") {
+		t.Errorf("配置冲突时不应覆盖通过/api/cfg保存的配置")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"xiaozhi-server-go/src/configs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue 敏感字段脱敏后的占位值，提交时原样带回表示保持不变
+const redactedValue = "******"
+
+// isSecretKey 判断配置项是否为敏感字段
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	switch {
+	case key == "token", key == "password":
+		return true
+	case strings.HasSuffix(key, "_token"):
+		return true
+	case strings.Contains(key, "api_key"), strings.Contains(key, "secret"), strings.Contains(key, "private_key"):
+		return true
+	}
+	return false
+}
+
+// configToMap 将配置转换为以yaml字段名为键的map，与config.yaml结构保持一致
+func configToMap(config *configs.Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mapToConfig 将map转换回配置结构
+func mapToConfig(m map[string]interface{}) (*configs.Config, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	config := &configs.Config{}
+	if err := config.FromString(string(data)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// redact 递归脱敏，返回新的值
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if s, ok := item.(string); ok && isSecretKey(key) && s != "" {
+				result[key] = redactedValue
+			} else {
+				result[key] = redact(item)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redact(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// merge 将patch合并到base：对象递归合并，其他类型直接替换，值为null表示删除该项。
+// 敏感字段提交脱敏占位值时保留原值。
+func merge(base, patch map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(base, key)
+			continue
+		}
+		if s, ok := value.(string); ok && s == redactedValue && isSecretKey(key) {
+			continue
+		}
+		if patchMap, ok := value.(map[string]interface{}); ok {
+			baseMap, _ := base[key].(map[string]interface{})
+			base[key] = merge(baseMap, patchMap)
+			continue
+		}
+		base[key] = restoreSecrets(value, base[key])
+	}
+	return base
+}
+
+// restoreSecrets 整体替换数组时，按下标保留数组元素中被脱敏的敏感字段
+func restoreSecrets(value, old interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	oldList, _ := old.([]interface{})
+	for i, item := range list {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok || i >= len(oldList) {
+			continue
+		}
+		oldMap, _ := oldList[i].(map[string]interface{})
+		for key, v := range itemMap {
+			if s, ok := v.(string); ok && s == redactedValue && isSecretKey(key) {
+				itemMap[key] = oldMap[key]
+			}
+		}
+	}
+	return list
+}
+
+// normalizeJSON 解析请求体，整数保持为int，避免写入配置后变成浮点数
+func normalizeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(value), nil
+}
+
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return value
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"xiaozhi-server-go/src/configs"
+)
+
+func TestRedactAndMerge(t *testing.T) {
+	config := &configs.Config{
+		LLM: map[string]configs.LLMConfig{
+			"OpenAILLM": {Type: "openai", APIKey: "sk-secret", MaxTokens: 500},
+		},
+		SelectedModule: map[string]string{"LLM": "OpenAILLM"},
+	}
+	config.Server.Token = "server-token"
+
+	m, err := configToMap(config)
+	if err != nil {
+		t.Fatalf("configToMap() error = %v", err)
+	}
+	redacted := redact(m).(map[string]interface{})
+	llm := redacted["LLM"].(map[string]interface{})["OpenAILLM"].(map[string]interface{})
+	if llm["api_key"] != redactedValue {
+		t.Errorf("api_key 未脱敏: %v", llm["api_key"])
+	}
+	if llm["max_tokens"] != 500 {
+		t.Errorf("max_tokens 不应脱敏: %v", llm["max_tokens"])
+	}
+	if redacted["server"].(map[string]interface{})["token"] != redactedValue {
+		t.Errorf("server.token 未脱敏")
+	}
+
+	// 提交脱敏后的值应保留原密钥，其余字段正常更新
+	patch, err := normalizeJSON([]byte(`{"LLM":{"OpenAILLM":{"api_key":"******","max_tokens":1000}}}`))
+	if err != nil {
+		t.Fatalf("normalizeJSON() error = %v", err)
+	}
+	newConfig, err := mapToConfig(merge(m, patch.(map[string]interface{})))
+	if err != nil {
+		t.Fatalf("mapToConfig() error = %v", err)
+	}
+	if got := newConfig.LLM["OpenAILLM"]; got.APIKey != "sk-secret" || got.MaxTokens != 1000 {
+		t.Errorf("合并结果错误: %+v", got)
+	}
+	if err := newConfig.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	newConfig.SelectedModule["LLM"] = "Missing"
+	if err := newConfig.Validate(); err == nil {
+		t.Errorf("引用不存在的模块应校验失败")
+	}
+}
@@ -2,55 +2,289 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 可单独编辑的模块配置段：URL路径 -> 配置中的键
+var moduleSections = map[string]string{
+	"asr":    "ASR",
+	"tts":    "TTS",
+	"llm":    "LLM",
+	"vlllm":  "VLLLM",
+	"memory": "Memory",
+}
+
+// CfgResponse 配置接口统一响应
+type CfgResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
 type DefaultCfgService struct {
 	logger *utils.Logger
 	config *configs.Config
+	dbi    configs.ConfigDBInterface
+	mu     sync.Mutex   // 串行化配置修改
+	cfgMu  sync.RWMutex // 保护config指针，配置重载后指向新配置
 }
 
 // NewDefaultCfgService 构造函数
-func NewDefaultCfgService(config *configs.Config, logger *utils.Logger) (*DefaultCfgService, error) {
+func NewDefaultCfgService(config *configs.Config, logger *utils.Logger, dbi configs.ConfigDBInterface) (*DefaultCfgService, error) {
 	service := &DefaultCfgService{
 		logger: logger,
 		config: config,
+		dbi:    dbi,
 	}
 
+	configs.OnReload(func(newCfg, oldCfg *configs.Config) {
+		service.cfgMu.Lock()
+		service.config = newCfg
+		service.cfgMu.Unlock()
+	})
+
 	return service, nil
 }
 
 // Start 实现 CfgService 接口，注册所有 Cfg 相关路由
 func (s *DefaultCfgService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/cfg", auth.AdminAuthMiddleware())
+
+	group.GET("", s.handleGet)
+	group.POST("", s.handlePost)
+	group.OPTIONS("", s.handleOptions)
 
-	apiGroup.GET("/cfg", s.handleGet)
-	apiGroup.POST("/cfg", s.handlePost)
-	apiGroup.OPTIONS("/cfg", s.handleOptions)
+	for path, section := range moduleSections {
+		group.GET("/"+path, s.handleGetSection(section))
+		group.PUT("/"+path+"/:name", s.handlePutModule(section))
+		group.DELETE("/"+path+"/:name", s.handleDeleteModule(section))
+	}
+
+	group.GET("/selected_module", s.handleGetSection("selected_module"))
+	group.POST("/selected_module", s.handlePostModuleMap("selected_module"))
+	group.GET("/fallback_module", s.handleGetSection("fallback_module"))
+	group.POST("/fallback_module", s.handlePostModuleMap("fallback_module"))
+	group.GET("/roles", s.handleGetSection("roles"))
+	group.POST("/roles", s.handlePostRoles)
 
 	s.logger.Info("Cfg HTTP服务路由注册完成")
 	return nil
 }
 
+// handleGet 获取完整配置（敏感字段已脱敏）
+// @Summary 获取服务器配置
+// @Description 返回当前配置，api_key、token等敏感字段以******代替
+// @Tags Config
+// @Produce json
+// @Success 200 {object} CfgResponse
+// @Router /cfg [get]
 func (s *DefaultCfgService) handleGet(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"status":  "ok",
-		"message": "Cfg service is running",
-	})
+	m, err := configToMap(s.currentConfig())
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, CfgResponse{Success: true, Data: redact(m)})
 }
 
+// handlePost 部分更新配置
+// @Summary 更新服务器配置
+// @Description 提交需要修改的配置项（与config.yaml结构一致），对象递归合并，null表示删除；敏感字段提交******表示保持不变
+// @Tags Config
+// @Accept json
+// @Produce json
+// @Param body body object true "需要修改的配置项"
+// @Success 200 {object} CfgResponse
+// @Failure 400 {object} CfgResponse
+// @Router /cfg [post]
 func (s *DefaultCfgService) handlePost(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"status":  "ok",
-		"message": "Cfg service is running",
+	patch, ok := s.bindObject(c)
+	if !ok {
+		return
+	}
+	s.update(c, "", func(m map[string]interface{}) error {
+		merge(m, patch)
+		return nil
+	})
+}
+
+// handleGetSection 获取单个配置段
+func (s *DefaultCfgService) handleGetSection(section string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := configToMap(s.currentConfig())
+		if err != nil {
+			s.respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, CfgResponse{Success: true, Data: redact(m[section])})
+	}
+}
+
+// handlePutModule 新增或更新某个模块配置，如 PUT /api/cfg/llm/OpenAILLM
+func (s *DefaultCfgService) handlePutModule(section string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		patch, ok := s.bindObject(c)
+		if !ok {
+			return
+		}
+		s.update(c, section, func(m map[string]interface{}) error {
+			modules, _ := m[section].(map[string]interface{})
+			m[section] = merge(modules, map[string]interface{}{name: patch})
+			return nil
+		})
+	}
+}
+
+// handleDeleteModule 删除某个模块配置，正在被selected_module或fallback_module使用时拒绝删除
+func (s *DefaultCfgService) handleDeleteModule(section string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		s.update(c, section, func(m map[string]interface{}) error {
+			modules, _ := m[section].(map[string]interface{})
+			if _, ok := modules[name]; !ok {
+				return fmt.Errorf("%s.%s 不存在", section, name)
+			}
+			delete(modules, name)
+			return nil
+		})
+	}
+}
+
+// handlePostModuleMap 修改选择的模块或备用模块，如 {"LLM": "OpenAILLM"}、{"TTS": ["EdgeTTS"]}
+func (s *DefaultCfgService) handlePostModuleMap(section string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		patch, ok := s.bindObject(c)
+		if !ok {
+			return
+		}
+		s.update(c, section, func(m map[string]interface{}) error {
+			modules, _ := m[section].(map[string]interface{})
+			m[section] = merge(modules, patch)
+			return nil
+		})
+	}
+}
+
+// handlePostRoles 替换角色列表，请求体为字符串数组
+func (s *DefaultCfgService) handlePostRoles(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	value, err := normalizeJSON(body)
+	list, ok := value.([]interface{})
+	if err != nil || !ok {
+		s.respondError(c, http.StatusBadRequest, "请求体必须是字符串数组")
+		return
+	}
+	for _, item := range list {
+		if role, ok := item.(string); !ok || strings.TrimSpace(role) == "" {
+			s.respondError(c, http.StatusBadRequest, "角色不能为空")
+			return
+		}
+	}
+	s.update(c, "roles", func(m map[string]interface{}) error {
+		m["roles"] = list
+		return nil
 	})
 }
 
+// update 在当前配置的副本上执行修改，校验通过后持久化到数据库并应用到内存配置
+// section不为空时只返回对应配置段
+func (s *DefaultCfgService) update(c *gin.Context, section string, apply func(m map[string]interface{}) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := configToMap(s.currentConfig())
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := apply(m); err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	newConfig, err := mapToConfig(m)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, fmt.Sprintf("配置格式错误: %v", err))
+		return
+	}
+	if err := newConfig.Validate(); err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.dbi != nil {
+		if err := s.dbi.UpdateServerConfig(newConfig.ToString()); err != nil {
+			s.logger.Error("保存配置到数据库失败: %v", err)
+			s.respondError(c, http.StatusInternalServerError, fmt.Sprintf("保存配置失败: %v", err))
+			return
+		}
+	}
+	// 应用新配置，资源池按需重建，新会话使用新配置
+	if err := configs.ApplyConfig(newConfig); err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("配置已更新: section=%s, client=%s", sectionName(section), c.ClientIP())
+
+	result, _ := configToMap(newConfig)
+	if section != "" {
+		c.JSON(http.StatusOK, CfgResponse{Success: true, Data: redact(result[section])})
+		return
+	}
+	c.JSON(http.StatusOK, CfgResponse{Success: true, Data: redact(result)})
+}
+
+// bindObject 解析JSON对象请求体
+func (s *DefaultCfgService) bindObject(c *gin.Context) (map[string]interface{}, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	value, err := normalizeJSON(body)
+	obj, ok := value.(map[string]interface{})
+	if err != nil || !ok {
+		s.respondError(c, http.StatusBadRequest, "请求体必须是JSON对象")
+		return nil, false
+	}
+	return obj, true
+}
+
+// currentConfig 获取当前配置
+func (s *DefaultCfgService) currentConfig() *configs.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.config
+}
+
+func (s *DefaultCfgService) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, CfgResponse{Success: false, Message: message})
+}
+
 func (s *DefaultCfgService) handleOptions(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Content-Type")
+	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	c.Status(204) // No Content
 }
+
+func sectionName(section string) string {
+	if section == "" {
+		return "all"
+	}
+	return section
+}
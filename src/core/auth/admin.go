@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"xiaozhi-server-go/src/configs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// placeholderTokens 配置模板中的示例token，未修改时拒绝所有管理请求
+var placeholderTokens = map[string]bool{
+	"":           true,
+	"你的token":    true,
+	"your_token": true,
+}
+
+// IsPlaceholderToken server.token是否未配置或仍为示例值，此时不能用于管理接口认证和签发设备token
+func IsPlaceholderToken(token string) bool {
+	return placeholderTokens[token]
+}
+
+// AdminAuthMiddleware 管理接口认证中间件
+// 请求须携带 Authorization: Bearer <server.token>，与是否启用设备认证（server.auth）无关，始终以当前生效的配置为准；
+// server.token 未配置或仍为示例值时拒绝所有管理请求
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		config := configs.Current()
+		if config == nil || IsPlaceholderToken(config.Server.Token) {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"message": "未配置server.token，管理接口不可用",
+			})
+			return
+		}
+		token := TokenFromRequest(c.Request)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.Server.Token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无效的管理token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xiaozhi-server-go/src/configs"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	origin := configs.Cfg
+	defer func() { configs.Cfg = origin }()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin", AdminAuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		serverToken string
+		auth        string
+		expected    int
+	}{
+		{"示例token拒绝所有请求", "你的token", "Bearer 你的token", http.StatusServiceUnavailable},
+		{"未配置token", "", "", http.StatusServiceUnavailable},
+		{"缺少token", "secret", "", http.StatusUnauthorized},
+		{"错误token", "secret", "Bearer secreT", http.StatusUnauthorized},
+		{"正确token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 未启用设备认证时管理接口同样需要token
+			configs.Cfg = &configs.Config{}
+			configs.Cfg.Server.Token = tt.serverToken
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("status = %d, 期望 %d", w.Code, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+)
+
+// 握手认证失败原因
+var (
+	ErrMissingToken   = errors.New("缺少认证token")
+	ErrInvalidToken   = errors.New("无效的认证token或token已过期")
+	ErrDeviceMismatch = errors.New("token与设备ID不匹配")
+	ErrNotActivated   = errors.New("设备未激活，请使用激活码绑定用户")
+	// ErrActivationUnknown 查询激活状态失败，包装了数据库错误，不应原样返回给设备
+	ErrActivationUnknown = errors.New("无法确认设备激活状态")
+)
+
+// HandshakeVerifier 连接握手认证器
+// 依次检查设备白名单、配置的静态token和AuthToken签发的JWT，通过的设备还须已激活；
+// 设备ID由客户端提供，白名单只免除token，不免除激活检查
+type HandshakeVerifier struct {
+	tokens         map[string]struct{}
+	allowedDevices map[string]struct{}
+	authToken      *AuthToken
+	activated      func(deviceID string) (bool, error) // 为nil时不检查激活状态
+}
+
+// NewHandshakeVerifier 根据server.auth配置创建握手认证器
+func NewHandshakeVerifier(config *configs.Config) *HandshakeVerifier {
+	v := &HandshakeVerifier{
+		tokens:         make(map[string]struct{}),
+		allowedDevices: make(map[string]struct{}),
+	}
+	for _, t := range config.Server.Auth.Tokens {
+		if t.Token != "" {
+			v.tokens[t.Token] = struct{}{}
+		}
+	}
+	for _, d := range config.Server.Auth.AllowedDevices {
+		if d != "" {
+			v.allowedDevices[strings.ToLower(d)] = struct{}{}
+		}
+	}
+	if !IsPlaceholderToken(config.Server.Token) {
+		v.authToken = NewAuthToken(config.Server.Token)
+	}
+	if deviceDB := database.GetDeviceDB(); deviceDB != nil {
+		v.activated = deviceDB.IsActivated
+	}
+	return v
+}
+
+// TokenFromRequest 从Authorization头获取token，没有则从URL参数token/authorization获取
+func TokenFromRequest(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		query := r.URL.Query()
+		token = query.Get("token")
+		if token == "" {
+			token = query.Get("authorization")
+		}
+	}
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// Verify 校验握手请求，返回应答的HTTP状态码和失败原因，通过时返回http.StatusOK
+func (v *HandshakeVerifier) Verify(token, deviceID string) (int, error) {
+	// 白名单中的设备无需token
+	if _, ok := v.allowedDevices[strings.ToLower(deviceID)]; ok && deviceID != "" {
+		return v.verifyActivated(deviceID)
+	}
+
+	if token == "" {
+		return http.StatusUnauthorized, ErrMissingToken
+	}
+
+	if _, ok := v.tokens[token]; ok {
+		return v.verifyActivated(deviceID)
+	}
+
+	if v.authToken != nil {
+		if valid, tokenDeviceID, err := v.authToken.VerifyToken(token); err == nil && valid {
+			if deviceID == "" {
+				// 未携带设备ID时按token签发的设备检查激活状态
+				return v.verifyActivated(tokenDeviceID)
+			}
+			if !strings.EqualFold(tokenDeviceID, deviceID) {
+				return http.StatusForbidden, ErrDeviceMismatch
+			}
+			return v.verifyActivated(deviceID)
+		}
+	}
+
+	return http.StatusUnauthorized, ErrInvalidToken
+}
+
+// verifyActivated 检查设备是否已通过激活码绑定用户，查询失败时拒绝连接，避免未激活设备趁数据库故障接入
+func (v *HandshakeVerifier) verifyActivated(deviceID string) (int, error) {
+	if v.activated == nil {
+		return http.StatusOK, nil
+	}
+	activated, err := v.activated(deviceID)
+	if err != nil {
+		return http.StatusServiceUnavailable, fmt.Errorf("%w: %v", ErrActivationUnknown, err)
+	}
+	if activated {
+		return http.StatusOK, nil
+	}
+	return http.StatusForbidden, ErrNotActivated
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"xiaozhi-server-go/src/configs"
+)
+
+func TestHandshakeVerifier(t *testing.T) {
+	config := &configs.Config{}
+	config.Server.Token = "secret"
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: "static-token"}}
+	config.Server.Auth.AllowedDevices = []string{"AA:BB:CC:DD:EE:FF"}
+	verifier := NewHandshakeVerifier(config)
+
+	jwt, err := NewAuthToken("secret").GenerateToken("11:22:33:44:55:66")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		deviceID string
+		expected int
+	}{
+		{"白名单设备", "", "aa:bb:cc:dd:ee:ff", http.StatusOK},
+		{"缺少token", "", "11:22:33:44:55:66", http.StatusUnauthorized},
+		{"静态token", "static-token", "11:22:33:44:55:66", http.StatusOK},
+		{"JWT设备匹配", jwt, "11:22:33:44:55:66", http.StatusOK},
+		{"JWT设备不匹配", jwt, "66:55:44:33:22:11", http.StatusForbidden},
+		{"无效token", "bad-token", "11:22:33:44:55:66", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := verifier.Verify(tt.token, tt.deviceID); status != tt.expected {
+				t.Errorf("Verify() = %d, 期望 %d", status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHandshakeVerifierActivation(t *testing.T) {
+	config := &configs.Config{}
+	config.Server.Token = "secret"
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: "static-token"}}
+	config.Server.Auth.AllowedDevices = []string{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:00"}
+	verifier := NewHandshakeVerifier(config)
+	verifier.activated = func(deviceID string) (bool, error) {
+		switch deviceID {
+		case "11:22:33:44:55:66", "aa:bb:cc:dd:ee:00":
+			return true, nil
+		case "db-error":
+			return false, errors.New("数据库不可用")
+		}
+		return false, nil
+	}
+	activatedJWT, _ := NewAuthToken("secret").GenerateToken("11:22:33:44:55:66")
+	inactiveJWT, _ := NewAuthToken("secret").GenerateToken("66:55:44:33:22:11")
+
+	tests := []struct {
+		name     string
+		token    string
+		deviceID string
+		expected int
+	}{
+		{"已激活设备", "static-token", "11:22:33:44:55:66", http.StatusOK},
+		{"未激活设备", "static-token", "66:55:44:33:22:11", http.StatusForbidden},
+		{"白名单设备无需token", "", "aa:bb:cc:dd:ee:00", http.StatusOK},
+		{"白名单设备仍须激活", "", "aa:bb:cc:dd:ee:ff", http.StatusForbidden},
+		{"JWT未带设备ID按签发的设备检查激活", activatedJWT, "", http.StatusOK},
+		{"JWT未带设备ID且签发的设备未激活", inactiveJWT, "", http.StatusForbidden},
+		{"未激活设备token无效", "bad-token", "66:55:44:33:22:11", http.StatusUnauthorized},
+		{"查询激活状态失败时拒绝", "static-token", "db-error", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := verifier.Verify(tt.token, tt.deviceID); status != tt.expected {
+				t.Errorf("Verify() = %d, 期望 %d", status, tt.expected)
+			}
+		})
+	}
+	if _, err := verifier.Verify("static-token", "db-error"); !errors.Is(err, ErrActivationUnknown) {
+		t.Errorf("Verify() 查询失败时错误 = %v, 期望 ErrActivationUnknown", err)
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		header   string
+		expected string
+	}{
+		{"Bearer头", "/", "Bearer abc", "abc"},
+		{"URL参数", "/?token=def", "", "def"},
+		{"URL参数带Bearer", "/?authorization=Bearer%20ghi", "", "ghi"},
+		{"头优先", "/?token=def", "Bearer abc", "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := TokenFromRequest(r); got != tt.expected {
+				t.Errorf("TokenFromRequest() = %q, 期望 %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -24,7 +24,12 @@ func NewAuthToken(secretKey string) *AuthToken {
 
 func (at *AuthToken) GenerateToken(deviceID string) (string, error) {
 	// 设置过期时间为1小时后
-	expireTime := time.Now().Add(time.Hour)
+	return at.GenerateTokenWithTTL(deviceID, time.Hour)
+}
+
+// GenerateTokenWithTTL 签发指定有效期的设备token
+func (at *AuthToken) GenerateTokenWithTTL(deviceID string, ttl time.Duration) (string, error) {
+	expireTime := time.Now().Add(ttl)
 
 	// 创建claims
 	claims := jwt.MapClaims{
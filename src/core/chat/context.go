@@ -0,0 +1,258 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+// 上下文预算单位
+const (
+	UnitTokens = "tokens"
+	UnitChars  = "chars"
+)
+
+// 超出上下文预算时的处理策略
+const (
+	StrategyTruncate  = "truncate"  // 丢弃较早的对话
+	StrategySummarize = "summarize" // 将较早的对话总结为一条系统消息
+)
+
+const (
+	messageTokenOverhead = 4 // 每条消息的角色、分隔符等固定开销
+	summaryTimeout       = 30 * time.Second
+	summaryPrompt        = `你是对话摘要助手。请将下面的对话（可能包含之前的摘要）压缩为一段简洁的摘要，
+保留用户的需求、偏好、已确认的事实和未完成的事项，省略寒暄和重复内容。
+直接输出摘要内容，不超过200字。`
+)
+
+// ContextBudget 对话上下文预算
+type ContextBudget struct {
+	Limit    int    // 预算，0表示不限制
+	Unit     string // UnitTokens或UnitChars
+	Strategy string // StrategyTruncate或StrategySummarize
+}
+
+// Summarizer 将较早的对话总结为摘要，previous为之前的摘要
+type Summarizer func(previous string, dialogue []Message) (string, error)
+
+// NewLLMSummarizer 使用LLM总结对话
+func NewLLMSummarizer(llm types.LLMProvider, sessionID string) Summarizer {
+	return func(previous string, dialogue []Message) (string, error) {
+		var sb strings.Builder
+		if previous != "" {
+			sb.WriteString("之前的摘要: ")
+			sb.WriteString(previous)
+			sb.WriteString("\n")
+		}
+		for _, msg := range dialogue {
+			if msg.Content == "" {
+				continue
+			}
+			switch msg.Role {
+			case "user":
+				sb.WriteString("用户: ")
+			case "assistant":
+				sb.WriteString("助手: ")
+			case "tool":
+				sb.WriteString("工具结果: ")
+			default:
+				continue
+			}
+			sb.WriteString(msg.Content)
+			sb.WriteString("\n")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		defer cancel()
+		responses, err := llm.Response(ctx, "summary-"+sessionID, []types.Message{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: sb.String()},
+		})
+		if err != nil {
+			return "", err
+		}
+		var result strings.Builder
+		for content := range responses {
+			result.WriteString(content)
+		}
+		summary := strings.TrimSpace(result.String())
+		if strings.Contains(summary, "服务响应异常") {
+			return "", fmt.Errorf("%s", summary)
+		}
+		return summary, nil
+	}
+}
+
+// SetContextBudget 设置上下文预算，summarizer为nil时总结策略退化为丢弃
+func (dm *DialogueManager) SetContextBudget(budget ContextBudget, summarizer Summarizer) {
+	if budget.Unit == "" {
+		budget.Unit = UnitTokens
+	}
+	if budget.Strategy == "" {
+		budget.Strategy = StrategyTruncate
+	}
+	dm.budget = budget
+	dm.summarizer = summarizer
+}
+
+// Summary 返回较早对话的摘要
+func (dm *DialogueManager) Summary() string {
+	dm.summaryMu.Lock()
+	defer dm.summaryMu.Unlock()
+	return dm.summary
+}
+
+// SetSummary 设置较早对话的摘要，用于恢复对话历史
+func (dm *DialogueManager) SetSummary(summary string) {
+	dm.summaryMu.Lock()
+	defer dm.summaryMu.Unlock()
+	dm.summary = summary
+}
+
+// WaitSummary 等待后台总结完成，会话关闭时在保存对话和归还LLM之前调用
+func (dm *DialogueManager) WaitSummary() {
+	dm.summaryMu.Lock()
+	done := dm.summaryDone
+	dm.summaryMu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// fitContextBudget 对话超出预算时从最早的一轮开始丢弃，直到满足预算。
+// 以user消息划分轮次，assistant的tool_calls和对应的tool消息总在同一轮内，不会被拆开；
+// 系统提示词和最近一轮始终保留。extra为额外注入的内容（如记忆），计入预算。
+// 总结策略下，丢弃的对话在后台合并到摘要中，从下一轮开始生效，不增加本轮的响应延迟。
+func (dm *DialogueManager) fitContextBudget(extra string) {
+	if dm.budget.Limit <= 0 {
+		return
+	}
+	summary := dm.Summary()
+
+	dm.mu.Lock()
+	start := 0
+	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
+		start = 1
+	}
+	turns := splitTurns(dm.dialogue[start:])
+	if len(turns) <= 1 {
+		dm.mu.Unlock()
+		return
+	}
+
+	used := dm.cost(Message{Content: extra}) + dm.cost(Message{Content: summary})
+	for _, msg := range dm.dialogue {
+		used += dm.cost(msg)
+	}
+	if used <= dm.budget.Limit {
+		dm.mu.Unlock()
+		return
+	}
+
+	drop := 0
+	for _, turn := range turns[:len(turns)-1] {
+		if used <= dm.budget.Limit {
+			break
+		}
+		for _, msg := range turn {
+			used -= dm.cost(msg)
+		}
+		drop += len(turn)
+	}
+
+	dropped := make([]Message, drop)
+	copy(dropped, dm.dialogue[start:start+drop])
+	dm.dialogue = append(dm.dialogue[:start], dm.dialogue[start+drop:]...)
+	dm.mu.Unlock()
+	if used > dm.budget.Limit {
+		dm.logger.Warn("最近一轮对话已超出上下文预算: %d > %d %s", used, dm.budget.Limit, dm.budget.Unit)
+	}
+
+	if dm.budget.Strategy == StrategySummarize && dm.summarizer != nil {
+		dm.summarizeAsync(dropped)
+	} else {
+		dm.logger.Info("对话超出上下文预算，丢弃较早的%d条消息", len(dropped))
+	}
+}
+
+// summarizeAsync 将丢弃的对话加入待总结队列，没有进行中的总结时启动后台总结
+func (dm *DialogueManager) summarizeAsync(dropped []Message) {
+	dm.summaryMu.Lock()
+	defer dm.summaryMu.Unlock()
+	dm.pending = append(dm.pending, dropped...)
+	if dm.summaryDone != nil {
+		return
+	}
+	dm.summaryDone = make(chan struct{})
+	go dm.summarizePending(dm.summaryDone)
+}
+
+// summarizePending 按丢弃的顺序将待总结的对话合并到摘要，直到队列为空
+func (dm *DialogueManager) summarizePending(done chan struct{}) {
+	defer close(done)
+	for {
+		dm.summaryMu.Lock()
+		dropped, previous := dm.pending, dm.summary
+		dm.pending = nil
+		if len(dropped) == 0 {
+			dm.summaryDone = nil
+			dm.summaryMu.Unlock()
+			return
+		}
+		dm.summaryMu.Unlock()
+
+		summary, err := dm.summarizer(previous, dropped)
+		if err != nil {
+			dm.logger.Error("总结较早的对话失败: %v", err)
+			continue
+		}
+		dm.SetSummary(summary)
+		dm.logger.Info("已将较早的%d条消息总结为摘要: %s", len(dropped), summary)
+	}
+}
+
+// splitTurns 按user消息将对话划分为轮次
+func splitTurns(dialogue []Message) [][]Message {
+	var turns [][]Message
+	for i, msg := range dialogue {
+		if i == 0 || msg.Role == "user" {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return turns
+}
+
+// cost 按预算单位计算消息的大小
+func (dm *DialogueManager) cost(msg Message) int {
+	text := msg.Content
+	for _, tc := range msg.ToolCalls {
+		text += tc.Function.Name + tc.Function.Arguments
+	}
+	if text == "" {
+		return 0
+	}
+	if dm.budget.Unit == UnitChars {
+		return utf8.RuneCountInString(text)
+	}
+	return EstimateTokens(text) + messageTokenOverhead
+}
+
+// EstimateTokens 粗略估算文本的token数：中日韩字符按每字1个，其他字符按每4个1个
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || (unicode.IsPunct(r) && r > unicode.MaxASCII) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
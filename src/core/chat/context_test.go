@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+func TestFitContextBudget(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	// 每条消息10个字符
+	text := func(s string) string { return s + strings.Repeat("。", 10-len([]rune(s))) }
+	dialogue := []Message{
+		{Role: "system", Content: text("你是小智")},
+		{Role: "user", Content: text("天气")},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "1", Function: types.FunctionCall{Name: "weather", Arguments: "{}"}}}}, // 9个字符
+		{Role: "tool", ToolCallID: "1", Content: text("晴")},
+		{Role: "assistant", Content: text("今天晴")},
+		{Role: "user", Content: text("讲个笑话")},
+		{Role: "assistant", Content: text("好的")},
+		{Role: "user", Content: text("再见")},
+	}
+
+	tests := []struct {
+		name        string
+		budget      int
+		memory      string
+		wantRoles   []string
+		wantSummary bool
+	}{
+		{name: "未超出预算", budget: 100, wantRoles: []string{"system", "user", "assistant", "tool", "assistant", "user", "assistant", "user"}},
+		{name: "工具调用与结果一起丢弃", budget: 40, wantRoles: []string{"system", "user", "assistant", "user"}},
+		{name: "记忆计入预算", budget: 40, memory: "用户叫小明", wantRoles: []string{"system", "user"}},
+		{name: "最近一轮始终保留", budget: 5, wantRoles: []string{"system", "user"}},
+		{name: "总结丢弃的对话", budget: 40, wantRoles: []string{"system", "user", "assistant", "user"}, wantSummary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := NewDialogueManager(logger, nil)
+			for _, msg := range dialogue {
+				dm.Put(msg)
+			}
+			summarized := make(chan []Message, 1)
+			strategy := StrategyTruncate
+			if tt.wantSummary {
+				strategy = StrategySummarize
+			}
+			dm.SetContextBudget(ContextBudget{Limit: tt.budget, Unit: UnitChars, Strategy: strategy}, func(previous string, dropped []Message) (string, error) {
+				summarized <- dropped
+				return "用户问过天气", nil
+			})
+
+			dm.fitContextBudget(tt.memory)
+			var roles []string
+			for _, msg := range dm.GetLLMDialogue() {
+				roles = append(roles, msg.Role)
+			}
+			if !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("roles = %v, want %v", roles, tt.wantRoles)
+			}
+
+			if !tt.wantSummary {
+				return
+			}
+			// 总结在后台完成，下一轮生效
+			dm.WaitSummary()
+			select {
+			case dropped := <-summarized:
+				if len(dropped) != 4 || dropped[0].Content != text("天气") {
+					t.Errorf("总结的消息 = %+v", dropped)
+				}
+			default:
+				t.Fatal("没有总结丢弃的对话")
+			}
+			messages := dm.GetLLMDialogueWithMemory("")
+			if messages[0].Role != "system" || messages[1].Content != "之前对话的摘要: 用户问过天气" {
+				t.Errorf("GetLLMDialogueWithMemory() = %+v", messages)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "你好，小智", want: 5},
+		{text: "hello world!", want: 3},
+		{text: "播放music", want: 4},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
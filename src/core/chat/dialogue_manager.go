@@ -2,6 +2,7 @@ package chat
 
 import (
 	"encoding/json"
+	"sync"
 
 	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
@@ -12,8 +13,17 @@ type Message = types.Message
 // DialogueManager 管理对话上下文和历史
 type DialogueManager struct {
 	logger   *utils.Logger
+	mu       sync.RWMutex // 保护dialogue，会话管理接口等会在其他goroutine中读取对话
 	dialogue []Message
+	added    int // 本次会话通过Put新增的消息数，恢复的历史不计入
 	memory   MemoryInterface
+
+	budget      ContextBudget
+	summarizer  Summarizer
+	summaryMu   sync.Mutex    // 保护summary、pending和summaryDone
+	summary     string        // 超出预算被丢弃的对话的摘要
+	pending     []Message     // 等待合并到摘要的对话
+	summaryDone chan struct{} // 后台总结进行中时不为空，总结完成后关闭
 }
 
 // NewDialogueManager 创建对话管理器实例
@@ -29,6 +39,8 @@ func (dm *DialogueManager) SetSystemMessage(systemMessage string) {
 	if systemMessage == "" {
 		return
 	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 
 	// 如果对话中已经有系统消息，则不再添加
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
@@ -44,82 +56,165 @@ func (dm *DialogueManager) SetSystemMessage(systemMessage string) {
 
 // 保留最近的几条对话消息
 func (dm *DialogueManager) KeepRecentMessages(maxMessages int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if maxMessages <= 0 || len(dm.dialogue) <= maxMessages {
 		return
 	}
 	// 保留system消息和最近的 maxMessages 条消息
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
 		// 保留system消息
-		dm.dialogue = append(dm.dialogue[:1], dm.dialogue[len(dm.dialogue)-maxMessages:]...)
+		dm.dialogue = append(dm.dialogue[:1], dropOrphanToolMessages(dm.dialogue[len(dm.dialogue)-maxMessages:])...)
 		return
 	}
 	// 如果没有system消息，直接保留最近的 maxMessages 条消息
 	if len(dm.dialogue) > maxMessages {
-		dm.dialogue = dm.dialogue[len(dm.dialogue)-maxMessages:]
+		dm.dialogue = dropOrphanToolMessages(dm.dialogue[len(dm.dialogue)-maxMessages:])
+	}
+}
+
+// dropOrphanToolMessages 去掉开头缺少对应tool_calls的工具结果消息，避免LLM接口报错
+func dropOrphanToolMessages(messages []Message) []Message {
+	for len(messages) > 0 && messages[0].Role == "tool" {
+		messages = messages[1:]
 	}
+	return messages
 }
 
-// GetRecentMessages 获取最近的对话消息
+// GetRecentMessages 获取最近的对话消息副本
 // 如果 maxMessages <= 0，则返回全部对话消息
 func (dm *DialogueManager) GetRecentMessages(maxMessages int) []Message {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
 	if maxMessages <= 0 || len(dm.dialogue) <= maxMessages {
-		return dm.dialogue
+		return cloneMessages(dm.dialogue)
 	}
 	// 保留system消息和最近的 maxMessages 条消息
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
 		// 保留system消息
 		return append([]Message{dm.dialogue[0]}, dm.dialogue[len(dm.dialogue)-maxMessages:]...)
 	}
-	return dm.dialogue
+	return cloneMessages(dm.dialogue)
 }
 
 // Put 添加新消息到对话
 func (dm *DialogueManager) Put(message Message) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	dm.dialogue = append(dm.dialogue, message)
+	dm.added++
 }
 
 func (dm *DialogueManager) GetLastTwoMessages() []Message {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
 	if len(dm.dialogue) < 2 {
 		return nil
 	}
-	return dm.dialogue[len(dm.dialogue)-2:]
+	return cloneMessages(dm.dialogue[len(dm.dialogue)-2:])
 }
 
-// GetLLMDialogue 获取完整对话历史
+// GetLLMDialogue 获取完整对话历史的副本
 func (dm *DialogueManager) GetLLMDialogue() []Message {
-	return dm.dialogue
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return cloneMessages(dm.dialogue)
 }
 
-// GetLLMDialogueWithMemory 获取带记忆的对话
+// cloneMessages 复制消息切片，调用方修改或追加时不影响对话历史
+func cloneMessages(messages []Message) []Message {
+	return append([]Message(nil), messages...)
+}
+
+// GetLLMDialogueWithMemory 获取带记忆的对话，超出上下文预算时先丢弃或总结较早的对话
 func (dm *DialogueManager) GetLLMDialogueWithMemory(memoryStr string) []Message {
-	if memoryStr == "" {
-		return dm.GetLLMDialogue()
-	}
+	dm.fitContextBudget(memoryStr)
 
-	memoryMsg := Message{
-		Role:    "system",
-		Content: memoryStr,
+	var notes []Message
+	if memoryStr != "" {
+		notes = append(notes, Message{Role: "system", Content: memoryStr})
+	}
+	if summary := dm.Summary(); summary != "" {
+		notes = append(notes, Message{Role: "system", Content: "之前对话的摘要: " + summary})
+	}
+	rest := dm.GetLLMDialogue()
+	if len(notes) == 0 {
+		return rest
 	}
 
-	dialogue := make([]Message, 0, len(dm.dialogue)+1)
-	dialogue = append(dialogue, memoryMsg)
-	dialogue = append(dialogue, dm.dialogue...)
+	// 记忆和摘要放在系统提示词之后，保证系统提示词始终是第一条消息
+	dialogue := make([]Message, 0, len(rest)+len(notes))
+	if len(rest) > 0 && rest[0].Role == "system" {
+		dialogue = append(dialogue, rest[0])
+		rest = rest[1:]
+	}
+	dialogue = append(dialogue, notes...)
+	dialogue = append(dialogue, rest...)
 
 	return dialogue
 }
 
+// QueryMemory 查询与query相关的记忆，未配置记忆时返回空字符串
+func (dm *DialogueManager) QueryMemory(query string) string {
+	if dm.memory == nil {
+		return ""
+	}
+	memoryStr, err := dm.memory.QueryMemory(query)
+	if err != nil {
+		dm.logger.Error("查询记忆失败: %v", err)
+		return ""
+	}
+	return memoryStr
+}
+
+// HasMemory 是否配置了长期记忆
+func (dm *DialogueManager) HasMemory() bool {
+	return dm.memory != nil
+}
+
+// SaveMemory 使用llm将本次会话新增的对话保存到记忆。
+// 从之前会话恢复的历史已在当时保存过，不再重复总结；超出上下文预算被丢弃的消息也不再计入。
+func (dm *DialogueManager) SaveMemory(llm types.LLMProvider) error {
+	if dm.memory == nil {
+		return nil
+	}
+	dm.mu.RLock()
+	start := len(dm.dialogue) - dm.added
+	if start < 0 {
+		start = 0
+	}
+	if start == 0 && len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
+		start = 1
+	}
+	dialogue := cloneMessages(dm.dialogue[start:])
+	dm.mu.RUnlock()
+	if len(dialogue) == 0 {
+		return nil
+	}
+	return dm.memory.SaveMemory(llm, dialogue)
+}
+
 // Clear 清空对话历史
 func (dm *DialogueManager) Clear() {
+	dm.mu.Lock()
 	dm.dialogue = make([]Message, 0)
+	dm.added = 0
+	dm.mu.Unlock()
+	dm.summaryMu.Lock()
+	dm.summary = ""
+	dm.pending = nil
+	dm.summaryMu.Unlock()
 }
 
 func (dm *DialogueManager) Length() int {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
 	return len(dm.dialogue)
 }
 
 // ToJSON 将对话历史转换为JSON字符串
 func (dm *DialogueManager) ToJSON(keepSystemPrompt bool) (string, error) {
-	dialogue := dm.dialogue
+	dialogue := dm.GetLLMDialogue()
 	if !keepSystemPrompt && len(dialogue) > 0 && dialogue[0].Role == "system" {
 		// 如果不保留系统消息，则移除第一条消息
 		dialogue = dialogue[1:]
@@ -133,5 +228,13 @@ func (dm *DialogueManager) ToJSON(keepSystemPrompt bool) (string, error) {
 
 // LoadFromJSON 从JSON字符串加载对话历史
 func (dm *DialogueManager) LoadFromJSON(jsonStr string) error {
-	return json.Unmarshal([]byte(jsonStr), &dm.dialogue)
+	var dialogue []Message
+	if err := json.Unmarshal([]byte(jsonStr), &dialogue); err != nil {
+		return err
+	}
+	dm.mu.Lock()
+	dm.dialogue = dialogue
+	dm.added = 0
+	dm.mu.Unlock()
+	return nil
 }
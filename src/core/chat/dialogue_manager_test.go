@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+// recordMemory 记录SaveMemory收到的对话
+type recordMemory struct {
+	saved [][]Message
+}
+
+func (m *recordMemory) QueryMemory(query string) (string, error) { return "", nil }
+func (m *recordMemory) ClearMemory() error                       { return nil }
+func (m *recordMemory) SaveMemory(llm types.LLMProvider, dialogue []Message) error {
+	m.saved = append(m.saved, dialogue)
+	return nil
+}
+
+func TestSaveMemorySkipsRestoredHistory(t *testing.T) {
+	tests := []struct {
+		name      string
+		restored  string
+		keep      int
+		put       []string
+		wantSaved [][]string
+	}{
+		{name: "没有新对话不保存", restored: `[{"role":"user","content":"旧问题"}]`},
+		{
+			name:      "只保存本次会话新增的消息",
+			restored:  `[{"role":"user","content":"旧问题"},{"role":"assistant","content":"旧回答"}]`,
+			put:       []string{"新问题", "新回答"},
+			wantSaved: [][]string{{"新问题", "新回答"}},
+		},
+		{
+			name:      "新增消息被截断后只保存剩余部分",
+			restored:  `[{"role":"user","content":"旧问题"}]`,
+			keep:      2,
+			put:       []string{"问题一", "回答一", "问题二"},
+			wantSaved: [][]string{{"回答一", "问题二"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := &recordMemory{}
+			dm := NewDialogueManager(nil, memory)
+			if err := dm.LoadFromJSON(tt.restored); err != nil {
+				t.Fatalf("LoadFromJSON() error = %v", err)
+			}
+			dm.SetSystemMessage("你是小智")
+			for _, content := range tt.put {
+				dm.Put(Message{Role: "user", Content: content})
+			}
+			if tt.keep > 0 {
+				dm.KeepRecentMessages(tt.keep)
+			}
+			if err := dm.SaveMemory(nil); err != nil {
+				t.Fatalf("SaveMemory() error = %v", err)
+			}
+
+			var got [][]string
+			for _, dialogue := range memory.saved {
+				var contents []string
+				for _, msg := range dialogue {
+					contents = append(contents, msg.Content)
+				}
+				got = append(got, contents)
+			}
+			if !reflect.DeepEqual(got, tt.wantSaved) {
+				t.Errorf("SaveMemory() 保存 = %v, 期望 %v", got, tt.wantSaved)
+			}
+		})
+	}
+}
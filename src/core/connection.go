@@ -13,17 +13,22 @@ import (
 	"time"
 
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/chat"
 	"xiaozhi-server-go/src/core/function"
 	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/iot"
 	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/metrics"
 	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/memory"
 	"xiaozhi-server-go/src/core/providers/tts"
 	"xiaozhi-server-go/src/core/providers/vlllm"
 	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
 	"xiaozhi-server-go/src/task"
 
 	"github.com/google/uuid"
@@ -53,6 +58,19 @@ type configGetter interface {
 	Config() *tts.Config
 }
 
+// helloParamsProvider 需要在hello响应中附加传输参数的连接（如MQTT+UDP下发UDP地址和密钥）
+type helloParamsProvider interface {
+	HelloParams() map[string]interface{}
+}
+
+// ttsStream 正在进行的流式语音合成
+type ttsStream struct {
+	chunks   <-chan providers.AudioChunk
+	cancel   context.CancelFunc
+	start    time.Time             // 开始合成的时间
+	provider providers.TTSProvider // 合成使用的提供者，失败时用于切换
+}
+
 // ConnectionHandler 连接处理器结构
 type ConnectionHandler struct {
 	// 确保实现 AsrEventListener 接口
@@ -64,6 +82,7 @@ type ConnectionHandler struct {
 	taskMgr          *task.TaskManager
 	authManager      *auth.AuthManager // 认证管理器
 	safeCallbackFunc func(func(*ConnectionHandler)) func()
+	providerMu       sync.RWMutex // 保护providers.asr、providers.tts和initailVoice，调用失败时会切换到备用提供者
 	providers        struct {
 		asr   providers.ASRProvider
 		llm   providers.LLMProvider
@@ -71,14 +90,16 @@ type ConnectionHandler struct {
 		vlllm *vlllm.Provider // VLLLM提供者，可选
 	}
 
-	initailVoice string // 初始语音名称
+	initailVoice string       // 初始语音名称
+	currentVoice atomic.Value // 当前语音名称(string)，会话管理接口会并发读取
 
 	// 会话相关
-	sessionID     string            // 设备与服务端会话ID
+	sessionID     string            // 设备与服务端会话ID，建立连接时确定，之后只读
 	deviceID      string            // 设备ID
 	clientId      string            // 客户端ID
 	headers       map[string]string // HTTP头部信息
 	transportType string            // 传输类型
+	connectedAt   time.Time         // 会话建立时间
 
 	// 客户端音频相关
 	clientAudioFormat        string
@@ -91,7 +112,7 @@ type ConnectionHandler struct {
 	serverAudioChannels      int
 	serverAudioFrameDuration int
 
-	clientListenMode string
+	clientListenMode atomic.Value // 拾音模式(string)，会话管理接口会并发读取
 	isDeviceVerified bool
 	closeAfterChat   bool
 
@@ -103,9 +124,11 @@ type ConnectionHandler struct {
 
 	// 对话相关
 	dialogueManager     *chat.DialogueManager
+	memoryPrompt        string // 长期记忆，作为系统消息注入对话
 	tts_last_text_index int
 	client_asr_text     string // 客户端ASR文本
 	quickReplyCache     *utils.QuickReplyCache
+	quickReplyWords     []string // 快速回复词，设备所属用户的设置优先于全局配置
 
 	// 并发控制
 	stopChan         chan struct{}
@@ -125,15 +148,19 @@ type ConnectionHandler struct {
 		text      string
 		round     int // 轮次
 		textIndex int
+		stream    *ttsStream // 流式合成时不为空，优先于filepath
 	}
 
-	talkRound      int       // 轮次计数
-	roundStartTime time.Time // 轮次开始时间
+	talkRound      atomic.Int64 // 轮次计数，会话管理接口会并发读取
+	roundStartTime time.Time    // 轮次开始时间
+	asrStartTime   int64        // 本次识别开始接收音频的时间(UnixNano)，用于统计ASR耗时
 	// functions
 	functionRegister *function.FunctionRegistry
 	mcpManager       *mcp.Manager
+	iotManager       *iot.Manager // 设备上报的IoT描述符和状态
 
 	mcpResultHandlers map[string]func(interface{}) // MCP处理器映射
+	providerSet       *pool.ProviderSet            // 提供者来源，用于上报调用结果
 	ctx               context.Context
 }
 
@@ -143,12 +170,12 @@ func NewConnectionHandler(
 	providerSet *pool.ProviderSet,
 	logger *utils.Logger,
 	req *http.Request,
+	setting *models.UserSetting,
 	ctx context.Context,
 ) *ConnectionHandler {
 	handler := &ConnectionHandler{
 		config:           config,
 		logger:           logger,
-		clientListenMode: "auto",
 		stopChan:         make(chan struct{}),
 		clientAudioQueue: make(chan []byte, 100),
 		clientTextQueue:  make(chan string, 100),
@@ -163,21 +190,23 @@ func NewConnectionHandler(
 			text      string
 			round     int // 轮次
 			textIndex int
+			stream    *ttsStream
 		}, 100),
 
 		tts_last_text_index: -1,
 
-		talkRound: 0,
-
 		serverAudioFormat:        "opus", // 默认使用Opus格式
 		serverAudioSampleRate:    24000,
 		serverAudioChannels:      1,
 		serverAudioFrameDuration: 60,
 
-		ctx: ctx,
+		ctx:         ctx,
+		connectedAt: time.Now(),
 
 		headers: make(map[string]string),
 	}
+	handler.clientListenMode.Store("auto")
+	handler.currentVoice.Store("")
 
 	for key, values := range req.Header {
 		if len(values) > 0 {
@@ -208,12 +237,17 @@ func NewConnectionHandler(
 
 	// 正确设置providers
 	if providerSet != nil {
+		handler.providerSet = providerSet
 		handler.providers.asr = providerSet.ASR
 		handler.providers.llm = providerSet.LLM
 		handler.providers.tts = providerSet.TTS
 		handler.providers.vlllm = providerSet.VLLLM
 		handler.mcpManager = providerSet.MCP
 	}
+	if handler.providers.llm != nil {
+		// 提供者从池中复用，每个连接都要重新设置，没有设备ID时清除上一个连接的标识
+		handler.providers.llm.SetIdentityFlag("device", handler.deviceID)
+	}
 
 	ttsProvider := "default" // 默认TTS提供者名称
 	voiceName := "default"
@@ -221,19 +255,170 @@ func NewConnectionHandler(
 		ttsProvider = getter.Config().Type
 		voiceName = getter.Config().Voice
 		handler.initailVoice = voiceName // 保存初始语音名称
+		handler.currentVoice.Store(voiceName)
 	}
 	logger.Info("使用TTS提供者: %s, 语音名称: %s", ttsProvider, voiceName)
 	handler.quickReplyCache = utils.NewQuickReplyCache(ttsProvider, voiceName)
 
 	// 初始化对话管理器
-	handler.dialogueManager = chat.NewDialogueManager(handler.logger, nil)
-	handler.dialogueManager.SetSystemMessage(config.DefaultPrompt)
+	handler.dialogueManager = chat.NewDialogueManager(handler.logger, handler.createMemory())
+	handler.setContextBudget()
+	handler.restoreDialogue()
+	handler.applyUserSetting(setting)
 	handler.functionRegister = function.NewFunctionRegistry()
+	handler.iotManager = iot.NewManager()
 	handler.initMCPResultHandlers()
 
 	return handler
 }
 
+// createMemory 根据selected_module中的Memory创建设备的长期记忆，未配置时返回nil
+func (h *ConnectionHandler) createMemory() chat.MemoryInterface {
+	name := h.config.SelectedModule["Memory"]
+	if name == "" || h.deviceID == "" {
+		return nil
+	}
+	cfg, ok := h.config.Memory[name]
+	if !ok {
+		h.logger.Warn("找不到记忆配置 %s，长期记忆不可用", name)
+		return nil
+	}
+	provider, err := memory.Create(cfg.Type, &memory.Config{
+		Name:       name,
+		Type:       cfg.Type,
+		MaxEntries: cfg.MaxEntries,
+		QueryLimit: cfg.QueryLimit,
+	}, h.deviceID, h.logger)
+	if err != nil {
+		h.logger.Error("创建长期记忆失败: %v", err)
+		return nil
+	}
+	h.logger.Info("设备 %s 使用长期记忆: %s", h.deviceID, name)
+	return provider
+}
+
+// applyUserSetting 设置系统提示词和快速回复词，设备绑定了用户时使用用户设置覆盖全局配置
+func (h *ConnectionHandler) applyUserSetting(setting *models.UserSetting) {
+	prompt := h.config.DefaultPrompt
+	h.quickReplyWords = h.config.QuickReplyWords
+	if setting != nil {
+		if setting.PromptOverride != "" {
+			prompt = setting.PromptOverride
+		}
+		if len(setting.QuickReplyWords) > 0 {
+			var words []string
+			if err := json.Unmarshal(setting.QuickReplyWords, &words); err != nil {
+				h.logger.Warn("解析用户 %d 的快速回复词失败: %v", setting.UserID, err)
+			} else if len(words) > 0 {
+				h.quickReplyWords = words
+			}
+		}
+		h.logger.Info("设备 %s 使用用户 %d 的设置", h.deviceID, setting.UserID)
+	}
+	h.dialogueManager.SetSystemMessage(prompt)
+}
+
+// setContextBudget 按当前LLM的配置设置对话上下文预算
+func (h *ConnectionHandler) setContextBudget() {
+	cfg, ok := h.config.LLM[h.providerName("LLM")]
+	if !ok || cfg.Context.Budget <= 0 {
+		return
+	}
+	var summarizer chat.Summarizer
+	if cfg.Context.Strategy == chat.StrategySummarize && h.providers.llm != nil {
+		summarizer = chat.NewLLMSummarizer(h.providers.llm, h.sessionID)
+	}
+	h.dialogueManager.SetContextBudget(chat.ContextBudget{
+		Limit:    cfg.Context.Budget,
+		Unit:     cfg.Context.Unit,
+		Strategy: cfg.Context.Strategy,
+	}, summarizer)
+	h.logger.Info("对话上下文预算: %d %s, 策略: %s", cfg.Context.Budget, cfg.Context.Unit, cfg.Context.Strategy)
+}
+
+// newMemoryLLM 按当前会话使用的LLM配置单独创建一个实例，供长期记忆总结对话
+func (h *ConnectionHandler) newMemoryLLM() (providers.LLMProvider, error) {
+	factory := pool.NewLLMFactory(h.providerName("LLM"), h.config, h.logger)
+	if factory == nil {
+		return nil, fmt.Errorf("找不到LLM配置 %s", h.providerName("LLM"))
+	}
+	instance, err := factory.Create()
+	if err != nil {
+		return nil, err
+	}
+	llmProvider, ok := instance.(providers.LLMProvider)
+	if !ok {
+		return nil, fmt.Errorf("LLM实例类型错误: %T", instance)
+	}
+	return llmProvider, nil
+}
+
+// saveMemory 会话结束时在后台总结本次对话并保存到长期记忆，不阻塞连接关闭。
+// 总结时才单独创建LLM实例，用完即释放，不依赖已归还资源池的提供者
+func (h *ConnectionHandler) saveMemory() {
+	if !h.dialogueManager.HasMemory() || h.currentRound() == 0 {
+		return
+	}
+	memoryLLM, err := h.newMemoryLLM()
+	if err != nil {
+		h.LogError(fmt.Sprintf("创建长期记忆使用的LLM失败: %v", err))
+		return
+	}
+	go func() {
+		defer memoryLLM.Cleanup()
+		if err := h.dialogueManager.SaveMemory(memoryLLM); err != nil {
+			h.LogError(fmt.Sprintf("保存长期记忆失败: %v", err))
+		}
+	}()
+}
+
+// restoreDialogue 恢复设备在保留时长内的对话历史
+func (h *ConnectionHandler) restoreDialogue() {
+	dialogueDB := database.GetDialogueDB()
+	if !h.config.DialogueHistory.Enabled || h.deviceID == "" || dialogueDB == nil {
+		return
+	}
+	record, err := dialogueDB.LoadDialogue(h.deviceID, time.Now().Add(-h.config.DialogueRetention()))
+	if err != nil {
+		h.LogError(fmt.Sprintf("加载对话历史失败: %v", err))
+		return
+	}
+	if record == nil {
+		return
+	}
+	if err := h.dialogueManager.LoadFromJSON(record.Content); err != nil {
+		h.LogError(fmt.Sprintf("解析对话历史失败: %v", err))
+		h.dialogueManager.Clear()
+		return
+	}
+	h.dialogueManager.KeepRecentMessages(h.config.DialogueHistory.MaxMessages)
+	h.dialogueManager.SetSummary(record.Summary)
+	h.LogInfo(fmt.Sprintf("已恢复对话历史，消息数: %d", h.dialogueManager.Length()))
+}
+
+// saveDialogue 保存设备的对话历史和较早对话的摘要，不包含系统提示词
+func (h *ConnectionHandler) saveDialogue() {
+	dialogueDB := database.GetDialogueDB()
+	if !h.config.DialogueHistory.Enabled || h.deviceID == "" || dialogueDB == nil {
+		return
+	}
+	count := h.dialogueManager.Length()
+	if count > 0 && h.dialogueManager.GetLLMDialogue()[0].Role == "system" {
+		count--
+	}
+	if count == 0 {
+		return
+	}
+	content, err := h.dialogueManager.ToJSON(false)
+	if err != nil {
+		h.LogError(fmt.Sprintf("序列化对话历史失败: %v", err))
+		return
+	}
+	if err := dialogueDB.SaveDialogue(h.deviceID, content, h.dialogueManager.Summary(), count); err != nil {
+		h.LogError(fmt.Sprintf("保存对话历史失败: %v", err))
+	}
+}
+
 func (h *ConnectionHandler) SetTaskCallback(callback func(func(*ConnectionHandler)) func()) {
 	h.safeCallbackFunc = callback
 }
@@ -358,8 +543,31 @@ func (h *ConnectionHandler) processClientAudioMessagesCoroutine() {
 			if h.closeAfterChat {
 				continue
 			}
-			if err := h.providers.asr.AddAudio(audioData); err != nil {
+			if audioData == nil {
+				// 手动模式停止拾音
+				asr := h.asr()
+				if finisher, ok := asr.(providers.ASRFinisher); ok {
+					if err := finisher.Finish(); err != nil {
+						h.LogError(fmt.Sprintf("结束语音识别失败: %v", err))
+						h.providerSet.ReportResult("ASR", err)
+						// 已收到的音频在原提供者中无法重试，只切换供后续识别使用
+						h.failoverASR(asr)
+					}
+				}
+				continue
+			}
+			atomic.CompareAndSwapInt64(&h.asrStartTime, 0, time.Now().UnixNano())
+			asr := h.asr()
+			if err := asr.AddAudio(audioData); err != nil {
 				h.LogError(fmt.Sprintf("处理音频数据失败: %v", err))
+				h.providerSet.ReportResult("ASR", err)
+				if h.failoverASR(asr) {
+					// 使用备用提供者重试当前音频
+					if err := h.asr().AddAudio(audioData); err != nil {
+						h.LogError(fmt.Sprintf("备用ASR提供者处理音频数据失败: %v", err))
+						h.providerSet.ReportResult("ASR", err)
+					}
+				}
 			}
 		}
 	}
@@ -371,7 +579,7 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 		case <-h.stopChan:
 			return
 		case task := <-h.audioMessagesQueue:
-			h.sendAudioMessage(task.filepath, task.text, task.textIndex, task.round)
+			h.sendAudioMessage(task.filepath, task.stream, task.text, task.textIndex, task.round)
 		}
 	}
 }
@@ -379,42 +587,106 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 // OnAsrResult 实现 AsrEventListener 接口
 // 返回true则停止语音识别，返回false会继续语音识别
 func (h *ConnectionHandler) OnAsrResult(result string) bool {
-	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-	if h.providers.asr.GetSilenceCount() >= 2 {
+	mode := h.listenMode()
+	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, result))
+	if h.asr().GetSilenceCount() >= 2 {
 		h.LogInfo("检测到连续两次静音，结束对话")
 		h.closeAfterChat = true // 如果连续两次静音，则结束对话
 		result = "长时间未检测到用户说话，请礼貌的结束对话"
 	}
-	if h.clientListenMode == "auto" {
+	if mode == "auto" {
 		if result == "" {
 			return false
 		}
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, result))
+		h.observeASRLatency()
 		h.handleChatMessage(context.Background(), result)
 		return true
-	} else if h.clientListenMode == "manual" {
+	} else if mode == "manual" {
 		h.client_asr_text += result
 		if result != "" {
-			h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, h.client_asr_text))
+			h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, h.client_asr_text))
 		}
 		if h.clientVoiceStop {
+			h.observeASRLatency()
 			h.handleChatMessage(context.Background(), h.client_asr_text)
 			return true
 		}
 		return false
-	} else if h.clientListenMode == "realtime" {
+	} else if mode == "realtime" {
 		if result == "" {
 			return false
 		}
 		h.stopServerSpeak()
-		h.providers.asr.Reset() // 重置ASR状态，准备下一次识别
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.asr().Reset() // 重置ASR状态，准备下一次识别
+		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, result))
+		h.observeASRLatency()
 		h.handleChatMessage(context.Background(), result)
 		return true
 	}
 	return false
 }
 
+// observeASRLatency 记录本次识别的耗时，并开始下一次识别的计时
+func (h *ConnectionHandler) observeASRLatency() {
+	if start := atomic.SwapInt64(&h.asrStartTime, 0); start > 0 {
+		metrics.ObserveASR(h.providerName("ASR"), time.Since(time.Unix(0, start)))
+	}
+}
+
+// providerName 模块当前使用的提供者配置名称，用于指标标签
+func (h *ConnectionHandler) providerName(module string) string {
+	if name := h.providerSet.ProviderName(module); name != "" {
+		return name
+	}
+	return "default"
+}
+
+// currentRound 获取当前对话轮次
+func (h *ConnectionHandler) currentRound() int {
+	return int(h.talkRound.Load())
+}
+
+// nextRound 开始新的对话轮次，返回新的轮次
+func (h *ConnectionHandler) nextRound() int {
+	return int(h.talkRound.Add(1))
+}
+
+// listenMode 获取客户端拾音模式
+func (h *ConnectionHandler) listenMode() string {
+	mode, _ := h.clientListenMode.Load().(string)
+	return mode
+}
+
+// voice 获取当前语音名称
+func (h *ConnectionHandler) voice() string {
+	voice, _ := h.currentVoice.Load().(string)
+	return voice
+}
+
+// asr 获取当前使用的ASR提供者
+func (h *ConnectionHandler) asr() providers.ASRProvider {
+	h.providerMu.RLock()
+	defer h.providerMu.RUnlock()
+	return h.providers.asr
+}
+
+// tts 获取当前使用的TTS提供者
+func (h *ConnectionHandler) tts() providers.TTSProvider {
+	h.providerMu.RLock()
+	defer h.providerMu.RUnlock()
+	return h.providers.tts
+}
+
+// setVoice 切换TTS语音，成功后记录当前语音
+func (h *ConnectionHandler) setVoice(voice string) error {
+	if err := h.tts().SetVoice(voice); err != nil {
+		return err
+	}
+	h.currentVoice.Store(voice)
+	return nil
+}
+
 // clientAbortChat 处理中止消息
 func (h *ConnectionHandler) clientAbortChat() error {
 	h.LogInfo("收到客户端中止消息，停止语音识别")
@@ -446,17 +718,17 @@ func (h *ConnectionHandler) QuitIntent(text string) bool {
 
 func (h *ConnectionHandler) quickReplyWakeUpWords(text string) bool {
 	// 检查是否包含唤醒词
-	if !h.config.QuickReply || h.talkRound != 1 {
+	if !h.config.QuickReply || h.currentRound() != 1 {
 		return false
 	}
 	if !utils.IsWakeUpWord(text) {
 		return false
 	}
 
-	repalyWords := h.config.QuickReplyWords
+	repalyWords := h.quickReplyWords
 	reply_text := utils.RandomSelectFromArray(repalyWords)
 	h.tts_last_text_index = 1 // 重置文本索引
-	h.SpeakAndPlay(reply_text, 1, h.talkRound)
+	h.SpeakAndPlay(reply_text, 1, h.currentRound())
 
 	return true
 }
@@ -474,9 +746,8 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 	}
 
 	// 增加对话轮次
-	h.talkRound++
+	currentRound := h.nextRound()
 	h.roundStartTime = time.Now()
-	currentRound := h.talkRound
 	h.LogInfo(fmt.Sprintf("开始新的对话轮次: %d", currentRound))
 
 	// 普通文本消息处理流程
@@ -510,11 +781,17 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		Role:    "user",
 		Content: text,
 	})
+	h.memoryPrompt = h.dialogueManager.QueryMemory(text)
 
-	return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
+	return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogueWithMemory(h.memoryPrompt), currentRound)
 }
 
 func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []providers.Message, round int) error {
+	return h.genResponseByLLMStep(ctx, messages, round, 1)
+}
+
+// genResponseByLLMStep 请求LLM并播报回复，iteration为本轮对话中第几次请求LLM
+func (h *ConnectionHandler) genResponseByLLMStep(ctx context.Context, messages []providers.Message, round, iteration int) error {
 	defer func() {
 		if r := recover(); r != nil {
 			h.LogError(fmt.Sprintf("genResponseByLLM发生panic: %v", r))
@@ -534,6 +811,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	tools := h.functionRegister.GetAllFunctions()
 	responses, err := h.providers.llm.ResponseWithFunctions(ctx, h.sessionID, messages, tools)
 	if err != nil {
+		h.providerSet.ReportResult("LLM", err)
 		return fmt.Errorf("LLM生成回复失败: %v", err)
 	}
 
@@ -546,17 +824,22 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 
 	// 处理流式响应
 	toolCallFlag := false
-	functionName := ""
-	functionID := ""
-	functionArguments := ""
+	var toolCalls []types.ToolCall
 	contentArguments := ""
 
+	firstToken := true
 	for response := range responses {
 		content := response.Content
 		toolCall := response.ToolCalls
 
+		if firstToken && (content != "" || len(toolCall) > 0) {
+			firstToken = false
+			metrics.ObserveLLMFirstToken(h.providerName("LLM"), time.Since(llmStartTime))
+		}
+
 		if response.Error != "" {
 			h.LogError(fmt.Sprintf("LLM响应错误: %s", response.Error))
+			h.providerSet.ReportResult("LLM", errors.New(response.Error))
 			errorMsg := "抱歉，服务暂时不可用，请稍后再试"
 			h.tts_last_text_index = 1 // 重置文本索引
 			h.SpeakAndPlay(errorMsg, 1, round)
@@ -574,20 +857,15 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 
 		if len(toolCall) > 0 {
 			toolCallFlag = true
-			if toolCall[0].ID != "" {
-				functionID = toolCall[0].ID
-			}
-			if toolCall[0].Function.Name != "" {
-				functionName = toolCall[0].Function.Name
-			}
-			if toolCall[0].Function.Arguments != "" {
-				functionArguments += toolCall[0].Function.Arguments
+			for _, delta := range toolCall {
+				toolCalls = types.MergeToolCall(toolCalls, delta)
 			}
 		}
 
 		if content != "" {
 			if strings.Contains(content, "服务响应异常") {
 				h.LogError(fmt.Sprintf("检测到LLM服务异常: %s", content))
+				h.providerSet.ReportResult("LLM", errors.New(content))
 				errorMsg := "抱歉，LLM服务暂时不可用，请稍后再试"
 				h.tts_last_text_index = 1 // 重置文本索引
 				h.SpeakAndPlay(errorMsg, 1, round)
@@ -627,63 +905,30 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 			}
 		}
 	}
+	h.providerSet.ReportResult("LLM", nil)
 
 	if toolCallFlag {
-		bHasError := false
-		if functionID == "" {
-			a := utils.Extract_json_from_string(contentArguments)
-			if a != nil {
-				functionName = a["name"].(string)
+		if len(toolCalls) == 0 {
+			// 不支持原生工具调用的模型在文本中输出<tool_call>{"name": ..., "arguments": ...}
+			if a := utils.Extract_json_from_string(contentArguments); a != nil {
+				name, _ := a["name"].(string)
 				argumentsJson, err := json.Marshal(a["arguments"])
 				if err != nil {
 					h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
 				}
-				functionArguments = string(argumentsJson)
-				functionID = uuid.New().String()
+				toolCalls = append(toolCalls, types.ToolCall{
+					Type:     "function",
+					Function: types.FunctionCall{Name: name, Arguments: string(argumentsJson)},
+				})
 			} else {
-				bHasError = true
-			}
-			if bHasError {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+				h.LogError(fmt.Sprintf("函数调用参数解析失败: %s", contentArguments))
 			}
 		}
-		if !bHasError {
+		if len(toolCalls) > 0 {
 			// 清空responseMessage
 			responseMessage = []string{}
-			arguments := make(map[string]interface{})
-			if err := json.Unmarshal([]byte(functionArguments), &arguments); err != nil {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
-			}
-			functionCallData := map[string]interface{}{
-				"id":        functionID,
-				"name":      functionName,
-				"arguments": functionArguments,
-			}
-			h.LogInfo(fmt.Sprintf("函数调用: %v", arguments))
-			if h.mcpManager.IsMCPTool(functionName) {
-				// 处理MCP函数调用
-				result, err := h.mcpManager.ExecuteTool(ctx, functionName, arguments)
-				if err != nil {
-					h.LogError(fmt.Sprintf("MCP函数调用失败: %v", err))
-					if result == nil {
-						result = "MCP工具调用失败"
-					}
-				}
-				// 判断result 是否是types.ActionResponse类型
-				if actionResult, ok := result.(types.ActionResponse); ok {
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				} else {
-					h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
-					actionResult := types.ActionResponse{
-						Action: types.ActionTypeReqLLM, // 动作类型
-						Result: result,                 // 动作产生的结果
-					}
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				}
-
-			} else {
-				// 处理普通函数调用
-				//h.functionRegister.CallFunction(functionName, functionCallData)
+			if err := h.handleToolCalls(ctx, toolCalls, round, iteration); err != nil {
+				h.LogError(fmt.Sprintf("处理工具调用失败: %v", err))
 			}
 		}
 	}
@@ -716,72 +961,6 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	return nil
 }
 
-func (h *ConnectionHandler) addToolCallMessage(toolResultText string, functionCallData map[string]interface{}) {
-
-	functionID := functionCallData["id"].(string)
-	functionName := functionCallData["name"].(string)
-	functionArguments := functionCallData["arguments"].(string)
-	h.LogInfo(fmt.Sprintf("函数调用结果: %s", toolResultText))
-	h.LogInfo(fmt.Sprintf("函数调用参数: %s", functionArguments))
-	h.LogInfo(fmt.Sprintf("函数调用名称: %s", functionName))
-	h.LogInfo(fmt.Sprintf("函数调用ID: %s", functionID))
-
-	// 添加 assistant 消息，包含 tool_calls
-	h.dialogueManager.Put(chat.Message{
-		Role: "assistant",
-		ToolCalls: []types.ToolCall{{
-			ID: functionID,
-			Function: types.FunctionCall{
-				Arguments: functionArguments,
-				Name:      functionName,
-			},
-			Type:  "function",
-			Index: 0,
-		}},
-	})
-
-	// 添加 tool 消息
-	toolCallID := functionID
-	if toolCallID == "" {
-		toolCallID = uuid.New().String()
-	}
-	h.dialogueManager.Put(chat.Message{
-		Role:       "tool",
-		ToolCallID: toolCallID,
-		Content:    toolResultText,
-	})
-}
-
-func (h *ConnectionHandler) handleFunctionResult(result types.ActionResponse, functionCallData map[string]interface{}, textIndex int) {
-	switch result.Action {
-	case types.ActionTypeError:
-		h.LogError(fmt.Sprintf("函数调用错误: %v", result.Result))
-	case types.ActionTypeNotFound:
-		h.LogError(fmt.Sprintf("函数未找到: %v", result.Result))
-	case types.ActionTypeNone:
-		h.LogInfo(fmt.Sprintf("函数调用无操作: %v", result.Result))
-	case types.ActionTypeResponse:
-		h.LogInfo(fmt.Sprintf("函数调用直接回复: %v", result.Response))
-		h.SystemSpeak(result.Response.(string))
-	case types.ActionTypeCallHandler:
-		resultStr := h.handleMCPResultCall(result)
-		h.addToolCallMessage(resultStr, functionCallData)
-	case types.ActionTypeReqLLM:
-		h.LogInfo(fmt.Sprintf("函数调用后请求LLM: %v", result.Result))
-		text, ok := result.Result.(string)
-		if ok && len(text) > 0 {
-			h.addToolCallMessage(text, functionCallData)
-			h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
-
-		} else {
-			h.LogError(fmt.Sprintf("函数调用结果解析失败: %v", result.Result))
-			// 发送错误消息
-			errorMessage := fmt.Sprintf("函数调用结果解析失败 %v", result.Result)
-			h.SystemSpeak(errorMessage)
-		}
-	}
-}
-
 func (h *ConnectionHandler) SystemSpeak(text string) error {
 	if text == "" {
 		h.logger.Warn("SystemSpeak 收到空文本，无法合成语音")
@@ -792,7 +971,7 @@ func (h *ConnectionHandler) SystemSpeak(text string) error {
 	for _, item := range texts {
 		index++
 		h.tts_last_text_index = index // 重置文本索引
-		h.SpeakAndPlay(item, index, h.talkRound)
+		h.SpeakAndPlay(item, index, h.currentRound())
 	}
 	return nil
 }
@@ -843,19 +1022,21 @@ func (h *ConnectionHandler) deleteAudioFileIfNeeded(filepath string, reason stri
 
 // processTTSTask 处理单个TTS任务
 func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int, filepath string) {
+	var stream *ttsStream
 	defer func() {
 		h.audioMessagesQueue <- struct {
 			filepath  string
 			text      string
 			round     int
 			textIndex int
-		}{filepath, text, round, textIndex}
+			stream    *ttsStream
+		}{filepath, text, round, textIndex, stream}
 	}()
 	if filepath != "" {
 		return
 	}
 
-	if utils.IsQuickReplyHit(text, h.config.QuickReplyWords) {
+	if utils.IsQuickReplyHit(text, h.quickReplyWords) {
 		// 尝试从缓存查找音频文件
 		if cachedFile := h.quickReplyCache.FindCachedAudio(text); cachedFile != "" {
 			h.LogInfo(fmt.Sprintf("使用缓存的快速回复音频: %s", cachedFile))
@@ -872,15 +1053,40 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 		return
 	}
 
+	// 支持流式合成的TTS边合成边发送，快速回复词仍需生成文件以便缓存
+	tts := h.tts()
+	if streamer, ok := tts.(providers.TTSStreamProvider); ok && !utils.IsQuickReplyHit(text, h.quickReplyWords) {
+		ctx, cancel := context.WithCancel(h.ctx)
+		chunks, err := streamer.ToTTSStream(ctx, text, h.serverAudioSampleRate)
+		if err == nil {
+			stream = &ttsStream{chunks: chunks, cancel: cancel, start: ttsStartTime, provider: tts}
+			h.logger.Debug("TTS流式合成开始: text(%s), index(%d)", text, textIndex)
+			return
+		}
+		cancel()
+		h.providerSet.ReportResult("TTS", err)
+		h.LogError(fmt.Sprintf("TTS流式合成失败，改用文件方式: %v", err))
+	}
+
 	// 生成语音文件
-	filepath, err := h.providers.tts.ToTTS(text)
+	filepath, err := tts.ToTTS(text)
+	h.providerSet.ReportResult("TTS", err)
+	if err != nil && h.failoverTTS(tts) {
+		// 使用备用提供者重试该句
+		h.LogError(fmt.Sprintf("TTS转换失败，使用备用提供者重试:text(%s) %v", text, err))
+		filepath, err = h.tts().ToTTS(text)
+		h.providerSet.ReportResult("TTS", err)
+	}
+	if err == nil {
+		metrics.ObserveTTSSynthesis(h.providerName("TTS"), time.Since(ttsStartTime))
+	}
 	if err != nil {
 		h.LogError(fmt.Sprintf("TTS转换失败:text(%s) %v", text, err))
 		return
 	} else {
 		h.logger.Debug(fmt.Sprintf("TTS转换成功: text(%s), index(%d) %s", text, textIndex, filepath))
 		// 如果是快速回复词，保存到缓存
-		if utils.IsQuickReplyHit(text, h.config.QuickReplyWords) {
+		if utils.IsQuickReplyHit(text, h.quickReplyWords) {
 			if err := h.quickReplyCache.SaveCachedAudio(text, filepath); err != nil {
 				h.LogError(fmt.Sprintf("保存快速回复音频失败: %v", err))
 			} else {
@@ -939,7 +1145,7 @@ func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int, round int)
 func (h *ConnectionHandler) clearSpeakStatus() {
 	h.LogInfo("清除服务端讲话状态 ")
 	h.tts_last_text_index = -1
-	h.providers.asr.Reset() // 重置ASR状态
+	h.asr().Reset() // 重置ASR状态
 }
 
 func (h *ConnectionHandler) closeOpusDecoder() {
@@ -974,6 +1180,10 @@ clearAudioQueue:
 		select {
 		case task := <-h.audioMessagesQueue:
 			h.LogInfo(fmt.Sprintf(msgPrefix+"丢弃一个音频任务: %s", task.text))
+			// 终止被丢弃任务的流式合成
+			if task.stream != nil {
+				task.stream.cancel()
+			}
 			// 根据配置删除被丢弃的音频文件
 			h.deleteAudioFileIfNeeded(task.filepath, msgPrefix+"丢弃音频任务时")
 		default:
@@ -990,15 +1200,23 @@ func (h *ConnectionHandler) Close() {
 		close(h.stopChan)
 
 		h.closeOpusDecoder()
-		if h.providers.tts != nil {
-			h.providers.tts.SetVoice(h.initailVoice) // 恢复初始语音
+		if h.tts() != nil {
+			h.providerMu.RLock()
+			initailVoice := h.initailVoice
+			h.providerMu.RUnlock()
+			h.setVoice(initailVoice) // 恢复初始语音
 		}
-		if h.providers.asr != nil {
-			if err := h.providers.asr.Reset(); err != nil {
+		if asr := h.asr(); asr != nil {
+			if err := asr.Reset(); err != nil {
 				h.LogError(fmt.Sprintf("重置ASR状态失败: %v", err))
 			}
 		}
 		h.cleanTTSAndAudioQueue(true)
+		// 等待后台总结完成，摘要随对话一起保存，LLM归还资源池后不再被占用
+		h.dialogueManager.WaitSummary()
+		h.saveDialogue()
+		// 长期记忆在后台总结，不阻塞连接关闭
+		h.saveMemory()
 	})
 }
 
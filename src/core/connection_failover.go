@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"xiaozhi-server-go/src/core/providers"
+)
+
+// failoverTTS TTS调用失败时切换到故障转移链中下一个健康的提供者，failed为失败的提供者。
+// 其他goroutine已经切换过时直接使用当前提供者。返回是否可以使用当前提供者重试
+func (h *ConnectionHandler) failoverTTS(failed providers.TTSProvider) bool {
+	h.providerMu.Lock()
+	defer h.providerMu.Unlock()
+	if h.providers.tts != failed {
+		return true
+	}
+
+	// 原提供者会归还到资源池，先恢复初始语音
+	failed.SetVoice(h.initailVoice)
+	resource, err := h.providerSet.Failover("TTS")
+	if err != nil {
+		failed.SetVoice(h.voice())
+		h.LogError(fmt.Sprintf("切换TTS提供者失败: %v", err))
+		return false
+	}
+	h.providers.tts = resource.(providers.TTSProvider)
+	h.initailVoice = ""
+	if getter, ok := h.providers.tts.(configGetter); ok {
+		h.initailVoice = getter.Config().Voice
+	}
+	h.currentVoice.Store(h.initailVoice)
+	h.LogInfo(fmt.Sprintf("已切换到TTS提供者 %s", h.providerName("TTS")))
+	return true
+}
+
+// failoverASR ASR调用失败时切换到故障转移链中下一个健康的提供者，failed为失败的提供者。
+// 其他goroutine已经切换过时直接使用当前提供者。返回是否可以使用当前提供者重试
+func (h *ConnectionHandler) failoverASR(failed providers.ASRProvider) bool {
+	h.providerMu.Lock()
+	defer h.providerMu.Unlock()
+	if h.providers.asr != failed {
+		return true
+	}
+
+	resource, err := h.providerSet.Failover("ASR")
+	if err != nil {
+		h.LogError(fmt.Sprintf("切换ASR提供者失败: %v", err))
+		return false
+	}
+	asr := resource.(providers.ASRProvider)
+	asr.SetListener(h)
+	asr.SetListenMode(h.listenMode())
+	h.providers.asr = asr
+	h.LogInfo(fmt.Sprintf("已切换到ASR提供者 %s", h.providerName("ASR")))
+	return true
+}
+
+// retryTTS 流式合成在发送音频前失败时，使用当前TTS提供者重新合成该句。
+// 支持流式合成时替换stream中的音频通道，返回空路径；否则生成音频文件并返回文件路径
+func (h *ConnectionHandler) retryTTS(stream *ttsStream, text string) (string, error) {
+	tts := h.tts()
+	if streamer, ok := tts.(providers.TTSStreamProvider); ok {
+		ctx, cancel := context.WithCancel(h.ctx)
+		chunks, err := streamer.ToTTSStream(ctx, text, h.serverAudioSampleRate)
+		if err != nil {
+			cancel()
+			h.providerSet.ReportResult("TTS", err)
+			return "", err
+		}
+		stream.cancel()
+		stream.chunks, stream.cancel, stream.provider = chunks, cancel, tts
+		return "", nil
+	}
+
+	filepath, err := tts.ToTTS(text)
+	h.providerSet.ReportResult("TTS", err)
+	return filepath, err
+}
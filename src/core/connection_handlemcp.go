@@ -62,7 +62,7 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 				round     int
 				textIndex int
 				filepath  string
-			}{name, h.talkRound, h.tts_last_text_index, path}
+			}{name, h.currentRound(), h.tts_last_text_index, path}
 		}
 	} else {
 		h.logger.Error("mcp_handler_play_music: args is not a string")
@@ -72,7 +72,7 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 func (h *ConnectionHandler) mcp_handler_change_voice(args interface{}) {
 	if voice, ok := args.(string); ok {
 		h.logger.Info("mcp_handler_change_voice: %s", voice)
-		if err := h.providers.tts.SetVoice(voice); err != nil {
+		if err := h.setVoice(voice); err != nil {
 			h.logger.Error("mcp_handler_change_voice: SetVoice failed: %v", err)
 			h.SystemSpeak("切换语音失败，没有叫" + voice + "的音色")
 		} else {
@@ -91,15 +91,15 @@ func (h *ConnectionHandler) mcp_handler_change_role(args interface{}) {
 		h.logger.Info("mcp_handler_change_role: %s", role)
 		h.dialogueManager.SetSystemMessage(prompt)
 		h.dialogueManager.KeepRecentMessages(5) // 保留最近5条消息
-		if getter, ok := h.providers.tts.(configGetter); ok {
+		if getter, ok := h.tts().(configGetter); ok {
 			ttsProvider := getter.Config().Type
 			if ttsProvider == "edge" {
 				if role == "陕西女友" {
-					h.providers.tts.SetVoice("zh-CN-shaanxi-XiaoniNeural") // 陕西女友音色
+					h.setVoice("zh-CN-shaanxi-XiaoniNeural") // 陕西女友音色
 				} else if role == "英语老师" {
-					h.providers.tts.SetVoice("zh-CN-XiaoyiNeural") // 英语老师音色
+					h.setVoice("zh-CN-XiaoyiNeural") // 英语老师音色
 				} else if role == "好奇小男孩" {
-					h.providers.tts.SetVoice("zh-CN-YunxiNeural") // 好奇小男孩音色
+					h.setVoice("zh-CN-YunxiNeural") // 好奇小男孩音色
 				}
 			}
 		}
@@ -128,7 +128,7 @@ func (h *ConnectionHandler) mcp_handler_take_photo(args interface{}) {
 
 	if !visionResponse.Success {
 		h.logger.Error("拍照失败: %s", visionResponse.Message)
-		h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
+		h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogueWithMemory(h.memoryPrompt), h.currentRound())
 
 	}
 
@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 	"xiaozhi-server-go/src/core/chat"
 	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/iot"
+	"xiaozhi-server-go/src/core/metrics"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -163,20 +168,31 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 
 	// 处理mode参数
 	if mode, ok := msgMap["mode"].(string); ok {
-		h.clientListenMode = mode
-		h.LogInfo(fmt.Sprintf("客户端拾音模式：%s， %s", h.clientListenMode, state))
-		h.providers.asr.SetListener(h)
+		h.clientListenMode.Store(mode)
+		h.LogInfo(fmt.Sprintf("客户端拾音模式：%s， %s", mode, state))
+		asr := h.asr()
+		asr.SetListener(h)
+		asr.SetListenMode(mode)
 	}
 
 	switch state {
 	case "start":
-		if h.client_asr_text != "" && h.clientListenMode == "manual" {
+		if h.client_asr_text != "" && h.listenMode() == "manual" {
 			h.clientAbortChat()
 		}
 		h.clientVoiceStop = false
 		h.client_asr_text = ""
+		atomic.StoreInt64(&h.asrStartTime, 0)
 	case "stop":
 		h.clientVoiceStop = true
+		if h.listenMode() == "manual" {
+			// 手动模式下识别耗时从停止拾音开始计算
+			atomic.StoreInt64(&h.asrStartTime, time.Now().UnixNano())
+			if _, ok := h.asr().(providers.ASRFinisher); ok {
+				// 通过音频队列通知，保证停止前收到的音频都已交给ASR
+				h.clientAudioQueue <- nil
+			}
+		}
 		h.LogInfo("客户端停止语音识别")
 	case "detect":
 		text, hasText := msgMap["text"].(string)
@@ -197,25 +213,63 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 }
 
 // handleIotMessage 处理IOT设备消息
+// descriptors中的设备方法注册为LLM工具，states缓存供LLM查询
 func (h *ConnectionHandler) handleIotMessage(msgMap map[string]interface{}) error {
 	if descriptors, ok := msgMap["descriptors"].([]interface{}); ok {
-		// 处理设备描述符
-		// 这里需要实现具体的IOT设备描述符处理逻辑
 		h.LogInfo(fmt.Sprintf("收到IOT设备描述符：%v", descriptors))
+		tools, err := h.iotManager.AddDescriptors(descriptors)
+		if err != nil {
+			return err
+		}
+		// 描述符可能分多次上报，重新注册全部IoT工具
+		for _, tool := range h.functionRegister.GetAllFunctions() {
+			if strings.HasPrefix(tool.Function.Name, iot.ToolPrefix) {
+				h.functionRegister.UnregisterFunction(tool.Function.Name)
+			}
+		}
+		for _, tool := range tools {
+			if err := h.functionRegister.RegisterFunction(tool.Function.Name, tool); err != nil {
+				h.LogError(fmt.Sprintf("注册IOT工具失败: %v", err))
+			}
+		}
+		h.LogInfo(fmt.Sprintf("已注册IOT工具 %d 个", len(tools)))
 	}
 	if states, ok := msgMap["states"].([]interface{}); ok {
-		// 处理设备状态
-		// 这里需要实现具体的IOT设备状态处理逻辑
-		h.LogInfo(fmt.Sprintf("收到IOT设备状态：%v", states))
+		h.logger.Debug("收到IOT设备状态：%v", states)
+		if err := h.iotManager.UpdateStates(states); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// handleIotToolCall 处理LLM对IoT工具的调用：查询状态直接读取缓存，设备方法下发iot指令
+func (h *ConnectionHandler) handleIotToolCall(functionName string, arguments map[string]interface{}) types.ActionResponse {
+	if functionName == iot.StateToolName {
+		device, _ := arguments["device"].(string)
+		return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: h.iotManager.QueryStates(device)}
+	}
+
+	command, err := h.iotManager.BuildCommand(functionName, arguments)
+	if err == nil {
+		err = h.sendIotCommand(command)
+	}
+	metrics.IncToolCall(functionName, "iot", err)
+	if err != nil {
+		h.LogError(fmt.Sprintf("IOT指令下发失败: %v", err))
+		return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: fmt.Sprintf("设备控制失败: %v", err)}
+	}
+	h.LogInfo(fmt.Sprintf("已下发IOT指令: %s.%s %v", command.Name, command.Method, command.Parameters))
+	return types.ActionResponse{
+		Action: types.ActionTypeReqLLM,
+		Result: fmt.Sprintf("已向设备%s发送%s指令，参数: %v", command.Name, command.Method, command.Parameters),
+	}
+}
+
 // handleImageMessage 处理图片消息
 func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[string]interface{}) error {
 	// 增加对话轮次
-	h.talkRound++
-	currentRound := h.talkRound
+	currentRound := h.nextRound()
 	h.LogInfo(fmt.Sprintf("开始新的图片对话轮次: %d", currentRound))
 
 	// 检查是否有VLLLM Provider
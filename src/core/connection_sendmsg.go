@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"sync/atomic"
 	"time"
+	"xiaozhi-server-go/src/core/iot"
+	"xiaozhi-server-go/src/core/metrics"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -31,6 +33,11 @@ func (h *ConnectionHandler) sendHelloMessage() error {
 		"channels":       h.serverAudioChannels,
 		"frame_duration": h.serverAudioFrameDuration,
 	}
+	if provider, ok := h.conn.(helloParamsProvider); ok {
+		for key, value := range provider.HelloParams() {
+			hello[key] = value
+		}
+	}
 	data, err := json.Marshal(hello)
 	if err != nil {
 		return fmt.Errorf("序列化欢迎消息失败: %v", err)
@@ -76,6 +83,20 @@ func (h *ConnectionHandler) sendSTTMessage(text string) error {
 	return nil
 }
 
+// sendIotCommand 向设备下发IoT控制指令
+func (h *ConnectionHandler) sendIotCommand(command *iot.Command) error {
+	data := map[string]interface{}{
+		"type":       "iot",
+		"commands":   []*iot.Command{command},
+		"session_id": h.sessionID,
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化IOT指令失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, jsonData)
+}
+
 // sendEmotionMessage 发送情绪消息
 func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 	data := map[string]interface{}{
@@ -91,14 +112,18 @@ func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 	return h.conn.WriteMessage(1, jsonData)
 }
 
-func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textIndex int, round int) {
+func (h *ConnectionHandler) sendAudioMessage(filepath string, stream *ttsStream, text string, textIndex int, round int) {
 	bFinishSuccess := false
+	if stream != nil {
+		// 无论是否发送完成，都要终止流式合成，重试时stream.cancel会被替换
+		defer func() { stream.cancel() }()
+	}
 	defer func() {
 		// 音频发送完成后，根据配置决定是否删除文件
 		h.deleteAudioFileIfNeeded(filepath, "音频发送完成")
 
 		h.LogInfo(fmt.Sprintf("TTS音频发送任务结束(%t): %s, 索引: %d/%d", bFinishSuccess, text, textIndex, h.tts_last_text_index))
-		h.providers.asr.ResetStartListenTime()
+		h.asr().ResetStartListenTime()
 		if textIndex == h.tts_last_text_index {
 			h.sendTTSMessage("stop", "", textIndex)
 			if h.closeAfterChat {
@@ -109,13 +134,13 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		}
 	}()
 
-	if len(filepath) == 0 {
+	if len(filepath) == 0 && stream == nil {
 		return
 	}
 	// 检查轮次
-	if round != h.talkRound {
+	if round != h.currentRound() {
 		h.LogInfo(fmt.Sprintf("sendAudioMessage: 跳过过期轮次的音频: 任务轮次=%d, 当前轮次=%d, 文本=%s",
-			round, h.talkRound, text))
+			round, h.currentRound(), text))
 		// 即使跳过，也要根据配置删除音频文件
 		h.deleteAudioFileIfNeeded(filepath, "跳过过期轮次")
 		return
@@ -128,6 +153,16 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		return
 	}
 
+	if stream != nil {
+		var retryFile string
+		bFinishSuccess, retryFile = h.sendAudioStream(stream, text, textIndex, round)
+		if retryFile == "" {
+			return
+		}
+		// 备用提供者不支持流式合成，改为发送重试生成的音频文件
+		filepath = retryFile
+	}
+
 	var audioData [][]byte
 	var duration float64
 	var err error
@@ -158,6 +193,7 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		now := time.Now()
 		spentTime := now.Sub(h.roundStartTime)
 		h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
+		metrics.ObserveTTSFirstFrame(h.providerName("TTS"), spentTime)
 	}
 	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.tts_last_text_index, duration, len(audioData))
 
@@ -195,7 +231,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 	// 发送预缓冲帧
 	for i := 0; i < preBufferFrames; i++ {
 		// 检查是否被打断
-		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 			h.LogInfo(fmt.Sprintf("音频发送被中断(预缓冲阶段): 帧=%d/%d, 文本=%s", i+1, preBufferFrames, text))
 			return nil
 		}
@@ -210,7 +246,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 	remainingFrames := audioData[preBufferFrames:]
 	for i, chunk := range remainingFrames {
 		// 检查是否被打断或轮次变化
-		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 			h.LogInfo(fmt.Sprintf("音频发送被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
 			return nil
 		}
@@ -238,7 +274,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 				select {
 				case <-ticker.C:
 					// 检查中断条件
-					if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+					if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 						h.LogInfo(fmt.Sprintf("音频发送在延迟中被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
 						return nil
 					}
@@ -260,3 +296,139 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 	h.LogInfo(fmt.Sprintf("音频帧发送完成: 总帧数=%d, 总时长=%dms, 总耗时:%dms 文本=%s", len(audioData), playPosition, spentTime, text))
 	return nil
 }
+
+// sendAudioStream 边接收流式合成的PCM数据边编码发送，按播放进度控制发送节奏。
+// 发送音频前合成失败时切换到备用提供者重试一次，备用提供者不支持流式合成时返回重试生成的音频文件
+func (h *ConnectionHandler) sendAudioStream(stream *ttsStream, text string, textIndex int, round int) (bool, string) {
+	encoder, err := utils.NewAudioFrameEncoder(h.serverAudioFormat, h.serverAudioSampleRate, h.serverAudioChannels, h.serverAudioFrameDuration)
+	if err != nil {
+		h.LogError(fmt.Sprintf("创建音频帧编码器失败: %v", err))
+		return false, ""
+	}
+	defer encoder.Close()
+
+	started := false
+	retried := false
+	var startTime time.Time
+	playPosition := 0 // 播放位置（毫秒）
+	frameCount := 0
+	// 预缓冲：前几帧不等待，提升播放流畅度
+	preBufferTime := time.Duration(h.serverAudioFrameDuration*3) * time.Millisecond
+
+	sendFrame := func(frame []byte) bool {
+		if !started {
+			// 收到第一帧音频后再通知开始，合成失败时不会出现空句子
+			if err := h.sendTTSMessage("sentence_start", text, textIndex); err != nil {
+				h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+				return false
+			}
+			metrics.ObserveTTSSynthesis(h.providerName("TTS"), time.Since(stream.start))
+			if textIndex == 1 {
+				spentTime := time.Since(h.roundStartTime)
+				h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
+				metrics.ObserveTTSFirstFrame(h.providerName("TTS"), spentTime)
+			}
+			started = true
+			startTime = time.Now()
+		}
+
+		expectedTime := startTime.Add(time.Duration(playPosition)*time.Millisecond - preBufferTime)
+		if !h.waitUntil(expectedTime, round) {
+			h.LogInfo(fmt.Sprintf("流式音频发送被中断: 帧=%d, 文本=%s", frameCount+1, text))
+			return false
+		}
+		if err := h.conn.WriteMessage(2, frame); err != nil {
+			h.LogError(fmt.Sprintf("发送音频帧失败: %v", err))
+			return false
+		}
+		playPosition += h.serverAudioFrameDuration
+		frameCount++
+		return true
+	}
+
+	for done := false; !done; {
+		select {
+		case <-h.stopChan:
+			return false, ""
+		case chunk, ok := <-stream.chunks:
+			if !ok {
+				done = true
+				break
+			}
+			if chunk.Err != nil {
+				h.LogError(fmt.Sprintf("TTS流式合成失败:text(%s) %v", text, chunk.Err))
+				h.providerSet.ReportResult("TTS", chunk.Err)
+				if started || retried || !h.failoverTTS(stream.provider) {
+					return false, ""
+				}
+				retried = true
+				filepath, err := h.retryTTS(stream, text)
+				if err != nil {
+					h.LogError(fmt.Sprintf("备用TTS提供者重试失败:text(%s) %v", text, err))
+					return false, ""
+				}
+				if filepath != "" {
+					return false, filepath
+				}
+				continue
+			}
+			frames, err := encoder.Encode(chunk.Data)
+			if err != nil {
+				h.LogError(fmt.Sprintf("音频帧编码失败: %v", err))
+				return false, ""
+			}
+			for _, frame := range frames {
+				if !sendFrame(frame) {
+					return false, ""
+				}
+			}
+		}
+	}
+
+	last, err := encoder.Flush()
+	if err != nil {
+		h.LogError(fmt.Sprintf("音频帧编码失败: %v", err))
+		return false, ""
+	}
+	if last != nil && !sendFrame(last) {
+		return false, ""
+	}
+	if !started {
+		h.logger.Warn("TTS流式合成未返回音频数据: %s", text)
+		return false, ""
+	}
+	h.providerSet.ReportResult("TTS", nil)
+
+	// 等待设备播放完缓冲的音频
+	if !h.waitUntil(startTime.Add(time.Duration(playPosition)*time.Millisecond), round) {
+		return false, ""
+	}
+	h.LogInfo(fmt.Sprintf("流式音频帧发送完成: 总帧数=%d, 总时长=%dms, 总耗时:%dms 文本=%s", frameCount, playPosition, time.Since(startTime).Milliseconds(), text))
+
+	// 发送TTS状态结束通知
+	if err := h.sendTTSMessage("sentence_end", text, textIndex); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS结束状态失败: %v", err))
+		return false, ""
+	}
+	return true, ""
+}
+
+// waitUntil 可中断地等待到指定时间，被打断、轮次变化或连接关闭时返回false
+func (h *ConnectionHandler) waitUntil(deadline time.Time, round int) bool {
+	ticker := time.NewTicker(10 * time.Millisecond) // 固定10ms检查间隔
+	defer ticker.Stop()
+
+	for {
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
+			return false
+		}
+		if !time.Now().Before(deadline) {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-h.stopChan:
+			return false
+		}
+	}
+}
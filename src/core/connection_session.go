@@ -0,0 +1,55 @@
+package core
+
+import (
+	"time"
+
+	"xiaozhi-server-go/src/core/chat"
+)
+
+// SessionInfo 会话运行状态，供会话管理接口查询
+type SessionInfo struct {
+	SessionID   string            `json:"session_id"`
+	DeviceID    string            `json:"device_id"`
+	ClientID    string            `json:"client_id"`
+	Transport   string            `json:"transport"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	ListenMode  string            `json:"listen_mode"`
+	Round       int               `json:"round"`     // 当前对话轮次
+	Providers   map[string]string `json:"providers"` // 模块 -> 提供者配置名称
+	Voice       string            `json:"voice"`
+}
+
+// SessionInfo 获取会话运行状态
+func (h *ConnectionHandler) SessionInfo() SessionInfo {
+	info := SessionInfo{
+		SessionID:   h.sessionID,
+		DeviceID:    h.deviceID,
+		ClientID:    h.clientId,
+		Transport:   h.transportType,
+		ConnectedAt: h.connectedAt,
+		ListenMode:  h.listenMode(),
+		Round:       h.currentRound(),
+		Providers:   make(map[string]string),
+		Voice:       h.voice(),
+	}
+	for _, module := range []string{"ASR", "LLM", "TTS", "VLLLM"} {
+		if name := h.providerSet.ProviderName(module); name != "" {
+			info.Providers[module] = name
+		}
+	}
+	return info
+}
+
+// RecentDialogue 获取最近的对话消息，不含系统提示词，limit<=0时返回全部
+func (h *ConnectionHandler) RecentDialogue(limit int) []chat.Message {
+	var messages []chat.Message
+	for _, msg := range h.dialogueManager.GetLLMDialogue() {
+		if msg.Role != "system" {
+			messages = append(messages, msg)
+		}
+	}
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/metrics"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/google/uuid"
+)
+
+// handleToolCalls 并发执行一次回复中的所有工具调用，按顺序处理结果并加入对话历史，
+// 需要时带着工具结果再次请求LLM，请求次数不超过tool_call.max_iterations
+func (h *ConnectionHandler) handleToolCalls(ctx context.Context, calls []types.ToolCall, round, iteration int) error {
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = uuid.New().String()
+		}
+		if calls[i].Type == "" {
+			calls[i].Type = "function"
+		}
+		calls[i].Index = i
+	}
+
+	results := h.executeToolCalls(ctx, calls)
+
+	// 结果处理可能修改连接状态（切换角色、播放音乐等），按调用顺序依次执行
+	reqLLM := false
+	toolMessages := make([]chat.Message, len(calls))
+	for i, call := range calls {
+		text, next := h.handleFunctionResult(results[i], call)
+		reqLLM = reqLLM || next
+		toolMessages[i] = chat.Message{Role: "tool", ToolCallID: call.ID, Content: text}
+		h.LogInfo(fmt.Sprintf("函数调用结果: %s(%s) -> %s", call.Function.Name, call.Function.Arguments, text))
+	}
+
+	// 每个tool_call都要有对应的tool消息
+	h.dialogueManager.Put(chat.Message{Role: "assistant", ToolCalls: calls})
+	for _, msg := range toolMessages {
+		h.dialogueManager.Put(msg)
+	}
+
+	if !reqLLM {
+		return nil
+	}
+	if round != h.currentRound() {
+		h.LogInfo(fmt.Sprintf("对话轮次已变化，不再处理round %d的工具调用结果", round))
+		return nil
+	}
+	if maxIterations := h.config.MaxToolIterations(); iteration >= maxIterations {
+		h.logger.Warn("工具调用后请求LLM的次数已达上限%d，停止本轮对话", maxIterations)
+		return h.SystemSpeak("抱歉，这个问题需要的步骤太多了，请换个问法试试。")
+	}
+	return h.genResponseByLLMStep(ctx, h.dialogueManager.GetLLMDialogueWithMemory(h.memoryPrompt), round, iteration+1)
+}
+
+// executeToolCalls 并发执行工具调用，结果顺序与calls一致
+func (h *ConnectionHandler) executeToolCalls(ctx context.Context, calls []types.ToolCall) []types.ActionResponse {
+	results := make([]types.ActionResponse, len(calls))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.executeToolCall(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// executeToolCall 执行单个工具调用，超时后不再等待工具返回
+func (h *ConnectionHandler) executeToolCall(ctx context.Context, call types.ToolCall) types.ActionResponse {
+	name := call.Function.Name
+	arguments := make(map[string]interface{})
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			h.LogError(fmt.Sprintf("函数调用参数解析失败: %s, %v", call.Function.Arguments, err))
+			return types.ActionResponse{Action: types.ActionTypeError, Result: fmt.Sprintf("参数解析失败: %v", err)}
+		}
+	}
+	h.LogInfo(fmt.Sprintf("函数调用: %s %v", name, arguments))
+
+	ctx, cancel := context.WithTimeout(ctx, h.config.ToolCallTimeout())
+	defer cancel()
+
+	done := make(chan types.ActionResponse, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				h.LogError(fmt.Sprintf("工具%s调用发生panic: %v", name, r))
+				done <- types.ActionResponse{Action: types.ActionTypeError, Result: fmt.Sprintf("工具%s调用异常", name)}
+			}
+		}()
+		done <- h.callTool(ctx, name, arguments)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		h.LogError(fmt.Sprintf("工具%s调用超时", name))
+		return types.ActionResponse{Action: types.ActionTypeError, Result: fmt.Sprintf("工具%s调用超时", name)}
+	}
+}
+
+// callTool 按工具来源分发调用
+func (h *ConnectionHandler) callTool(ctx context.Context, name string, arguments map[string]interface{}) types.ActionResponse {
+	switch {
+	case h.mcpManager != nil && h.mcpManager.IsMCPTool(name):
+		result, err := h.mcpManager.ExecuteTool(ctx, name, arguments)
+		metrics.IncToolCall(name, "mcp", err)
+		if err != nil {
+			h.LogError(fmt.Sprintf("MCP函数调用失败: %v", err))
+			if result == nil {
+				result = "MCP工具调用失败"
+			}
+		}
+		if actionResult, ok := result.(types.ActionResponse); ok {
+			return actionResult
+		}
+		h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
+		return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: result}
+	case h.iotManager.IsIotTool(name):
+		// 处理IoT设备控制和状态查询
+		return h.handleIotToolCall(name, arguments)
+	default:
+		return types.ActionResponse{Action: types.ActionTypeNotFound, Result: fmt.Sprintf("未找到工具%s", name)}
+	}
+}
+
+// handleFunctionResult 处理工具调用结果，返回作为tool消息的文本以及是否需要再次请求LLM
+func (h *ConnectionHandler) handleFunctionResult(result types.ActionResponse, call types.ToolCall) (string, bool) {
+	switch result.Action {
+	case types.ActionTypeError:
+		h.LogError(fmt.Sprintf("函数调用错误: %v", result.Result))
+		return fmt.Sprintf("调用失败: %v", result.Result), true
+	case types.ActionTypeNotFound:
+		h.LogError(fmt.Sprintf("函数未找到: %v", result.Result))
+		return fmt.Sprintf("调用失败: %v", result.Result), true
+	case types.ActionTypeNone:
+		h.LogInfo(fmt.Sprintf("函数调用无操作: %v", result.Result))
+		return "调用工具成功: " + call.Function.Name, false
+	case types.ActionTypeResponse:
+		h.LogInfo(fmt.Sprintf("函数调用直接回复: %v", result.Response))
+		text, _ := result.Response.(string)
+		h.SystemSpeak(text)
+		return text, false
+	case types.ActionTypeCallHandler:
+		return h.handleMCPResultCall(result), false
+	case types.ActionTypeReqLLM:
+		h.LogInfo(fmt.Sprintf("函数调用后请求LLM: %v", result.Result))
+		if text, ok := result.Result.(string); ok && len(text) > 0 {
+			return text, true
+		}
+		h.LogError(fmt.Sprintf("函数调用结果解析失败: %v", result.Result))
+		errorMessage := fmt.Sprintf("函数调用结果解析失败 %v", result.Result)
+		h.SystemSpeak(errorMessage)
+		return errorMessage, false
+	default:
+		return fmt.Sprintf("未知的调用结果: %v", result.Result), false
+	}
+}
@@ -0,0 +1,291 @@
+package iot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// ToolPrefix IoT工具名前缀
+	ToolPrefix = "iot_"
+	// StateToolName 查询设备状态的工具名
+	StateToolName = ToolPrefix + "get_device_states"
+)
+
+var reToolName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Property 设备属性描述
+type Property struct {
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+// Method 设备方法描述
+type Method struct {
+	Description string              `json:"description"`
+	Parameters  map[string]Property `json:"parameters"`
+}
+
+// Descriptor 设备上报的IoT描述符
+type Descriptor struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Properties  map[string]Property `json:"properties"`
+	Methods     map[string]Method   `json:"methods"`
+}
+
+// Command 下发给设备的IoT指令
+type Command struct {
+	Name       string                 `json:"name"`
+	Method     string                 `json:"method"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+type toolRef struct {
+	device string
+	method string
+}
+
+// Manager 管理单个连接的IoT描述符、工具映射和设备状态缓存
+type Manager struct {
+	mu          sync.RWMutex
+	descriptors map[string]Descriptor
+	states      map[string]map[string]interface{}
+	tools       map[string]toolRef
+}
+
+// NewManager 创建IoT管理器
+func NewManager() *Manager {
+	return &Manager{
+		descriptors: make(map[string]Descriptor),
+		states:      make(map[string]map[string]interface{}),
+		tools:       make(map[string]toolRef),
+	}
+}
+
+// ToolName 设备方法对应的工具名
+func ToolName(device, method string) string {
+	name := ToolPrefix + strings.ToLower(device) + "_" + strings.ToLower(method)
+	name = reToolName.ReplaceAllString(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// AddDescriptors 解析设备上报的描述符，返回需要注册到FunctionRegistry的工具。
+// 同名设备的描述符会被覆盖，每次返回的工具中都包含状态查询工具。
+func (m *Manager) AddDescriptors(raw []interface{}) ([]openai.Tool, error) {
+	var descriptors []Descriptor
+	if err := convert(raw, &descriptors); err != nil {
+		return nil, fmt.Errorf("解析IoT描述符失败: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, desc := range descriptors {
+		if desc.Name == "" {
+			continue
+		}
+		m.descriptors[desc.Name] = desc
+	}
+
+	tools := make([]openai.Tool, 0)
+	m.tools = make(map[string]toolRef)
+	for _, name := range m.deviceNames() {
+		desc := m.descriptors[name]
+		for _, methodName := range sortedKeys(desc.Methods) {
+			toolName := ToolName(desc.Name, methodName)
+			m.tools[toolName] = toolRef{device: desc.Name, method: methodName}
+			tools = append(tools, methodTool(toolName, desc, methodName, desc.Methods[methodName]))
+		}
+	}
+	if len(m.descriptors) > 0 {
+		tools = append(tools, m.stateTool())
+	}
+	return tools, nil
+}
+
+// UpdateStates 缓存设备上报的最新状态，状态增量合并
+func (m *Manager) UpdateStates(raw []interface{}) error {
+	var states []struct {
+		Name  string                 `json:"name"`
+		State map[string]interface{} `json:"state"`
+	}
+	if err := convert(raw, &states); err != nil {
+		return fmt.Errorf("解析IoT状态失败: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range states {
+		if s.Name == "" {
+			continue
+		}
+		if m.states[s.Name] == nil {
+			m.states[s.Name] = make(map[string]interface{})
+		}
+		for key, value := range s.State {
+			m.states[s.Name][key] = value
+		}
+	}
+	return nil
+}
+
+// IsIotTool 判断工具是否由IoT描述符生成
+func (m *Manager) IsIotTool(name string) bool {
+	if name == StateToolName {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.tools[name]
+	return ok
+}
+
+// BuildCommand 根据工具调用生成下发给设备的指令
+func (m *Manager) BuildCommand(toolName string, arguments map[string]interface{}) (*Command, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ref, ok := m.tools[toolName]
+	if !ok {
+		return nil, fmt.Errorf("未知的IoT工具: %s", toolName)
+	}
+	method := m.descriptors[ref.device].Methods[ref.method]
+	parameters := make(map[string]interface{}, len(method.Parameters))
+	for name := range method.Parameters {
+		value, ok := arguments[name]
+		if !ok {
+			return nil, fmt.Errorf("缺少参数: %s", name)
+		}
+		parameters[name] = value
+	}
+	return &Command{Name: ref.device, Method: ref.method, Parameters: parameters}, nil
+}
+
+// QueryStates 返回缓存的设备状态描述，device为空时返回全部设备
+func (m *Manager) QueryStates(device string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sb strings.Builder
+	for _, name := range m.deviceNames() {
+		if device != "" && !strings.EqualFold(name, device) {
+			continue
+		}
+		desc := m.descriptors[name]
+		state := m.states[name]
+		sb.WriteString(fmt.Sprintf("%s(%s): ", desc.Name, desc.Description))
+		if len(state) == 0 {
+			sb.WriteString("暂无状态\n")
+			continue
+		}
+		parts := make([]string, 0, len(state))
+		for _, key := range sortedKeys(state) {
+			label := key
+			if prop, ok := desc.Properties[key]; ok && prop.Description != "" {
+				label = prop.Description
+			}
+			parts = append(parts, fmt.Sprintf("%s=%v", label, state[key]))
+		}
+		sb.WriteString(strings.Join(parts, ", "))
+		sb.WriteString("\n")
+	}
+	if sb.Len() == 0 {
+		return "没有找到设备: " + device
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func (m *Manager) deviceNames() []string {
+	return sortedKeys(m.descriptors)
+}
+
+// stateTool 查询缓存状态的工具，无需与设备交互
+func (m *Manager) stateTool() openai.Tool {
+	devices := m.deviceNames()
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        StateToolName,
+			Description: "查询物联网设备的当前状态，例如灯是否打开、当前音量、电量等",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"device": map[string]interface{}{
+						"type":        "string",
+						"description": "设备名称，不填则返回全部设备的状态",
+						"enum":        devices,
+					},
+				},
+			},
+		},
+	}
+}
+
+func methodTool(toolName string, desc Descriptor, methodName string, method Method) openai.Tool {
+	properties := make(map[string]interface{}, len(method.Parameters))
+	required := make([]string, 0, len(method.Parameters))
+	for _, name := range sortedKeys(method.Parameters) {
+		param := method.Parameters[name]
+		properties[name] = map[string]interface{}{
+			"type":        schemaType(param.Type),
+			"description": param.Description,
+		}
+		required = append(required, name)
+	}
+
+	description := fmt.Sprintf("%s - %s", desc.Description, method.Description)
+	if desc.Description == "" {
+		description = fmt.Sprintf("%s - %s", desc.Name, method.Description)
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        toolName,
+			Description: description,
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		},
+	}
+}
+
+// schemaType 设备描述符类型转换为JSON Schema类型
+func schemaType(t string) string {
+	switch strings.ToLower(t) {
+	case "number", "integer", "int", "float":
+		return "number"
+	case "boolean", "bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+func convert(raw interface{}, target interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
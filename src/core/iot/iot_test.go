@@ -0,0 +1,72 @@
+package iot
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testDescriptors = `[
+	{"name":"Lamp","description":"台灯","properties":{"power":{"description":"灯是否打开","type":"boolean"}},
+	 "methods":{"TurnOn":{"description":"打开灯","parameters":{}},"TurnOff":{"description":"关闭灯","parameters":{}}}},
+	{"name":"Speaker","description":"扬声器","properties":{"volume":{"description":"当前音量值","type":"number"}},
+	 "methods":{"SetVolume":{"description":"设置音量","parameters":{"volume":{"description":"0到100之间的整数","type":"number"}}}}}
+]`
+
+func TestManager(t *testing.T) {
+	var raw []interface{}
+	if err := json.Unmarshal([]byte(testDescriptors), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	tools, err := m.AddDescriptors(raw)
+	if err != nil {
+		t.Fatalf("AddDescriptors() error = %v", err)
+	}
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Function.Name)
+	}
+	want := "iot_lamp_turnoff,iot_lamp_turnon,iot_speaker_setvolume," + StateToolName
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("AddDescriptors() tools = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		tool    string
+		args    map[string]interface{}
+		wantErr bool
+	}{
+		{"iot_speaker_setvolume", map[string]interface{}{"volume": 30.0}, false},
+		{"iot_speaker_setvolume", map[string]interface{}{}, true},
+		{"iot_lamp_turnon", nil, false},
+		{"iot_fan_turnon", nil, true},
+	}
+	for _, tt := range tests {
+		cmd, err := m.BuildCommand(tt.tool, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("BuildCommand(%s, %v) error = %v, wantErr %v", tt.tool, tt.args, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !m.IsIotTool(tt.tool) {
+			t.Errorf("IsIotTool(%s) = false", tt.tool)
+		}
+		if cmd != nil && tt.tool == "iot_speaker_setvolume" && (cmd.Name != "Speaker" || cmd.Method != "SetVolume" || cmd.Parameters["volume"] != 30.0) {
+			t.Errorf("BuildCommand() = %+v", cmd)
+		}
+	}
+
+	states := []interface{}{
+		map[string]interface{}{"name": "Lamp", "state": map[string]interface{}{"power": true}},
+	}
+	if err := m.UpdateStates(states); err != nil {
+		t.Fatalf("UpdateStates() error = %v", err)
+	}
+	if got := m.QueryStates("lamp"); got != "Lamp(台灯): 灯是否打开=true" {
+		t.Errorf("QueryStates(lamp) = %q", got)
+	}
+	if got := m.QueryStates(""); !strings.Contains(got, "Speaker(扬声器): 暂无状态") {
+		t.Errorf("QueryStates() = %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+// Package metrics 语音链路的Prometheus指标。
+// 各模块直接调用记录函数；资源池、任务队列等状态通过注册回调在抓取时读取。
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "xiaozhi"
+
+// 延迟直方图的分桶(秒)，覆盖几十毫秒到十几秒
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 0.75, 1, 1.5, 2, 3, 5, 8, 13}
+
+var registry = prometheus.NewRegistry()
+
+var (
+	asrLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "asr_latency_seconds",
+		Help:      "ASR从开始接收音频(手动模式为停止拾音)到得到识别结果的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	llmFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_first_token_seconds",
+		Help:      "LLM请求到收到第一个回复片段的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	ttsSynthesis = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tts_synthesis_seconds",
+		Help:      "TTS合成一句话的耗时，流式合成为收到第一段音频的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	ttsFirstFrame = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tts_first_frame_seconds",
+		Help:      "从识别出用户输入到发送回复第一帧音频的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "LLM工具调用次数",
+	}, []string{"tool", "type"})
+
+	toolCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_call_errors_total",
+		Help:      "LLM工具调用失败次数",
+	}, []string{"tool", "type"})
+
+	providerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "提供者调用失败次数",
+	}, []string{"module", "provider"})
+
+	providerFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_fallbacks_total",
+		Help:      "主提供者不可用时使用备用提供者的次数",
+	}, []string{"module", "provider"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		asrLatency,
+		llmFirstToken,
+		ttsSynthesis,
+		ttsFirstFrame,
+		toolCalls,
+		toolCallErrors,
+		providerErrors,
+		providerFallbacks,
+	)
+}
+
+// Handler /metrics 抓取接口
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveASR 记录ASR识别耗时
+func ObserveASR(provider string, d time.Duration) {
+	asrLatency.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// ObserveLLMFirstToken 记录LLM首个回复片段耗时
+func ObserveLLMFirstToken(provider string, d time.Duration) {
+	llmFirstToken.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// ObserveTTSSynthesis 记录TTS合成耗时
+func ObserveTTSSynthesis(provider string, d time.Duration) {
+	ttsSynthesis.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// ObserveTTSFirstFrame 记录回复首帧音频耗时
+func ObserveTTSFirstFrame(provider string, d time.Duration) {
+	ttsFirstFrame.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// IncToolCall 记录一次工具调用，err不为空时同时计入失败次数
+func IncToolCall(tool, toolType string, err error) {
+	toolCalls.WithLabelValues(tool, toolType).Inc()
+	if err != nil {
+		toolCallErrors.WithLabelValues(tool, toolType).Inc()
+	}
+}
+
+// IncProviderError 记录一次提供者调用失败
+func IncProviderError(module, provider string) {
+	providerErrors.WithLabelValues(module, provider).Inc()
+}
+
+// IncProviderFallback 记录一次使用备用提供者
+func IncProviderFallback(module, provider string) {
+	providerFallbacks.WithLabelValues(module, provider).Inc()
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	RegisterTaskQueueStats(func() map[string]int { return map[string]int{"queued": 1} })
+	// 重复注册时替换旧的回调
+	RegisterTaskQueueStats(func() map[string]int { return map[string]int{"queued": 3} })
+	RegisterConnectionStats(func() map[string]map[string]int {
+		return map[string]map[string]int{"websocket": {"connections": 2}}
+	})
+
+	ObserveASR("DoubaoASR", 300*time.Millisecond)
+	ObserveTTSFirstFrame("EdgeTTS", time.Second)
+	IncToolCall("play_music", "mcp", nil)
+	IncToolCall("play_music", "mcp", errors.New("超时"))
+	IncProviderError("TTS", "EdgeTTS")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	output := string(body)
+
+	for _, want := range []string{
+		`xiaozhi_task_queue{stat="queued"} 3`,
+		`xiaozhi_active_connections{transport="websocket",type="connections"} 2`,
+		`xiaozhi_asr_latency_seconds_count{provider="DoubaoASR"} 1`,
+		`xiaozhi_tts_first_frame_seconds_count{provider="EdgeTTS"} 1`,
+		`xiaozhi_tool_calls_total{tool="play_music",type="mcp"} 2`,
+		`xiaozhi_tool_call_errors_total{tool="play_music",type="mcp"} 1`,
+		`xiaozhi_provider_errors_total{module="TTS",provider="EdgeTTS"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("指标输出缺少 %s", want)
+		}
+	}
+}
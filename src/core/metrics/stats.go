@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsCollector 在抓取时通过回调读取状态的仪表
+type statsCollector struct {
+	desc    *prometheus.Desc
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(func(value float64, labelValues ...string) {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value, labelValues...)
+	})
+}
+
+var (
+	statsMu         sync.Mutex
+	statsCollectors = make(map[string]*statsCollector)
+)
+
+// registerStats 注册回调仪表，同名仪表重复注册时替换旧的回调
+func registerStats(name, help string, labels []string, collect func(emit func(float64, ...string))) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if old, ok := statsCollectors[name]; ok {
+		registry.Unregister(old)
+	}
+	c := &statsCollector{
+		desc:    prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil),
+		collect: collect,
+	}
+	registry.MustRegister(c)
+	statsCollectors[name] = c
+}
+
+// registerNestedStats 注册两级标签的回调仪表
+func registerNestedStats(name, help string, labels [2]string, fn func() map[string]map[string]int) {
+	registerStats(name, help, labels[:], func(emit func(float64, ...string)) {
+		for outer, values := range fn() {
+			for inner, value := range values {
+				emit(float64(value), outer, inner)
+			}
+		}
+	})
+}
+
+// RegisterConnectionStats 各传输层的活跃连接数，fn返回 传输层 -> 类型 -> 数量
+func RegisterConnectionStats(fn func() map[string]map[string]int) {
+	registerNestedStats("active_connections", "各传输层的活跃连接数", [2]string{"transport", "type"}, fn)
+}
+
+// RegisterPoolStats 资源池统计，fn返回 模块 -> 统计项 -> 数量
+func RegisterPoolStats(fn func() map[string]map[string]int) {
+	registerNestedStats("pool_resources", "各模块资源池的资源数量", [2]string{"module", "stat"}, fn)
+}
+
+// RegisterCircuitStates 提供者熔断状态，fn返回 模块 -> 提供者 -> 状态(0正常 1熔断 2试用)
+func RegisterCircuitStates(fn func() map[string]map[string]int) {
+	registerNestedStats("provider_circuit_state", "提供者熔断状态，0正常 1熔断 2冷却结束试用", [2]string{"module", "provider"}, fn)
+}
+
+// RegisterTaskQueueStats 任务队列统计，fn返回 统计项 -> 数量
+func RegisterTaskQueueStats(fn func() map[string]int) {
+	registerStats("task_queue", "异步任务队列的深度和工作者状态", []string{"stat"}, func(emit func(float64, ...string)) {
+		for stat, value := range fn() {
+			emit(float64(value), stat)
+		}
+	})
+}
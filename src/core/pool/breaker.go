@@ -0,0 +1,95 @@
+package pool
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 60 * time.Second
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常
+	BreakerOpen     = "open"      // 熔断中，跳过该提供者
+	BreakerHalfOpen = "half_open" // 冷却结束，允许试用
+)
+
+// CircuitBreaker 提供者熔断器。
+// 连续失败达到阈值后熔断，冷却期内跳过该提供者；冷却结束后允许试用，
+// 试用成功则恢复，再次失败则重新熔断。
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// NewCircuitBreaker 创建熔断器，参数不大于0时使用默认值
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow 是否允许使用该提供者
+func (b *CircuitBreaker) Allow() bool {
+	return b.State() != BreakerOpen
+}
+
+// State 当前状态
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return BreakerClosed
+	}
+	if b.now().Before(b.openUntil) {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// Success 记录一次成功，重置失败计数
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure 记录一次失败，返回本次是否触发熔断
+func (b *CircuitBreaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures < b.threshold || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = b.now().Add(b.cooldown)
+	return true
+}
+
+// Trip 直接熔断，用于启动时连通性检查失败的提供者
+func (b *CircuitBreaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = b.threshold
+	b.openUntil = b.now().Add(b.cooldown)
+}
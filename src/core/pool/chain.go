@@ -0,0 +1,307 @@
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/metrics"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// chainMember 故障转移链中的一个提供者
+type chainMember struct {
+	name     string
+	pool     *ResourcePool
+	breaker  *CircuitBreaker
+	failures atomic.Int64 // 累计失败次数
+}
+
+// providerChain 模块的故障转移链，按配置顺序优先使用靠前的提供者
+type providerChain struct {
+	module    string
+	members   []*chainMember
+	fallbacks atomic.Int64 // 使用备用提供者的次数
+	logger    *utils.Logger
+
+	// 按需创建的提供者：已配置但不在故障转移链中，被会话指定（如用户设置）时才创建资源池，
+	// 只供指定了它的会话使用，不作为其他会话的备用提供者
+	newMember func(name string) (*chainMember, error) // 为nil时不按需创建
+	extrasMu  sync.Mutex
+	extras    map[string]*chainMember
+}
+
+// ProviderStatus 提供者的熔断状态和资源池统计
+type ProviderStatus struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Failures  int64  `json:"failures"`
+	Available int    `json:"available"`
+	Total     int    `json:"total"`
+}
+
+// FailoverStats 模块的故障转移统计
+type FailoverStats struct {
+	Providers []ProviderStatus `json:"providers"`
+	Fallbacks int64            `json:"fallbacks"`
+}
+
+// createProviderChain 按selected_module和fallback_module创建模块的故障转移链，未配置该模块时返回nil。
+// 单个提供者的资源池创建失败时跳过该提供者，全部失败才返回错误。
+func createProviderChain(module string, config *configs.Config, poolConfig PoolConfig, logger *utils.Logger) (*providerChain, error) {
+	names := config.ModuleChain(module)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	cooldown := time.Duration(config.CircuitBreaker.Cooldown) * time.Second
+	newMember := func(name string) (*chainMember, error) {
+		pool, err := createProviderPool(module, name, config, poolConfig, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &chainMember{
+			name:    name,
+			pool:    pool,
+			breaker: NewCircuitBreaker(config.CircuitBreaker.FailureThreshold, cooldown),
+		}, nil
+	}
+	chain := &providerChain{
+		module: module,
+		logger: logger,
+		newMember: func(name string) (*chainMember, error) {
+			if !config.HasProvider(module, name) {
+				return nil, fmt.Errorf("找不到配置 %s", name)
+			}
+			return newMember(name)
+		},
+	}
+	var errs []string
+	for _, name := range names {
+		member, err := newMember(name)
+		if err != nil {
+			logger.Error("%s提供者 %s 资源池创建失败，已从故障转移链中跳过: %v", module, name, err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		chain.members = append(chain.members, member)
+	}
+	if len(chain.members) == 0 {
+		return nil, fmt.Errorf("%s没有可用的提供者: %s", module, strings.Join(errs, "; "))
+	}
+	if len(names) > 1 {
+		logger.Info("%s故障转移链: %v", module, chain.names())
+	}
+	return chain, nil
+}
+
+// acquire 从最健康的提供者获取资源，preferred为已配置的提供者时优先使用，不可用时按故障转移链的顺序。
+// 按顺序跳过熔断中的提供者；全部熔断时仍按顺序尝试，避免直接拒绝服务。
+func (c *providerChain) acquire(preferred string) (interface{}, *chainMember, error) {
+	members := c.ordered(preferred)
+	var errs []string
+	tried := make(map[*chainMember]bool, len(members))
+	for _, allowOpen := range []bool{false, true} {
+		for _, member := range members {
+			if tried[member] || (!allowOpen && !member.breaker.Allow()) {
+				continue
+			}
+			tried[member] = true
+
+			resource, err := member.pool.Get()
+			if err != nil {
+				c.recordFailure(member, err)
+				errs = append(errs, fmt.Sprintf("%s: %v", member.name, err))
+				continue
+			}
+			if member != members[0] {
+				c.fallbacks.Add(1)
+				metrics.IncProviderFallback(c.module, member.name)
+				c.logger.Warn("%s主提供者 %s 不可用，使用备用提供者 %s", c.module, members[0].name, member.name)
+			}
+			return resource, member, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("所有%s提供者均不可用: %s", c.module, strings.Join(errs, "; "))
+}
+
+// next 当前提供者调用失败时，按故障转移链的顺序从其他未熔断的提供者获取资源
+func (c *providerChain) next(current *chainMember) (interface{}, *chainMember, error) {
+	var errs []string
+	for _, member := range c.members {
+		if member == current || !member.breaker.Allow() {
+			continue
+		}
+		resource, err := member.pool.Get()
+		if err != nil {
+			c.recordFailure(member, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", member.name, err))
+			continue
+		}
+		c.fallbacks.Add(1)
+		metrics.IncProviderFallback(c.module, member.name)
+		c.logger.Warn("%s提供者 %s 调用失败，切换到备用提供者 %s", c.module, current.name, member.name)
+		return resource, member, nil
+	}
+	if len(errs) == 0 {
+		return nil, nil, fmt.Errorf("没有其他可用的%s提供者", c.module)
+	}
+	return nil, nil, fmt.Errorf("没有其他可用的%s提供者: %s", c.module, strings.Join(errs, "; "))
+}
+
+// release 将资源重置后归还到提供者的资源池
+func (c *providerChain) release(member *chainMember, resource interface{}) {
+	if err := member.pool.Reset(resource); err != nil {
+		c.logger.Warn("重置%s资源状态失败: %v", c.module, err)
+	}
+	if err := member.pool.Put(resource); err != nil {
+		c.logger.Error("归还%s提供者 %s 失败: %v", c.module, member.name, err)
+	}
+}
+
+// ordered 提供者的尝试顺序，preferred排在最前，其余按配置顺序
+func (c *providerChain) ordered(preferred string) []*chainMember {
+	first := c.member(preferred)
+	if first == nil && preferred != "" {
+		first = c.extra(preferred)
+	}
+	if first == nil || first == c.members[0] {
+		return c.members
+	}
+	members := make([]*chainMember, 0, len(c.members))
+	members = append(members, first)
+	for _, member := range c.members {
+		if member != first {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// recordFailure 记录提供者失败，触发熔断时输出日志
+func (c *providerChain) recordFailure(member *chainMember, err error) {
+	member.failures.Add(1)
+	metrics.IncProviderError(c.module, member.name)
+	if member.breaker.Failure() {
+		c.logger.Warn("%s提供者 %s 连续失败已熔断，冷却期内将跳过: %v", c.module, member.name, err)
+	}
+}
+
+// recordSuccess 记录提供者成功，熔断恢复时输出日志
+func (c *providerChain) recordSuccess(member *chainMember) {
+	if member.breaker.State() != BreakerClosed {
+		c.logger.Info("%s提供者 %s 已恢复", c.module, member.name)
+	}
+	member.breaker.Success()
+}
+
+// member 按名称查找提供者
+func (c *providerChain) member(name string) *chainMember {
+	for _, member := range c.members {
+		if member.name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// extra 获取按需创建的提供者，首次指定时创建资源池，创建失败时返回nil
+func (c *providerChain) extra(name string) *chainMember {
+	if c.newMember == nil {
+		return nil
+	}
+	c.extrasMu.Lock()
+	defer c.extrasMu.Unlock()
+	if member := c.extras[name]; member != nil {
+		return member
+	}
+	member, err := c.newMember(name)
+	if err != nil {
+		c.logger.Warn("%s提供者 %s 不可用，使用故障转移链中的提供者: %v", c.module, name, err)
+		return nil
+	}
+	if c.extras == nil {
+		c.extras = make(map[string]*chainMember)
+	}
+	c.extras[name] = member
+	c.logger.Info("已按需创建%s提供者 %s 的资源池", c.module, name)
+	return member
+}
+
+// all 故障转移链中的提供者和按需创建的提供者
+func (c *providerChain) all() []*chainMember {
+	c.extrasMu.Lock()
+	defer c.extrasMu.Unlock()
+	names := make([]string, 0, len(c.extras))
+	for name := range c.extras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	members := append([]*chainMember(nil), c.members...)
+	for _, name := range names {
+		members = append(members, c.extras[name])
+	}
+	return members
+}
+
+func (c *providerChain) names() []string {
+	names := make([]string, 0, len(c.members))
+	for _, member := range c.members {
+		names = append(names, member.name)
+	}
+	return names
+}
+
+// stats 汇总链中所有提供者的资源池统计
+func (c *providerChain) stats() (available, total int) {
+	for _, member := range c.all() {
+		a, t := member.pool.GetStats()
+		available += a
+		total += t
+	}
+	return available, total
+}
+
+// detailedStats 汇总链中所有提供者的资源池详细统计
+func (c *providerChain) detailedStats() map[string]int {
+	stats := make(map[string]int)
+	for _, member := range c.all() {
+		for key, value := range member.pool.GetDetailedStats() {
+			stats[key] += value
+		}
+	}
+	return stats
+}
+
+// failoverStats 链的熔断和故障转移统计
+func (c *providerChain) failoverStats() FailoverStats {
+	stats := FailoverStats{Fallbacks: c.fallbacks.Load()}
+	for _, member := range c.all() {
+		available, total := member.pool.GetStats()
+		stats.Providers = append(stats.Providers, ProviderStatus{
+			Name:      member.name,
+			State:     member.breaker.State(),
+			Failures:  member.failures.Load(),
+			Available: available,
+			Total:     total,
+		})
+	}
+	return stats
+}
+
+// close 关闭链中所有资源池
+func (c *providerChain) close() {
+	for _, member := range c.all() {
+		member.pool.Close()
+	}
+}
+
+// drain 排空链中所有资源池
+func (c *providerChain) drain() {
+	for _, member := range c.all() {
+		member.pool.Drain()
+	}
+}
@@ -0,0 +1,248 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// fakeFactory 按名称创建资源，fail为true时创建失败，tts为true时创建TTS提供者
+type fakeFactory struct {
+	name string
+	fail bool
+	tts  bool
+}
+
+func (f *fakeFactory) Create() (interface{}, error) {
+	if f.fail {
+		return nil, errors.New("服务不可用")
+	}
+	if f.tts {
+		return &fakeTTS{name: f.name}, nil
+	}
+	return f.name, nil
+}
+
+func (f *fakeFactory) Destroy(resource interface{}) error { return nil }
+
+type fakeTTS struct{ name string }
+
+func (p *fakeTTS) Initialize() error                 { return nil }
+func (p *fakeTTS) Cleanup() error                    { return nil }
+func (p *fakeTTS) ToTTS(text string) (string, error) { return "", nil }
+func (p *fakeTTS) SetVoice(voice string) error       { return nil }
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		action    func()
+		wantState string
+	}{
+		{"初始状态", func() {}, BreakerClosed},
+		{"失败一次", func() { b.Failure() }, BreakerClosed},
+		{"达到阈值熔断", func() { b.Failure() }, BreakerOpen},
+		{"冷却结束允许试用", func() { now = now.Add(time.Minute) }, BreakerHalfOpen},
+		{"试用失败重新熔断", func() { b.Failure() }, BreakerOpen},
+		{"冷却结束试用成功", func() { now = now.Add(time.Minute); b.Success() }, BreakerClosed},
+		{"直接熔断", func() { b.Trip() }, BreakerOpen},
+	}
+	for _, step := range steps {
+		step.action()
+		if got := b.State(); got != step.wantState {
+			t.Fatalf("%s: State() = %s, want %s", step.name, got, step.wantState)
+		}
+	}
+}
+
+func TestProviderChainAcquire(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	primary := &fakeFactory{name: "DoubaoTTS"}
+	chain := &providerChain{module: "TTS", logger: logger}
+	for _, factory := range []*fakeFactory{primary, {name: "EdgeTTS"}} {
+		pool, err := NewResourcePool(factory.name, factory, PoolConfig{MaxSize: 2, CheckInterval: time.Hour}, logger)
+		if err != nil {
+			t.Fatalf("NewResourcePool() error = %v", err)
+		}
+		defer pool.Close()
+		chain.members = append(chain.members, &chainMember{
+			name:    factory.name,
+			pool:    pool,
+			breaker: NewCircuitBreaker(1, time.Minute),
+		})
+	}
+
+	acquireFrom := func(preferred string) string {
+		resource, member, err := chain.acquire(preferred)
+		if err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+		member.pool.Put(resource)
+		return member.name
+	}
+	acquire := func() string { return acquireFrom("") }
+
+	if got := acquire(); got != "DoubaoTTS" {
+		t.Errorf("acquire() = %s, want DoubaoTTS", got)
+	}
+
+	// 指定的提供者优先使用，不计为故障转移；不在链中时按配置顺序
+	if got := acquireFrom("EdgeTTS"); got != "EdgeTTS" {
+		t.Errorf("acquire(EdgeTTS) = %s, want EdgeTTS", got)
+	}
+	if got := acquireFrom("AliyunTTS"); got != "DoubaoTTS" {
+		t.Errorf("acquire(AliyunTTS) = %s, want DoubaoTTS", got)
+	}
+	if stats := chain.failoverStats(); stats.Fallbacks != 0 {
+		t.Errorf("指定提供者时Fallbacks = %d, want 0", stats.Fallbacks)
+	}
+
+	// 主提供者熔断后切换到备用提供者
+	chain.recordFailure(chain.members[0], errors.New("合成失败"))
+	if got := acquire(); got != "EdgeTTS" {
+		t.Errorf("熔断后acquire() = %s, want EdgeTTS", got)
+	}
+	if stats := chain.failoverStats(); stats.Fallbacks != 1 || stats.Providers[0].State != BreakerOpen {
+		t.Errorf("failoverStats() = %+v", stats)
+	}
+
+	// 全部熔断时仍按顺序尝试
+	chain.recordFailure(chain.members[1], errors.New("合成失败"))
+	if got := acquire(); got != "DoubaoTTS" {
+		t.Errorf("全部熔断时acquire() = %s, want DoubaoTTS", got)
+	}
+
+	// 资源创建失败时计入失败并切换
+	chain.recordSuccess(chain.members[0])
+	chain.members[0].pool.destroyIdle()
+	primary.fail = true
+	if got := acquire(); got != "EdgeTTS" {
+		t.Errorf("创建失败时acquire() = %s, want EdgeTTS", got)
+	}
+	if chain.members[0].breaker.State() != BreakerOpen {
+		t.Errorf("创建失败后主提供者应熔断")
+	}
+}
+
+func TestProviderChainOnDemand(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	created := 0
+	newMember := func(name string) (*chainMember, error) {
+		if name != "AliyunTTS" {
+			return nil, errors.New("找不到配置 " + name)
+		}
+		created++
+		pool, err := NewResourcePool(name, &fakeFactory{name: name}, PoolConfig{MaxSize: 2, CheckInterval: time.Hour}, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &chainMember{name: name, pool: pool, breaker: NewCircuitBreaker(1, time.Minute)}, nil
+	}
+	pool, err := NewResourcePool("DoubaoTTS", &fakeFactory{name: "DoubaoTTS"}, PoolConfig{MaxSize: 2, CheckInterval: time.Hour}, logger)
+	if err != nil {
+		t.Fatalf("NewResourcePool() error = %v", err)
+	}
+	primary := &chainMember{name: "DoubaoTTS", pool: pool, breaker: NewCircuitBreaker(1, time.Minute)}
+	chain := &providerChain{module: "TTS", logger: logger, members: []*chainMember{primary}, newMember: newMember}
+	defer chain.close()
+
+	acquireFrom := func(preferred string) string {
+		resource, member, err := chain.acquire(preferred)
+		if err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+		member.pool.Put(resource)
+		return member.name
+	}
+
+	// 不在链中的已配置提供者按需创建资源池，只创建一次
+	for i := 0; i < 2; i++ {
+		if got := acquireFrom("AliyunTTS"); got != "AliyunTTS" {
+			t.Errorf("acquire(AliyunTTS) = %s, want AliyunTTS", got)
+		}
+	}
+	if created != 1 {
+		t.Errorf("按需创建次数 = %d, want 1", created)
+	}
+	if got := acquireFrom("MissingTTS"); got != "DoubaoTTS" {
+		t.Errorf("acquire(MissingTTS) = %s, want DoubaoTTS", got)
+	}
+
+	// 按需创建的提供者不作为其他会话的备用提供者
+	chain.recordFailure(primary, errors.New("合成失败"))
+	if got := acquireFrom(""); got != "DoubaoTTS" {
+		t.Errorf("主提供者熔断时acquire() = %s, want DoubaoTTS", got)
+	}
+	if stats := chain.failoverStats(); len(stats.Providers) != 2 || stats.Providers[1].Name != "AliyunTTS" || stats.Fallbacks != 0 {
+		t.Errorf("failoverStats() = %+v", stats)
+	}
+}
+
+func TestProviderSetFailover(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	chain := &providerChain{module: "TTS", logger: logger}
+	for _, name := range []string{"DoubaoTTS", "EdgeTTS", "AliyunTTS"} {
+		pool, err := NewResourcePool(name, &fakeFactory{name: name, tts: true}, PoolConfig{MaxSize: 2, CheckInterval: time.Hour}, logger)
+		if err != nil {
+			t.Fatalf("NewResourcePool() error = %v", err)
+		}
+		chain.members = append(chain.members, &chainMember{name: name, pool: pool, breaker: NewCircuitBreaker(1, time.Minute)})
+	}
+	defer chain.close()
+
+	resource, member, err := chain.acquire("")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	set := &ProviderSet{
+		TTS:     resource.(*fakeTTS),
+		chains:  map[string]*providerChain{"TTS": chain},
+		members: map[string]*chainMember{"TTS": member},
+	}
+
+	// 调用失败后切换到下一个健康的提供者，原提供者归还到其资源池
+	set.ReportResult("TTS", errors.New("合成失败"))
+	next, err := set.Failover("TTS")
+	if err != nil {
+		t.Fatalf("Failover() error = %v", err)
+	}
+	if next.(*fakeTTS).name != "EdgeTTS" || set.TTS != next || set.ProviderName("TTS") != "EdgeTTS" {
+		t.Errorf("Failover() = %v, ProviderName() = %s, want EdgeTTS", next, set.ProviderName("TTS"))
+	}
+	if available, _ := chain.members[0].pool.GetStats(); available != 1 {
+		t.Errorf("原提供者未归还到资源池: available = %d", available)
+	}
+	if stats := chain.failoverStats(); stats.Fallbacks != 1 {
+		t.Errorf("failoverStats().Fallbacks = %d, want 1", stats.Fallbacks)
+	}
+
+	// 其他提供者都已熔断时不切换
+	chain.members[2].breaker.Trip()
+	set.ReportResult("TTS", errors.New("合成失败"))
+	if _, err := set.Failover("TTS"); err == nil || set.ProviderName("TTS") != "EdgeTTS" {
+		t.Errorf("Failover() 没有健康的提供者时 = %v, ProviderName() = %s", err, set.ProviderName("TTS"))
+	}
+	if _, err := set.Failover("LLM"); err == nil {
+		t.Errorf("Failover(LLM) 应返回错误")
+	}
+}
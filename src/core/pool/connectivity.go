@@ -114,6 +114,7 @@ type HealthChecker struct {
 	logger        *utils.Logger
 	testGenerator *TestDataGenerator
 	results       map[string]*CheckResult
+	failed        map[string][]string // 各模块检查未通过的提供者
 }
 
 // NewHealthChecker 创建健康检查器
@@ -132,6 +133,7 @@ func NewHealthChecker(
 		logger:        logger,
 		testGenerator: NewTestDataGenerator(connConfig.TestModes),
 		results:       make(map[string]*CheckResult),
+		failed:        make(map[string][]string),
 	}
 }
 
@@ -148,36 +150,27 @@ func (hc *HealthChecker) CheckAllProviders(ctx context.Context, mode CheckMode)
 	}
 	hc.logger.Info("开始执行%s检查...", checkTypeName)
 
-	selectedModule := hc.config.SelectedModule
 	var allErrors []error
 
 	// 检查ASR
-	if asrType, ok := selectedModule["ASR"]; ok && asrType != "" {
-		if err := hc.checkASRProvider(ctx, asrType, mode); err != nil {
-			allErrors = append(allErrors, fmt.Errorf("ASR%s检查失败: %v", checkTypeName, err))
-		}
+	if err := hc.checkChain(ctx, "ASR", mode, hc.checkASRProvider); err != nil {
+		allErrors = append(allErrors, fmt.Errorf("ASR%s检查失败: %v", checkTypeName, err))
 	}
 
 	// 检查LLM
-	if llmType, ok := selectedModule["LLM"]; ok && llmType != "" {
-		if err := hc.checkLLMProvider(ctx, llmType, mode); err != nil {
-			allErrors = append(allErrors, fmt.Errorf("LLM%s检查失败: %v", checkTypeName, err))
-		}
+	if err := hc.checkChain(ctx, "LLM", mode, hc.checkLLMProvider); err != nil {
+		allErrors = append(allErrors, fmt.Errorf("LLM%s检查失败: %v", checkTypeName, err))
 	}
 
 	// 检查TTS
-	if ttsType, ok := selectedModule["TTS"]; ok && ttsType != "" {
-		if err := hc.checkTTSProvider(ctx, ttsType, mode); err != nil {
-			allErrors = append(allErrors, fmt.Errorf("TTS%s检查失败: %v", checkTypeName, err))
-		}
+	if err := hc.checkChain(ctx, "TTS", mode, hc.checkTTSProvider); err != nil {
+		allErrors = append(allErrors, fmt.Errorf("TTS%s检查失败: %v", checkTypeName, err))
 	}
 
 	// 检查VLLLM（可选）
-	if vlllmType, ok := selectedModule["VLLLM"]; ok && vlllmType != "" {
-		if err := hc.checkVLLLMProvider(ctx, vlllmType, mode); err != nil {
-			hc.logger.Warn("VLLLM%s检查失败，将继续使用普通LLM: %v", checkTypeName, err)
-			// VLLLM是可选的，失败不会导致整体失败
-		}
+	if err := hc.checkChain(ctx, "VLLLM", mode, hc.checkVLLLMProvider); err != nil {
+		hc.logger.Warn("VLLLM%s检查失败，将继续使用普通LLM: %v", checkTypeName, err)
+		// VLLLM是可选的，失败不会导致整体失败
 	}
 
 	if len(allErrors) > 0 {
@@ -192,6 +185,45 @@ func (hc *HealthChecker) CheckAllProviders(ctx context.Context, mode CheckMode)
 	return nil
 }
 
+// checkChain 检查模块故障转移链中的所有提供者，至少一个通过即视为模块可用
+func (hc *HealthChecker) checkChain(
+	ctx context.Context,
+	module string,
+	mode CheckMode,
+	check func(context.Context, string, CheckMode) error,
+) error {
+	names := hc.config.ModuleChain(module)
+	var errs []string
+	for _, name := range names {
+		err := check(ctx, name, mode)
+		// 多个提供者时按名称区分检查结果
+		if len(names) > 1 {
+			if result, ok := hc.results[module]; ok {
+				delete(hc.results, module)
+				hc.results[module+"("+name+")"] = result
+			}
+		}
+		if err != nil {
+			hc.failed[module] = append(hc.failed[module], name)
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) < len(names) {
+		hc.logger.Warn("%s部分提供者检查未通过，将使用备用提供者: %s", module, strings.Join(errs, "; "))
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// FailedProviders 获取各模块检查未通过的提供者
+func (hc *HealthChecker) FailedProviders() map[string][]string {
+	return hc.failed
+}
+
 // checkASRProvider 检查ASR提供者
 func (hc *HealthChecker) checkASRProvider(
 	ctx context.Context,
@@ -128,6 +128,11 @@ func NewTTSFactory(ttsType string, config *configs.Config, logger *utils.Logger)
 				AppID:           ttsCfg.AppID,
 				Token:           ttsCfg.Token,
 				Cluster:         ttsCfg.Cluster,
+				URL:             ttsCfg.URL,
+				APIKey:          ttsCfg.APIKey,
+				Model:           ttsCfg.Model,
+				Speed:           ttsCfg.Speed,
+				ResponseFormat:  ttsCfg.ResponseFormat,
 				SupportedVoices: ttsCfg.SupportedVoices,
 			},
 			logger: logger,
@@ -3,6 +3,9 @@ package pool
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core/mcp"
@@ -13,14 +16,15 @@ import (
 
 // PoolManager 资源池管理器
 type PoolManager struct {
-	asrPool   *ResourcePool
-	llmPool   *ResourcePool
-	ttsPool   *ResourcePool
-	vlllmPool *ResourcePool
-	mcpPool   *ResourcePool
-	logger    *utils.Logger
+	chains  map[string]*providerChain // ASR/LLM/TTS/VLLLM的故障转移链
+	mcpPool *ResourcePool
+	logger  *utils.Logger
+	mu      sync.RWMutex // 保护故障转移链和MCP池指针，配置重载时替换
 }
 
+// 按故障转移链管理的模块
+var chainModules = []string{"ASR", "LLM", "TTS", "VLLLM"}
+
 // ProviderSet 提供者集合
 type ProviderSet struct {
 	ASR   providers.ASRProvider
@@ -28,158 +32,338 @@ type ProviderSet struct {
 	TTS   providers.TTSProvider
 	VLLLM *vlllm.Provider
 	MCP   *mcp.Manager
+
+	// 提供者来源的故障转移链和资源池，配置重载后归还到旧池时直接销毁
+	mu      sync.Mutex // 保护members和提供者字段，调用失败时会在连接的其他goroutine中切换提供者
+	chains  map[string]*providerChain
+	members map[string]*chainMember
+	mcpPool *ResourcePool
+}
+
+// member 模块当前使用的提供者
+func (set *ProviderSet) member(module string) *chainMember {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.members[module]
+}
+
+// ProviderName 模块当前使用的提供者配置名称，未使用该模块时返回空
+func (set *ProviderSet) ProviderName(module string) string {
+	if set == nil {
+		return ""
+	}
+	if member := set.member(module); member != nil {
+		return member.name
+	}
+	return ""
+}
+
+// ReportResult 上报提供者的调用结果，用于熔断判断
+func (set *ProviderSet) ReportResult(module string, err error) {
+	if set == nil || set.chains[module] == nil {
+		return
+	}
+	member := set.member(module)
+	if member == nil {
+		return
+	}
+	if err != nil {
+		set.chains[module].recordFailure(member, err)
+	} else {
+		set.chains[module].recordSuccess(member)
+	}
+}
+
+// Failover 当前提供者调用失败时切换到故障转移链中下一个健康的提供者，返回新的提供者。
+// 原提供者归还到其资源池，调用方需先上报失败，并在切换后改用返回的提供者。仅支持ASR和TTS
+func (set *ProviderSet) Failover(module string) (interface{}, error) {
+	if set == nil || set.chains[module] == nil || (module != "ASR" && module != "TTS") {
+		return nil, fmt.Errorf("%s不支持切换提供者", module)
+	}
+	set.mu.Lock()
+	current := set.members[module]
+	if current == nil {
+		set.mu.Unlock()
+		return nil, fmt.Errorf("%s没有正在使用的提供者", module)
+	}
+	resource, member, err := set.chains[module].next(current)
+	if err != nil {
+		set.mu.Unlock()
+		return nil, err
+	}
+
+	var previous interface{}
+	switch module {
+	case "ASR":
+		previous = set.ASR
+		set.ASR = resource.(providers.ASRProvider)
+	case "TTS":
+		previous = set.TTS
+		set.TTS = resource.(providers.TTSProvider)
+	}
+	set.members[module] = member
+	set.mu.Unlock()
+
+	set.chains[module].release(current, previous)
+	return resource, nil
 }
 
 // NewPoolManager 创建资源池管理器
 func NewPoolManager(config *configs.Config, logger *utils.Logger) (*PoolManager, error) {
 	pm := &PoolManager{
+		chains: make(map[string]*providerChain),
 		logger: logger,
 	}
 
 	// 执行连通性检查
-	if err := pm.performConnectivityCheck(config, logger); err != nil {
+	failed, err := pm.performConnectivityCheck(config, logger)
+	if err != nil {
 		return nil, fmt.Errorf("资源连通性检查失败: %v", err)
 	}
 
+	poolConfig := providerPoolConfig(config)
+
+	// 初始化ASR、LLM、TTS故障转移链
+	for _, module := range []string{"ASR", "LLM", "TTS"} {
+		chain, err := createProviderChain(module, config, poolConfig, logger)
+		if err != nil {
+			return nil, err
+		}
+		if chain != nil {
+			pm.chains[module] = chain
+		}
+	}
+
+	// 初始化VLLLM故障转移链（可选）
+	if len(config.ModuleChain("VLLLM")) > 0 {
+		chain, err := createProviderChain("VLLLM", config, poolConfig, logger)
+		if err != nil {
+			logger.Warn("初始化VLLLM资源池失败（将继续使用普通LLM）: %v", err)
+		}
+		if chain == nil {
+			logger.Warn("VLLLM资源池未初始化，将使用普通LLM")
+		} else {
+			pm.chains["VLLLM"] = chain
+		}
+	}
+
+	// 连通性检查失败的提供者直接熔断，新会话优先使用备用提供者
+	for module, names := range failed {
+		for _, name := range names {
+			if chain := pm.chains[module]; chain != nil {
+				if member := chain.member(name); member != nil {
+					member.breaker.Trip()
+					logger.Warn("%s提供者 %s 连通性检查未通过，已熔断", module, name)
+				}
+			}
+		}
+	}
+
+	// 初始化MCP池（总是初始化，因为MCP是核心功能）
+	logger.Info("开始初始化MCP资源池，请等待...")
+	pm.mcpPool, err = createMCPPool(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return pm, nil
+}
+
+// providerPoolConfig 提供者资源池配置
+func providerPoolConfig(config *configs.Config) PoolConfig {
 	interval := config.PoolConfig.PoolCheckInterval
 	if interval <= 0 {
 		interval = 30
 	}
-	poolConfig := PoolConfig{
+	return PoolConfig{
 		MinSize:       config.PoolConfig.PoolMinSize,
 		MaxSize:       config.PoolConfig.PoolMaxSize,
 		RefillSize:    config.PoolConfig.PoolRefillSize,
 		CheckInterval: time.Duration(interval) * time.Second,
 	}
+}
 
-	// 检查配置是否包含所需的模块
-	selectedModule := config.SelectedModule
+// createProviderPool 创建ASR/LLM/TTS/VLLLM中指定配置的提供者资源池
+func createProviderPool(module, name string, config *configs.Config, poolConfig PoolConfig, logger *utils.Logger) (*ResourcePool, error) {
+	var factory ResourceFactory
+	var poolName string
+	switch module {
+	case "ASR":
+		factory, poolName = NewASRFactory(name, config, logger), "asrPool"
+	case "LLM":
+		factory, poolName = NewLLMFactory(name, config, logger), "llmPool"
+	case "TTS":
+		factory, poolName = NewTTSFactory(name, config, logger), "ttsPool"
+	case "VLLLM":
+		factory, poolName = NewVLLLMFactory(name, config, logger), "vllmPool"
+	default:
+		return nil, fmt.Errorf("未知的模块类型: %s", module)
+	}
+	if factory == nil {
+		return nil, fmt.Errorf("创建%s工厂失败: 找不到配置 %s", module, name)
+	}
+
+	pool, err := NewResourcePool(poolName+"("+name+")", factory, poolConfig, logger)
+	if err != nil {
+		return nil, fmt.Errorf("初始化%s资源池失败: %v", module, err)
+	}
+	_, cnt := pool.GetStats()
+	logger.Info("%s资源池初始化成功，类型: %s, 数量：%d", module, name, cnt)
+	return pool, nil
+}
 
-	// 初始化ASR池
-	if asrType, ok := selectedModule["ASR"]; ok && asrType != "" {
-		asrFactory := NewASRFactory(asrType, config, logger)
-		if asrFactory == nil {
-			return nil, fmt.Errorf("创建ASR工厂失败: 找不到配置 %s", asrType)
-		}
-		asrPool, err := NewResourcePool("asrPool", asrFactory, poolConfig, logger)
-		if err != nil {
-			return nil, fmt.Errorf("初始化ASR资源池失败: %v", err)
-		}
-		pm.asrPool = asrPool
-		_, cnt := asrPool.GetStats()
-		logger.Info("ASR资源池初始化成功，类型: %s, 数量：%d", asrType, cnt)
+// createMCPPool 创建MCP资源池
+func createMCPPool(config *configs.Config, logger *utils.Logger) (*ResourcePool, error) {
+	poolConfig := PoolConfig{
+		MinSize:       config.McpPoolConfig.PoolMinSize,
+		MaxSize:       config.McpPoolConfig.PoolMaxSize,
+		RefillSize:    config.McpPoolConfig.PoolRefillSize,
+		CheckInterval: time.Duration(config.McpPoolConfig.PoolCheckInterval) * time.Second,
 	}
 
-	// 初始化LLM池
-	if llmType, ok := selectedModule["LLM"]; ok && llmType != "" {
-		llmFactory := NewLLMFactory(llmType, config, logger)
-		if llmFactory == nil {
-			return nil, fmt.Errorf("创建LLM工厂失败: 找不到配置 %s", llmType)
-		}
-		llmPool, err := NewResourcePool("llmPool", llmFactory, poolConfig, logger)
-		if err != nil {
-			return nil, fmt.Errorf("初始化LLM资源池失败: %v", err)
-		}
-		pm.llmPool = llmPool
-		_, cnt := llmPool.GetStats()
-		logger.Info("LLM资源池初始化成功，类型: %s, 数量：%d", llmType, cnt)
+	mcpFactory := NewMCPFactory(config, logger)
+	if mcpFactory == nil {
+		logger.Warn("创建MCP工厂失败，MCP功能将不可用")
+		return nil, nil
+	}
+	mcpPool, err := NewResourcePool("mcpPool", mcpFactory, poolConfig, logger)
+	if err != nil {
+		return nil, fmt.Errorf("初始化MCP资源池失败: %v", err)
 	}
+	_, cnt := mcpPool.GetStats()
+	logger.Info("MCP资源池初始化成功，数量：%d", cnt)
+	return mcpPool, nil
+}
+
+// Reload 根据新配置重建发生变化的资源池。
+// 新会话从新池获取提供者；旧池立即释放空闲资源，正在使用的提供者在会话结束归还时销毁。
+// 某个池重建失败时保留旧池继续服务。
+func (pm *PoolManager) Reload(newCfg, oldCfg *configs.Config) error {
+	var errs []error
+	poolConfig := providerPoolConfig(newCfg)
+	poolConfigChanged := !reflect.DeepEqual(newCfg.PoolConfig, oldCfg.PoolConfig) ||
+		!reflect.DeepEqual(newCfg.CircuitBreaker, oldCfg.CircuitBreaker)
 
-	// 初始化TTS池
-	if ttsType, ok := selectedModule["TTS"]; ok && ttsType != "" {
-		ttsFactory := NewTTSFactory(ttsType, config, logger)
-		if ttsFactory == nil {
-			return nil, fmt.Errorf("创建TTS工厂失败: 找不到配置 %s", ttsType)
+	for _, module := range chainModules {
+		if !poolConfigChanged && !moduleConfigChanged(module, newCfg, oldCfg) {
+			continue
 		}
-		ttsPool, err := NewResourcePool("ttsPool", ttsFactory, poolConfig, logger)
+		chain, err := createProviderChain(module, newCfg, poolConfig, pm.logger)
 		if err != nil {
-			return nil, fmt.Errorf("初始化TTS资源池失败: %v", err)
+			pm.logger.Error("重建%s资源池失败，继续使用旧资源池: %v", module, err)
+			errs = append(errs, err)
+			continue
 		}
-		pm.ttsPool = ttsPool
-		_, cnt := ttsPool.GetStats()
-		logger.Info("TTS资源池初始化成功，类型: %s, 数量：%d", ttsType, cnt)
+		pm.swapChain(module, chain)
 	}
 
-	// 初始化VLLLM池（可选）
-	if vlllmType, ok := selectedModule["VLLLM"]; ok && vlllmType != "" {
-		vlllmFactory := NewVLLLMFactory(vlllmType, config, logger)
-		if vlllmFactory == nil {
-			logger.Warn("创建VLLLM工厂失败: 找不到配置 %s", vlllmType)
-		} else {
-			vlllmPool, err := NewResourcePool("vllmPool", vlllmFactory, poolConfig, logger)
-			if err != nil {
-				logger.Warn("初始化VLLLM资源池失败（将继续使用普通LLM）: %v", err)
-			} else {
-				pm.vlllmPool = vlllmPool
-			}
-		}
-		if pm.vlllmPool != nil {
-			_, cnt := pm.vlllmPool.GetStats()
-			logger.Info("VLLLM资源池初始化成功，类型: %s, 数量：%d", vlllmType, cnt)
+	if !reflect.DeepEqual(newCfg.McpPoolConfig, oldCfg.McpPoolConfig) ||
+		!reflect.DeepEqual(newCfg.LocalMCPFun, oldCfg.LocalMCPFun) ||
+		!reflect.DeepEqual(newCfg.Roles, oldCfg.Roles) {
+		pool, err := createMCPPool(newCfg, pm.logger)
+		if err != nil {
+			pm.logger.Error("重建MCP资源池失败，继续使用旧资源池: %v", err)
+			errs = append(errs, err)
 		} else {
-			logger.Warn("VLLLM资源池未初始化，将使用普通LLM")
+			pm.swapMCPPool(pool)
 		}
 	}
 
-	poolConfig = PoolConfig{
-		MinSize:       config.McpPoolConfig.PoolMinSize,
-		MaxSize:       config.McpPoolConfig.PoolMaxSize,
-		RefillSize:    config.McpPoolConfig.PoolRefillSize,
-		CheckInterval: time.Duration(config.McpPoolConfig.PoolCheckInterval) * time.Second,
+	if len(errs) > 0 {
+		return fmt.Errorf("部分资源池重建失败: %v", errs)
 	}
+	return nil
+}
 
-	// 初始化MCP池（总是初始化，因为MCP是核心功能）
-	logger.Info("开始初始化MCP资源池，请等待...")
-	mcpFactory := NewMCPFactory(config, logger)
-	if mcpFactory != nil {
-		mcpPool, err := NewResourcePool("mcpPool", mcpFactory, poolConfig, logger)
-		if err != nil {
-			return nil, fmt.Errorf("初始化MCP资源池失败: %v", err)
-		}
-		pm.mcpPool = mcpPool
-		_, cnt := mcpPool.GetStats()
-		logger.Info("MCP资源池初始化成功，数量：%d", cnt)
+// swapChain 替换模块的故障转移链并排空旧链，chain为nil表示不再使用该模块
+func (pm *PoolManager) swapChain(module string, chain *providerChain) {
+	pm.mu.Lock()
+	old := pm.chains[module]
+	if chain != nil {
+		pm.chains[module] = chain
 	} else {
-		logger.Warn("创建MCP工厂失败，MCP功能将不可用")
+		delete(pm.chains, module)
 	}
+	pm.mu.Unlock()
 
-	return pm, nil
+	if old != nil {
+		old.drain()
+	}
+	pm.logger.Info("%s资源池已按新配置重建", module)
 }
 
-// GetProviderSet 获取一套提供者
-func (pm *PoolManager) GetProviderSet() (*ProviderSet, error) {
-	set := &ProviderSet{}
+// swapMCPPool 替换MCP资源池并排空旧池
+func (pm *PoolManager) swapMCPPool(pool *ResourcePool) {
+	pm.mu.Lock()
+	old := pm.mcpPool
+	pm.mcpPool = pool
+	pm.mu.Unlock()
 
-	if pm.asrPool != nil {
-		asr, err := pm.asrPool.Get()
-		if err != nil {
-			return nil, fmt.Errorf("获取ASR提供者失败: %v", err)
-		}
-		set.ASR = asr.(providers.ASRProvider)
+	if old != nil {
+		old.Drain()
 	}
+	pm.logger.Info("MCP资源池已按新配置重建")
+}
 
-	if pm.llmPool != nil {
-		llm, err := pm.llmPool.Get()
-		if err != nil {
-			return nil, fmt.Errorf("获取LLM提供者失败: %v", err)
-		}
-		set.LLM = llm.(providers.LLMProvider)
+// moduleConfigChanged 判断模块的故障转移链或提供者的配置是否变化。
+// 不在链中的提供者也可能已按需创建资源池，因此任一提供者的配置变化都需要重建。
+func moduleConfigChanged(module string, newCfg, oldCfg *configs.Config) bool {
+	if !reflect.DeepEqual(newCfg.ModuleChain(module), oldCfg.ModuleChain(module)) {
+		return true
+	}
+	switch module {
+	case "ASR":
+		return newCfg.DeleteAudio != oldCfg.DeleteAudio || !reflect.DeepEqual(newCfg.ASR, oldCfg.ASR)
+	case "LLM":
+		return !reflect.DeepEqual(newCfg.LLM, oldCfg.LLM)
+	case "TTS":
+		return newCfg.DeleteAudio != oldCfg.DeleteAudio || !reflect.DeepEqual(newCfg.TTS, oldCfg.TTS)
+	case "VLLLM":
+		return !reflect.DeepEqual(newCfg.VLLLM, oldCfg.VLLLM)
+	}
+	return false
+}
+
+// GetProviderSet 获取一套提供者，每个模块使用故障转移链中最健康的提供者。
+// selected为模块到提供者名称的映射（如用户设置），指定的提供者优先使用：不在故障转移链中时按需创建资源池，
+// 不会成为其他会话的备用提供者；指定的提供者未配置或不可用时使用故障转移链。
+func (pm *PoolManager) GetProviderSet(selected map[string]string) (*ProviderSet, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	set := &ProviderSet{
+		chains:  make(map[string]*providerChain),
+		members: make(map[string]*chainMember),
 	}
 
-	if pm.ttsPool != nil {
-		tts, err := pm.ttsPool.Get()
+	for _, module := range chainModules {
+		chain := pm.chains[module]
+		if chain == nil {
+			continue
+		}
+		resource, member, err := chain.acquire(selected[module])
 		if err != nil {
-			return nil, fmt.Errorf("获取TTS提供者失败: %v", err)
+			if module == "VLLLM" {
+				// VLLLM是可选的，获取失败时使用普通LLM
+				continue
+			}
+			pm.returnAcquired(set)
+			return nil, fmt.Errorf("获取%s提供者失败: %v", module, err)
 		}
-		set.TTS = tts.(providers.TTSProvider)
-	}
 
-	if pm.vlllmPool != nil {
-		vlllmProvider, err := pm.vlllmPool.Get()
-		if err == nil {
+		switch module {
+		case "ASR":
+			set.ASR = resource.(providers.ASRProvider)
+		case "LLM":
+			set.LLM = resource.(providers.LLMProvider)
+		case "TTS":
+			set.TTS = resource.(providers.TTSProvider)
+		case "VLLLM":
 			// 直接转换，因为我们知道这是从 vlllm 工厂创建的
-			set.VLLLM = vlllmProvider.(*vlllm.Provider)
+			set.VLLLM = resource.(*vlllm.Provider)
 		}
+		set.chains[module] = chain
+		set.members[module] = member
 	}
 
 	if pm.mcpPool != nil {
@@ -187,25 +371,30 @@ func (pm *PoolManager) GetProviderSet() (*ProviderSet, error) {
 		if err == nil {
 			// 直接转换，因为我们知道这是从 mcp 工厂创建的
 			set.MCP = mcpManager.(*mcp.Manager)
+			set.mcpPool = pm.mcpPool
 		}
 	}
 
 	return set, nil
 }
 
+// returnAcquired 获取提供者集合中途失败时，归还已获取的提供者
+func (pm *PoolManager) returnAcquired(set *ProviderSet) {
+	resources := map[string]interface{}{"ASR": set.ASR, "LLM": set.LLM, "TTS": set.TTS}
+	for module, member := range set.members {
+		if resource := resources[module]; resource != nil {
+			pm.returnProvider(module, member.pool, resource, nil)
+		}
+	}
+}
+
 // Close 关闭所有资源池
 func (pm *PoolManager) Close() {
-	if pm.asrPool != nil {
-		pm.asrPool.Close()
-	}
-	if pm.llmPool != nil {
-		pm.llmPool.Close()
-	}
-	if pm.ttsPool != nil {
-		pm.ttsPool.Close()
-	}
-	if pm.vlllmPool != nil {
-		pm.vlllmPool.Close()
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, chain := range pm.chains {
+		chain.close()
 	}
 	if pm.mcpPool != nil {
 		pm.mcpPool.Close()
@@ -213,78 +402,47 @@ func (pm *PoolManager) Close() {
 }
 
 // ReturnProviderSet 归还提供者集合到池中
+// 提供者归还到获取时的资源池，若该池已因配置重载被排空则直接销毁
 func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	if set == nil {
 		return fmt.Errorf("提供者集合为空，无法归还")
 	}
 
-	var errs []error
-
-	// 归还ASR提供者
-	if set.ASR != nil && pm.asrPool != nil {
-		// 重置资源状态
-		if err := pm.asrPool.Reset(set.ASR); err != nil {
-			pm.logger.Warn("重置ASR资源状态失败: %v", err)
+	pm.mu.RLock()
+	set.mu.Lock()
+	// 兼容未记录来源池的提供者集合，归还到当前故障转移链的主提供者
+	poolOf := func(module string) *ResourcePool {
+		if member := set.members[module]; member != nil {
+			return member.pool
 		}
-		// 归还到池中
-		if err := pm.asrPool.Put(set.ASR); err != nil {
-			errs = append(errs, fmt.Errorf("归还ASR提供者失败: %v", err))
-			pm.logger.Error("归还ASR提供者失败: %v", err)
-		} else {
-			pm.logger.Debug("ASR提供者已成功归还到池中")
+		if chain := pm.chains[module]; chain != nil {
+			return chain.members[0].pool
 		}
+		return nil
 	}
-
-	// 归还LLM提供者
-	if set.LLM != nil && pm.llmPool != nil {
-		if err := pm.llmPool.Reset(set.LLM); err != nil {
-			pm.logger.Warn("重置LLM资源状态失败: %v", err)
-		}
-		if err := pm.llmPool.Put(set.LLM); err != nil {
-			errs = append(errs, fmt.Errorf("归还LLM提供者失败: %v", err))
-			pm.logger.Error("归还LLM提供者失败: %v", err)
-		} else {
-			pm.logger.Debug("LLM提供者已成功归还到池中")
-		}
+	asrPool, llmPool, ttsPool, vlllmPool := poolOf("ASR"), poolOf("LLM"), poolOf("TTS"), poolOf("VLLLM")
+	asr, tts := set.ASR, set.TTS
+	if set.mcpPool == nil {
+		set.mcpPool = pm.mcpPool
 	}
+	set.mu.Unlock()
+	pm.mu.RUnlock()
 
-	// 归还TTS提供者
-	if set.TTS != nil && pm.ttsPool != nil {
-		if err := pm.ttsPool.Reset(set.TTS); err != nil {
-			pm.logger.Warn("重置TTS资源状态失败: %v", err)
-		}
-		if err := pm.ttsPool.Put(set.TTS); err != nil {
-			errs = append(errs, fmt.Errorf("归还TTS提供者失败: %v", err))
-			pm.logger.Error("归还TTS提供者失败: %v", err)
-		} else {
-			pm.logger.Debug("TTS提供者已成功归还到池中")
-		}
+	var errs []error
+	if asr != nil {
+		errs = pm.returnProvider("ASR", asrPool, asr, errs)
 	}
-
-	// 归还VLLLM提供者
-	if set.VLLLM != nil && pm.vlllmPool != nil {
-		if err := pm.vlllmPool.Reset(set.VLLLM); err != nil {
-			pm.logger.Warn("重置VLLLM资源状态失败: %v", err)
-		}
-		if err := pm.vlllmPool.Put(set.VLLLM); err != nil {
-			errs = append(errs, fmt.Errorf("归还VLLLM提供者失败: %v", err))
-			pm.logger.Error("归还VLLLM提供者失败: %v", err)
-		} else {
-			pm.logger.Debug("VLLLM提供者已成功归还到池中")
-		}
+	if set.LLM != nil {
+		errs = pm.returnProvider("LLM", llmPool, set.LLM, errs)
 	}
-
-	// 归还MCP提供者
-	if set.MCP != nil && pm.mcpPool != nil {
-		if err := pm.mcpPool.Reset(set.MCP); err != nil {
-			pm.logger.Warn("重置MCP资源状态失败: %v", err)
-		}
-		if err := pm.mcpPool.Put(set.MCP); err != nil {
-			errs = append(errs, fmt.Errorf("归还MCP提供者失败: %v", err))
-			pm.logger.Error("归还MCP提供者失败: %v", err)
-		} else {
-			pm.logger.Debug("MCP提供者已成功归还到池中")
-		}
+	if tts != nil {
+		errs = pm.returnProvider("TTS", ttsPool, tts, errs)
+	}
+	if set.VLLLM != nil {
+		errs = pm.returnProvider("VLLLM", vlllmPool, set.VLLLM, errs)
+	}
+	if set.MCP != nil {
+		errs = pm.returnProvider("MCP", set.mcpPool, set.MCP, errs)
 	}
 
 	if len(errs) > 0 {
@@ -295,28 +453,32 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	return nil
 }
 
-// GetStats 获取所有池的统计信息
-func (pm *PoolManager) GetStats() map[string]map[string]int {
-	stats := make(map[string]map[string]int)
-
-	if pm.asrPool != nil {
-		available, total := pm.asrPool.GetStats()
-		stats["asr"] = map[string]int{"available": available, "total": total}
+// returnProvider 重置资源状态并归还到池中
+func (pm *PoolManager) returnProvider(module string, pool *ResourcePool, resource interface{}, errs []error) []error {
+	if pool == nil {
+		return errs
 	}
-
-	if pm.llmPool != nil {
-		available, total := pm.llmPool.GetStats()
-		stats["llm"] = map[string]int{"available": available, "total": total}
+	if err := pool.Reset(resource); err != nil {
+		pm.logger.Warn("重置%s资源状态失败: %v", module, err)
 	}
-
-	if pm.ttsPool != nil {
-		available, total := pm.ttsPool.GetStats()
-		stats["tts"] = map[string]int{"available": available, "total": total}
+	if err := pool.Put(resource); err != nil {
+		pm.logger.Error("归还%s提供者失败: %v", module, err)
+		return append(errs, fmt.Errorf("归还%s提供者失败: %v", module, err))
 	}
+	pm.logger.Debug("%s提供者已成功归还到池中", module)
+	return errs
+}
 
-	if pm.vlllmPool != nil {
-		available, total := pm.vlllmPool.GetStats()
-		stats["vlllm"] = map[string]int{"available": available, "total": total}
+// GetStats 获取所有池的统计信息，故障转移链汇总链中所有提供者
+func (pm *PoolManager) GetStats() map[string]map[string]int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	stats := make(map[string]map[string]int)
+
+	for module, chain := range pm.chains {
+		available, total := chain.stats()
+		stats[strings.ToLower(module)] = map[string]int{"available": available, "total": total}
 	}
 
 	if pm.mcpPool != nil {
@@ -327,11 +489,36 @@ func (pm *PoolManager) GetStats() map[string]map[string]int {
 	return stats
 }
 
-// performConnectivityCheck 执行连通性检查
+// GetFailoverStats 获取各模块故障转移链的熔断状态和备用提供者使用次数
+func (pm *PoolManager) GetFailoverStats() map[string]FailoverStats {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	stats := make(map[string]FailoverStats, len(pm.chains))
+	for module, chain := range pm.chains {
+		stats[strings.ToLower(module)] = chain.failoverStats()
+	}
+	return stats
+}
+
+// GetCircuitStates 获取各提供者的熔断状态，0正常 1熔断 2冷却结束试用
+func (pm *PoolManager) GetCircuitStates() map[string]map[string]int {
+	values := map[string]int{BreakerClosed: 0, BreakerOpen: 1, BreakerHalfOpen: 2}
+	states := make(map[string]map[string]int)
+	for module, stats := range pm.GetFailoverStats() {
+		states[module] = make(map[string]int, len(stats.Providers))
+		for _, provider := range stats.Providers {
+			states[module][provider.Name] = values[provider.State]
+		}
+	}
+	return states
+}
+
+// performConnectivityCheck 执行连通性检查，返回各模块检查未通过的提供者
 func (pm *PoolManager) performConnectivityCheck(
 	config *configs.Config,
 	logger *utils.Logger,
-) error {
+) (map[string][]string, error) {
 	// 从配置创建连通性检查配置
 	connConfig, err := ConfigFromYAML(&config.ConnectivityCheck)
 	if err != nil {
@@ -351,27 +538,18 @@ func (pm *PoolManager) performConnectivityCheck(
 	// 打印检查报告
 	healthChecker.PrintReport()
 
-	return err
+	return healthChecker.FailedProviders(), err
 }
 
 // GetDetailedStats 获取所有池的详细统计信息
 func (pm *PoolManager) GetDetailedStats() map[string]map[string]int {
-	stats := make(map[string]map[string]int)
-
-	if pm.asrPool != nil {
-		stats["asr"] = pm.asrPool.GetDetailedStats()
-	}
-
-	if pm.llmPool != nil {
-		stats["llm"] = pm.llmPool.GetDetailedStats()
-	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
-	if pm.ttsPool != nil {
-		stats["tts"] = pm.ttsPool.GetDetailedStats()
-	}
+	stats := make(map[string]map[string]int)
 
-	if pm.vlllmPool != nil {
-		stats["vlllm"] = pm.vlllmPool.GetDetailedStats()
+	for module, chain := range pm.chains {
+		stats[strings.ToLower(module)] = chain.detailedStats()
 	}
 
 	if pm.mcpPool != nil {
@@ -95,7 +95,15 @@ func (p *ResourcePool) Get() (interface{}, error) {
 		}
 		p.currentSize++
 		p.mutex.Unlock()
-		return p.factory.Create()
+		resource, err := p.factory.Create()
+		if err != nil {
+			// 创建失败时释放占用的名额
+			p.mutex.Lock()
+			p.currentSize--
+			p.mutex.Unlock()
+			return nil, err
+		}
+		return resource, nil
 	}
 }
 
@@ -179,6 +187,29 @@ func (p *ResourcePool) Close() {
 	}
 }
 
+// Drain 排空资源池：停止维护并销毁空闲资源，但不关闭通道。
+// 配置重载后旧资源池使用此方法，使用中的资源归还时会被直接销毁。
+func (p *ResourcePool) Drain() {
+	p.cancel()
+	p.destroyIdle()
+	p.logger.Info("%s 资源池已排空", p.poolName)
+}
+
+// destroyIdle 销毁池中所有空闲资源
+func (p *ResourcePool) destroyIdle() {
+	for {
+		select {
+		case resource := <-p.pool:
+			p.mutex.Lock()
+			p.currentSize--
+			p.mutex.Unlock()
+			p.factory.Destroy(resource)
+		default:
+			return
+		}
+	}
+}
+
 // Put 将资源归还到池中
 func (p *ResourcePool) Put(resource interface{}) error {
 	if resource == nil {
@@ -201,6 +232,10 @@ func (p *ResourcePool) Put(resource interface{}) error {
 		p.mutex.Lock()
 		p.currentSize++
 		p.mutex.Unlock()
+		// 归还过程中资源池被排空，避免资源滞留在池中
+		if p.ctx.Err() != nil {
+			p.destroyIdle()
+		}
 		return nil
 	case <-timeout.C:
 		// 超时后销毁资源而不是阻塞
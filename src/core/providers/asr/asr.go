@@ -3,6 +3,7 @@ package asr
 import (
 	"bytes"
 	"fmt"
+	"sync"
 	"time"
 	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/utils"
@@ -32,6 +33,8 @@ type BaseProvider struct {
 	// 静音检测配置
 	silenceThreshold float64 // 能量阈值
 	silenceDuration  int     // 静音持续时间(ms)
+	vadMu            sync.Mutex
+	vad              vadState
 
 	BEnableSilenceDetection bool      // 是否启用静音检测
 	StartListenTime         time.Time // 最后一次ASR处理时间
@@ -147,6 +150,8 @@ func Create(name string, config *Config, deleteFile bool, logger *utils.Logger)
 // 初始化音频处理
 func (p *BaseProvider) InitAudioProcessing() {
 	p.audioBuffer = new(bytes.Buffer)
-	p.silenceThreshold = 0.01 // 默认能量阈值
-	p.silenceDuration = 800   // 默认静音判断时长(ms)
+
+	p.vadMu.Lock()
+	defer p.vadMu.Unlock()
+	p.initVAD()
 }
@@ -0,0 +1,112 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// 默认收到多少帧音频后返回一次识别结果
+const defaultFrames = 10
+
+// Ensure Provider implements asr.Provider interface
+var _ asr.Provider = (*Provider)(nil)
+
+// Provider 离线测试用的ASR，不调用任何服务。
+// 每收到frames帧音频，按顺序返回transcripts中的下一条识别结果，用完后从头循环。
+type Provider struct {
+	*asr.BaseProvider
+	transcripts []string
+	frames      int
+	logger      *utils.Logger
+
+	mu       sync.Mutex
+	received int // 本次识别已收到的音频帧数
+	next     int // 下一条识别结果的序号
+}
+
+// NewProvider 创建fake ASR提供者
+func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
+	provider := &Provider{
+		BaseProvider: asr.NewBaseProvider(config, deleteFile),
+		frames:       defaultFrames,
+		logger:       logger,
+	}
+
+	if list, ok := config.Data["transcripts"].([]interface{}); ok {
+		for _, item := range list {
+			text, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("transcripts只能包含字符串: %v", item)
+			}
+			provider.transcripts = append(provider.transcripts, text)
+		}
+	}
+	if len(provider.transcripts) == 0 {
+		provider.transcripts = []string{"你好"}
+	}
+
+	switch frames := config.Data["frames"].(type) {
+	case int:
+		provider.frames = frames
+	case float64:
+		provider.frames = int(frames)
+	}
+	if provider.frames <= 0 {
+		return nil, fmt.Errorf("frames必须大于0: %d", provider.frames)
+	}
+
+	provider.InitAudioProcessing()
+	return provider, nil
+}
+
+// Transcribe 直接返回下一条识别结果
+func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.nextTranscript(), nil
+}
+
+// AddAudio 累计音频帧数，达到frames时在当前协程中回调识别结果
+func (p *Provider) AddAudio(data []byte) error {
+	p.mu.Lock()
+	if p.received == 0 {
+		p.ResetStartListenTime()
+	}
+	p.received++
+	if p.received < p.frames {
+		p.mu.Unlock()
+		return nil
+	}
+	p.received = 0
+	result := p.nextTranscript()
+	p.mu.Unlock()
+
+	p.logger.Debug("fake ASR返回识别结果: %s", result)
+	if listener := p.GetListener(); listener != nil {
+		listener.OnAsrResult(result)
+	}
+	return nil
+}
+
+// Reset 丢弃本次识别已收到的音频
+func (p *Provider) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received = 0
+	return nil
+}
+
+func (p *Provider) nextTranscript() string {
+	result := p.transcripts[p.next%len(p.transcripts)]
+	p.next++
+	return result
+}
+
+func init() {
+	asr.Register("fake", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
+		return NewProvider(config, deleteFile, logger)
+	})
+}
@@ -2,52 +2,114 @@ package gosherpa
 
 import (
 	"context"
-	"github.com/gorilla/websocket"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 	"xiaozhi-server-go/src/core/providers/asr"
 	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gorilla/websocket"
 )
 
+// finishTimeout 说话结束后等待服务端返回最终结果并关闭连接的最长时间
+const finishTimeout = 2 * time.Second
+
+// stream 一次识别对应的WebSocket连接
+type stream struct {
+	conn     *websocket.Conn
+	finished atomic.Bool // 说话结束，连接关闭后回调最后一次识别结果
+}
+
+// Provider GoSherpa ASR提供者。
+// GoSherpa服务端没有断句能力，默认启用本地VAD：只上传说话部分的音频，
+// 说话结束后关闭本次识别的连接，以收到的最后一次识别结果作为本句结果。
 type Provider struct {
 	*asr.BaseProvider
-	conn *websocket.Conn
+	addr   string
+	logger *utils.Logger
+
+	mu     sync.Mutex
+	stream *stream
 }
 
 func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
 	base := asr.NewBaseProvider(config, deleteFile)
 
+	addr, _ := config.Data["addr"].(string)
+	if addr == "" {
+		return nil, fmt.Errorf("缺少addr配置")
+	}
 	provider := &Provider{
 		BaseProvider: base,
+		addr:         addr,
+		logger:       logger,
 	}
 	// 初始化音频处理
+	provider.SetDefaultVAD(true)
 	provider.InitAudioProcessing()
+
+	if _, err := provider.connect(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// connect 返回当前识别的连接，没有则新建
+func (p *Provider) connect() (*stream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stream != nil {
+		return p.stream, nil
+	}
+
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second, // 设置握手超时
 	}
-	conn, _, err := dialer.DialContext(context.Background(), config.Data["addr"].(string), map[string][]string{})
+	conn, _, err := dialer.DialContext(context.Background(), p.addr, map[string][]string{})
 	if err != nil {
 		return nil, err
 	}
-	provider.conn = conn
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
+	s := &stream{conn: conn}
+	p.stream = s
+	go p.readLoop(s)
+	return s, nil
+}
+
+// readLoop 读取识别结果。未启用VAD时每条结果都回调监听器，
+// 启用VAD时只保留最后一次结果，等说话结束、连接关闭后再回调
+func (p *Provider) readLoop(s *stream) {
+	var result string
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			p.mu.Lock()
+			if p.stream == s {
+				p.stream = nil
 			}
-		}()
-		for {
-			messageType, p, _ := conn.ReadMessage()
-			if messageType == websocket.TextMessage {
-				if listener := provider.GetListener(); listener != nil {
-					if finished := listener.OnAsrResult(string(p)); finished {
-
-					}
-				}
+			p.mu.Unlock()
+			s.conn.Close()
+
+			if !s.finished.Load() {
+				p.logger.Debug("GoSherpa连接已断开: %v", err)
+				return
+			}
+			if listener := p.GetListener(); listener != nil {
+				listener.OnAsrResult(result)
 			}
+			return
 		}
-
-	}()
-
-	return provider, nil
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		if p.VADEnabled() {
+			result = string(data)
+			continue
+		}
+		if listener := p.GetListener(); listener != nil {
+			listener.OnAsrResult(string(data))
+		}
+	}
 }
 
 func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
@@ -56,13 +118,82 @@ func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, er
 
 // 添加音频数据到缓冲区
 func (p *Provider) AddAudio(data []byte) error {
-	p.conn.WriteMessage(websocket.BinaryMessage, data)
+	speech, event := p.DetectVoice(data)
+	if len(speech) > 0 {
+		s, err := p.connect()
+		if err != nil {
+			return fmt.Errorf("连接GoSherpa失败: %v", err)
+		}
+		if err := s.conn.WriteMessage(websocket.BinaryMessage, speech); err != nil {
+			return fmt.Errorf("发送音频数据失败: %v", err)
+		}
+	}
 
+	switch event {
+	case asr.VADSpeechEnd:
+		p.finish()
+	case asr.VADIdle:
+		if listener := p.GetListener(); listener != nil {
+			listener.OnAsrResult("")
+		}
+	}
+	return nil
+}
+
+// Finish 客户端停止拾音，结束本次识别
+func (p *Provider) Finish() error {
+	if p.VADEnabled() {
+		p.finish()
+	}
 	return nil
 }
 
+// finish 说话结束，关闭本次识别的连接，由readLoop回调最终结果
+func (p *Provider) finish() {
+	p.mu.Lock()
+	s := p.stream
+	p.stream = nil
+	p.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.finished.Store(true)
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := s.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil {
+		s.conn.Close()
+		return
+	}
+	// 服务端没有响应关闭时强制断开
+	time.AfterFunc(finishTimeout, func() { s.conn.Close() })
+}
+
 // 复位ASR状态
 func (p *Provider) Reset() error {
+	p.InitAudioProcessing()
+	if !p.VADEnabled() {
+		return nil
+	}
+	// 丢弃未结束的识别
+	p.mu.Lock()
+	s := p.stream
+	p.stream = nil
+	p.mu.Unlock()
+	if s != nil {
+		s.conn.Close()
+	}
+	return nil
+}
+
+// Cleanup 关闭识别连接
+func (p *Provider) Cleanup() error {
+	p.mu.Lock()
+	s := p.stream
+	p.stream = nil
+	p.mu.Unlock()
+	if s != nil {
+		return s.conn.Close()
+	}
 	return nil
 }
 
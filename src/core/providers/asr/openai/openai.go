@@ -0,0 +1,223 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	defaultURL        = "http://127.0.0.1:8000/v1"
+	defaultModel      = "whisper-1"
+	defaultSampleRate = 16000
+	requestTimeout    = 30 * time.Second
+	transcribePath    = "/audio/transcriptions"
+)
+
+// Ensure Provider implements asr.Provider interface
+var _ asr.Provider = (*Provider)(nil)
+
+// Provider OpenAI兼容的语音识别提供者，调用 /v1/audio/transcriptions 接口。
+// 非流式识别：启用本地VAD缓存一句话的PCM，说话结束(auto模式)或停止拾音(manual模式)时
+// 编码为WAV上传识别。faster-whisper-server、whisper.cpp server等服务都可以使用。
+type Provider struct {
+	*asr.BaseProvider
+	endpoint   string
+	apiKey     string
+	model      string
+	language   string
+	prompt     string
+	sampleRate int
+	client     *http.Client
+	logger     *utils.Logger
+
+	mu     sync.Mutex
+	ctx    context.Context // Reset时取消进行中的识别
+	cancel context.CancelFunc
+}
+
+// NewProvider 创建OpenAI兼容的ASR提供者
+func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
+	provider := &Provider{
+		BaseProvider: asr.NewBaseProvider(config, deleteFile),
+		model:        defaultModel,
+		sampleRate:   defaultSampleRate,
+		client:       &http.Client{Timeout: requestTimeout},
+		logger:       logger,
+	}
+
+	url, _ := config.Data["url"].(string)
+	if url == "" {
+		url = defaultURL
+	}
+	// url可以是基础地址，也可以是完整的接口地址
+	provider.endpoint = strings.TrimRight(url, "/")
+	if !strings.HasSuffix(provider.endpoint, transcribePath) {
+		provider.endpoint += transcribePath
+	}
+	provider.apiKey, _ = config.Data["api_key"].(string)
+	if model, _ := config.Data["model"].(string); model != "" {
+		provider.model = model
+	}
+	provider.language, _ = config.Data["language"].(string)
+	provider.prompt, _ = config.Data["prompt"].(string)
+	switch rate := config.Data["sample_rate"].(type) {
+	case int:
+		provider.sampleRate = rate
+	case float64:
+		provider.sampleRate = int(rate)
+	}
+
+	// 接口只能识别完整的音频，需要本地VAD判断说话结束
+	provider.SetDefaultVAD(true)
+	provider.InitAudioProcessing()
+	provider.ctx, provider.cancel = context.WithCancel(context.Background())
+	return provider, nil
+}
+
+// Transcribe 识别16位单声道PCM数据
+func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	wav := utils.PCMToWavData(audioData, p.sampleRate, 1, 16)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"model":           p.model,
+		"language":        p.language,
+		"prompt":          p.prompt,
+		"response_format": "json",
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("构造请求失败: %v", err)
+		}
+	}
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", fmt.Errorf("构造请求失败: %v", err)
+	}
+	part.Write(wav)
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("构造请求失败: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, &body)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求识别服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取识别结果失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("识别服务返回错误: %d, %s", resp.StatusCode, data)
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("解析识别结果失败: %v, %s", err, data)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// AddAudio 缓存说话部分的音频，auto模式下说话结束时开始识别
+func (p *Provider) AddAudio(data []byte) error {
+	speech, event := p.DetectVoice(data)
+
+	p.mu.Lock()
+	if p.GetAudioBuffer().Len() == 0 && len(speech) > 0 {
+		p.ResetStartListenTime()
+	}
+	p.GetAudioBuffer().Write(speech)
+	p.mu.Unlock()
+
+	switch event {
+	case asr.VADSpeechEnd:
+		return p.Finish()
+	case asr.VADIdle:
+		if listener := p.GetListener(); listener != nil {
+			listener.OnAsrResult("")
+		}
+	}
+	return nil
+}
+
+// Finish 识别已缓存的音频，结果通过监听器返回
+func (p *Provider) Finish() error {
+	p.mu.Lock()
+	buffer := p.GetAudioBuffer()
+	pcm := bytes.Clone(buffer.Bytes())
+	buffer.Reset()
+	ctx := p.ctx
+	p.mu.Unlock()
+
+	if len(pcm) == 0 {
+		return nil
+	}
+
+	// 识别较慢，不阻塞后续音频的处理
+	go func() {
+		start := time.Now()
+		text, err := p.Transcribe(ctx, pcm)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("语音识别失败: %v", err)
+			}
+			return
+		}
+		p.logger.Debug("语音识别完成: %s, 音频%dms, 耗时%v", text, len(pcm)*1000/(p.sampleRate*2), time.Since(start))
+		if listener := p.GetListener(); listener != nil {
+			listener.OnAsrResult(text)
+		}
+	}()
+	return nil
+}
+
+// Reset 丢弃缓存的音频，取消进行中的识别
+func (p *Provider) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancel()
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.InitAudioProcessing()
+	return nil
+}
+
+// Cleanup 取消进行中的识别
+func (p *Provider) Cleanup() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancel()
+	return nil
+}
+
+func init() {
+	asr.Register("openai", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
+		return NewProvider(config, deleteFile, logger)
+	})
+}
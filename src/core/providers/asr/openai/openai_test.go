@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+type listener struct {
+	results chan string
+}
+
+func (l *listener) OnAsrResult(result string) bool {
+	l.results <- result
+	return true
+}
+
+// chunk 生成16kHz下100ms的PCM，speech为true时为方波
+func chunk(speech bool) []byte {
+	pcm := make([]byte, 3200)
+	if speech {
+		for i := 0; i < len(pcm)/2; i++ {
+			value := int16(8000)
+			if i%20 < 10 {
+				value = -value
+			}
+			binary.LittleEndian.PutUint16(pcm[i*2:], uint16(value))
+		}
+	}
+	return pcm
+}
+
+func TestProvider(t *testing.T) {
+	type request struct {
+		model, language string
+		audioBytes      int
+	}
+	requests := make(chan request, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wav, _ := io.ReadAll(file)
+		requests <- request{r.FormValue("model"), r.FormValue("language"), len(wav) - 44}
+		json.NewEncoder(w).Encode(map[string]string{"text": " 你好 "})
+	}))
+	defer server.Close()
+
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	tests := []struct {
+		name   string
+		mode   string
+		chunks []bool
+		finish bool
+		want   int // 上传的PCM字节数，静音超过300ms才结束，结尾静音不上传
+	}{
+		{name: "auto模式说话结束后识别", mode: "auto", chunks: []bool{false, true, true, false, false, false}, want: 3 * 3200},
+		{name: "manual模式停止拾音后识别", mode: "manual", chunks: []bool{true, false, true, false}, finish: true, want: 3 * 3200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewProvider(&asr.Config{Data: map[string]interface{}{
+				"url":              server.URL + "/v1",
+				"language":         "zh",
+				"silence_duration": 300,
+			}}, false, logger)
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			l := &listener{results: make(chan string, 1)}
+			provider.SetListener(l)
+			provider.SetListenMode(tt.mode)
+
+			for _, speech := range tt.chunks {
+				if err := provider.AddAudio(chunk(speech)); err != nil {
+					t.Fatalf("AddAudio() error = %v", err)
+				}
+			}
+			if tt.finish {
+				provider.Finish()
+			}
+
+			select {
+			case result := <-l.results:
+				if result != "你好" {
+					t.Errorf("识别结果 = %q, want 你好", result)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("等待识别结果超时")
+			}
+			req := <-requests
+			if req.model != defaultModel || req.language != "zh" || req.audioBytes != tt.want {
+				t.Errorf("请求 = %+v, want 音频 %d 字节", req, tt.want)
+			}
+		})
+	}
+}
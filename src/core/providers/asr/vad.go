@@ -0,0 +1,171 @@
+package asr
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// VAD默认参数
+const (
+	defaultSilenceThreshold = 0.01  // 默认能量阈值，16位PCM的归一化均方根
+	defaultSilenceDuration  = 800   // 默认静音判断时长(ms)
+	defaultIdleTimeout      = 30000 // 默认无人说话判断时长(ms)
+	defaultVADSampleRate    = 16000 // 默认PCM采样率
+	preRollDuration         = 300   // 语音开始前保留的音频时长(ms)，避免截掉起始音节
+)
+
+// VADEvent 本次音频处理后的语音状态变化
+type VADEvent int
+
+const (
+	VADNone      VADEvent = iota // 无状态变化
+	VADSpeechEnd                 // 说话结束，auto模式下应结束本次识别
+	VADIdle                      // 拾音后长时间没有人说话，SilenceCount已加一
+)
+
+// vadState 基于能量的语音活动检测状态
+type vadState struct {
+	enabled     bool
+	defaultOn   bool // 配置中没有vad时是否启用
+	listenMode  string
+	sampleRate  int
+	idleTimeout int // 无人说话判断时长(ms)
+
+	speaking  bool
+	silenceMs int    // 说话过程中连续静音的时长
+	idleMs    int    // 本次拾音没有检测到语音的时长
+	preRoll   []byte // 语音开始前的静音，语音开始时一并上传
+	pending   []byte // 说话过程中的静音，语音恢复时一并上传，说话结束时丢弃
+}
+
+// initVAD 从配置读取VAD参数并重置检测状态：
+// vad 是否启用，silence_threshold 能量阈值，silence_duration 静音多久判定说话结束(ms)，
+// idle_timeout 多久无人说话计一次静音(ms)，sample_rate 输入PCM采样率
+func (p *BaseProvider) initVAD() {
+	p.silenceThreshold = defaultSilenceThreshold
+	p.silenceDuration = defaultSilenceDuration
+
+	p.vad = vadState{
+		enabled:     p.vad.defaultOn,
+		defaultOn:   p.vad.defaultOn,
+		listenMode:  p.vad.listenMode,
+		sampleRate:  defaultVADSampleRate,
+		idleTimeout: defaultIdleTimeout,
+	}
+	if p.config == nil || p.config.Data == nil {
+		return
+	}
+	data := p.config.Data
+	if enabled, ok := data["vad"].(bool); ok {
+		p.vad.enabled = enabled
+	}
+	if v, ok := toFloat(data["silence_threshold"]); ok && v > 0 {
+		p.silenceThreshold = v
+	}
+	if v, ok := toFloat(data["silence_duration"]); ok && v > 0 {
+		p.silenceDuration = int(v)
+	}
+	if v, ok := toFloat(data["idle_timeout"]); ok && v > 0 {
+		p.vad.idleTimeout = int(v)
+	}
+	if v, ok := toFloat(data["sample_rate"]); ok && v > 0 {
+		p.vad.sampleRate = int(v)
+	}
+}
+
+// SetDefaultVAD 设置配置中没有vad时是否启用，没有断句能力的ASR应默认启用，需在InitAudioProcessing前调用
+func (p *BaseProvider) SetDefaultVAD(enabled bool) {
+	p.vadMu.Lock()
+	defer p.vadMu.Unlock()
+	p.vad.defaultOn = enabled
+}
+
+// VADEnabled 是否启用了本地VAD
+func (p *BaseProvider) VADEnabled() bool {
+	p.vadMu.Lock()
+	defer p.vadMu.Unlock()
+	return p.vad.enabled
+}
+
+// SetListenMode 设置客户端拾音模式，auto模式下由VAD判断说话结束
+func (p *BaseProvider) SetListenMode(mode string) {
+	p.vadMu.Lock()
+	defer p.vadMu.Unlock()
+	p.vad.listenMode = mode
+}
+
+// DetectVoice 对16位单声道PCM做语音活动检测，返回需要上传的音频和状态变化。
+// 未启用VAD时原样返回。开头和结尾的静音不上传，说话中的短暂停顿会随后续语音一起上传；
+// auto模式下静音超过silence_duration返回VADSpeechEnd，超过idle_timeout没有语音返回VADIdle。
+func (p *BaseProvider) DetectVoice(pcm []byte) ([]byte, VADEvent) {
+	p.vadMu.Lock()
+	defer p.vadMu.Unlock()
+
+	v := &p.vad
+	if !v.enabled {
+		return pcm, VADNone
+	}
+
+	durationMs := len(pcm) * 1000 / (v.sampleRate * 2)
+	if energy(pcm) >= p.silenceThreshold {
+		var speech []byte
+		if !v.speaking {
+			v.speaking = true
+			p.SilenceCount = 0
+			speech = append(v.preRoll, pcm...)
+		} else {
+			speech = append(v.pending, pcm...)
+		}
+		v.preRoll, v.pending = nil, nil
+		v.silenceMs, v.idleMs = 0, 0
+		return speech, VADNone
+	}
+
+	if v.speaking {
+		v.pending = append(v.pending, pcm...)
+		v.silenceMs += durationMs
+		if v.silenceMs < p.silenceDuration || v.listenMode != "auto" {
+			return nil, VADNone
+		}
+		v.speaking = false
+		v.pending = nil
+		v.silenceMs = 0
+		return nil, VADSpeechEnd
+	}
+
+	v.preRoll = append(v.preRoll, pcm...)
+	if maxBytes := v.sampleRate * 2 * preRollDuration / 1000; len(v.preRoll) > maxBytes {
+		v.preRoll = v.preRoll[len(v.preRoll)-maxBytes:]
+	}
+	v.idleMs += durationMs
+	if v.idleMs >= v.idleTimeout && v.listenMode == "auto" {
+		v.idleMs = 0
+		p.SilenceCount++
+		return nil, VADIdle
+	}
+	return nil, VADNone
+}
+
+// energy 计算16位PCM的归一化均方根能量，范围0~1
+func energy(pcm []byte) float64 {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / math.MaxInt16
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(samples))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,110 @@
+package asr
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// chunk 生成16kHz下100ms的PCM，speech为true时为满幅一半的方波
+func chunk(speech bool) []byte {
+	pcm := make([]byte, 3200)
+	if speech {
+		for i := 0; i < len(pcm)/2; i++ {
+			value := int16(16000)
+			if i%20 < 10 {
+				value = -value
+			}
+			binary.LittleEndian.PutUint16(pcm[i*2:], uint16(value))
+		}
+	}
+	return pcm
+}
+
+func TestDetectVoice(t *testing.T) {
+	const (
+		s = true
+		q = false
+	)
+	tests := []struct {
+		name       string
+		data       map[string]interface{}
+		mode       string
+		chunks     []bool
+		wantBytes  int // 需要上传的音频总长度
+		wantEvents []VADEvent
+		wantCount  int // 处理后的SilenceCount
+	}{
+		{
+			name:       "未启用VAD原样返回",
+			data:       map[string]interface{}{},
+			mode:       "auto",
+			chunks:     []bool{q, s, q},
+			wantBytes:  3 * 3200,
+			wantEvents: []VADEvent{VADNone, VADNone, VADNone},
+		},
+		{
+			name:   "去掉开头静音并保留300ms预录，结尾静音后结束",
+			data:   map[string]interface{}{"vad": true, "silence_duration": 300},
+			mode:   "auto",
+			chunks: []bool{q, q, q, q, q, s, s, q, q, q},
+			// 3帧预录 + 2帧语音，结尾静音不上传
+			wantBytes:  5 * 3200,
+			wantEvents: []VADEvent{VADNone, VADNone, VADNone, VADNone, VADNone, VADNone, VADNone, VADNone, VADNone, VADSpeechEnd},
+		},
+		{
+			name:       "说话中的短暂停顿随后续语音上传",
+			data:       map[string]interface{}{"vad": true, "silence_duration": 300},
+			mode:       "auto",
+			chunks:     []bool{s, q, q, s},
+			wantBytes:  4 * 3200,
+			wantEvents: []VADEvent{VADNone, VADNone, VADNone, VADNone},
+		},
+		{
+			name:       "manual模式不判断说话结束",
+			data:       map[string]interface{}{"vad": true, "silence_duration": 300, "idle_timeout": 200},
+			mode:       "manual",
+			chunks:     []bool{s, q, q, q, q},
+			wantBytes:  3200,
+			wantEvents: []VADEvent{VADNone, VADNone, VADNone, VADNone, VADNone},
+		},
+		{
+			name:       "长时间无人说话计入静音次数",
+			data:       map[string]interface{}{"vad": true, "idle_timeout": 200},
+			mode:       "auto",
+			chunks:     []bool{q, q, q, q},
+			wantEvents: []VADEvent{VADNone, VADIdle, VADNone, VADIdle},
+			wantCount:  2,
+		},
+		{
+			name:       "说话后静音次数清零",
+			data:       map[string]interface{}{"vad": true, "idle_timeout": 200},
+			mode:       "auto",
+			chunks:     []bool{q, q, s},
+			wantBytes:  3 * 3200,
+			wantEvents: []VADEvent{VADNone, VADIdle, VADNone},
+			wantCount:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewBaseProvider(&Config{Data: tt.data}, false)
+			p.InitAudioProcessing()
+			p.SetListenMode(tt.mode)
+
+			bytes := 0
+			for i, speech := range tt.chunks {
+				upload, event := p.DetectVoice(chunk(speech))
+				bytes += len(upload)
+				if event != tt.wantEvents[i] {
+					t.Errorf("第%d块事件 = %v, want %v", i, event, tt.wantEvents[i])
+				}
+			}
+			if bytes != tt.wantBytes {
+				t.Errorf("上传字节数 = %d, want %d", bytes, tt.wantBytes)
+			}
+			if p.GetSilenceCount() != tt.wantCount {
+				t.Errorf("SilenceCount = %d, want %d", p.GetSilenceCount(), tt.wantCount)
+			}
+		})
+	}
+}
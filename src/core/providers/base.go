@@ -24,6 +24,8 @@ type ASRProvider interface {
 	AddAudio(data []byte) error
 
 	SetListener(listener AsrEventListener)
+	// 设置客户端拾音模式，启用本地VAD时auto模式由服务端判断说话结束
+	SetListenMode(mode string)
 	// 复位ASR状态
 	Reset() error
 
@@ -33,6 +35,12 @@ type ASRProvider interface {
 	ResetStartListenTime()
 }
 
+// ASRFinisher 需要客户端停止拾音时才开始识别的ASR，可选实现
+type ASRFinisher interface {
+	// 客户端停止拾音，识别已收到的音频，结果通过监听器返回
+	Finish() error
+}
+
 // TTSProvider 语音合成提供者接口
 type TTSProvider interface {
 	Provider
@@ -43,6 +51,18 @@ type TTSProvider interface {
 	SetVoice(voice string) error
 }
 
+// AudioChunk 流式合成的音频片段，Err不为空时表示合成失败
+type AudioChunk struct {
+	Data []byte
+	Err  error
+}
+
+// TTSStreamProvider 支持流式合成的TTS提供者，可选实现
+type TTSStreamProvider interface {
+	// 流式合成音频，通道中为指定采样率的16位单声道PCM数据，合成结束后关闭通道
+	ToTTSStream(ctx context.Context, text string, sampleRate int) (<-chan AudioChunk, error)
+}
+
 // LLMProvider 大语言模型提供者接口
 type LLMProvider interface {
 	types.LLMProvider
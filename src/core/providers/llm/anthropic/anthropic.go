@@ -0,0 +1,282 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBaseURL   = "https://api.anthropic.com"
+	apiVersion       = "2023-06-01"
+	defaultMaxTokens = 500
+)
+
+// Provider Anthropic Messages API提供者，支持流式输出和工具调用
+type Provider struct {
+	*llm.BaseProvider
+	endpoint  string
+	maxTokens int
+	client    *http.Client
+}
+
+// 注册提供者
+func init() {
+	llm.Register("anthropic", NewProvider)
+}
+
+// NewProvider 创建Anthropic提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	provider := &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		maxTokens:    config.MaxTokens,
+		client:       &http.Client{},
+	}
+	if provider.maxTokens <= 0 {
+		provider.maxTokens = defaultMaxTokens
+	}
+
+	// url可以是 https://api.anthropic.com、.../v1 或完整的 .../v1/messages
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	switch {
+	case strings.HasSuffix(baseURL, "/v1/messages"):
+		provider.endpoint = baseURL
+	case strings.HasSuffix(baseURL, "/v1"):
+		provider.endpoint = baseURL + "/messages"
+	default:
+		provider.endpoint = baseURL + "/v1/messages"
+	}
+	return provider, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Anthropic API key")
+	}
+	if config.ModelName == "" {
+		return fmt.Errorf("missing Anthropic model_name")
+	}
+	return nil
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		err := p.stream(ctx, messages, nil, func(chunk types.Response) {
+			if chunk.Content != "" {
+				responseChan <- chunk.Content
+			}
+		})
+		if err != nil {
+			responseChan <- fmt.Sprintf("【Anthropic服务响应异常: %v】", err)
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		err := p.stream(ctx, messages, tools, func(chunk types.Response) {
+			responseChan <- chunk
+		})
+		if err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Anthropic服务响应异常: %v】", err),
+				Error:   err.Error(),
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// stream 发起流式请求，将SSE事件转换为types.Response交给onChunk
+func (p *Provider) stream(ctx context.Context, messages []types.Message, tools []openai.Tool, onChunk func(types.Response)) error {
+	config := p.Config()
+	system, chatMessages := convertMessages(messages)
+	request := messagesRequest{
+		Model:     config.ModelName,
+		System:    system,
+		Messages:  chatMessages,
+		MaxTokens: p.maxTokens,
+		Stream:    true,
+	}
+	if config.Temperature > 0 {
+		request.Temperature = &config.Temperature
+	}
+	if config.TopP > 0 {
+		request.TopP = &config.TopP
+	}
+	if len(tools) > 0 {
+		request.Tools = convertTools(tools)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", config.APIKey)
+	req.Header.Set("anthropic-version", apiVersion)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("状态码%d: %s", resp.StatusCode, data)
+	}
+	return readEvents(resp.Body, onChunk)
+}
+
+// readEvents 解析SSE事件流。
+// 文本增量转为Content；tool_use块开始时输出工具ID和名称，参数增量转为Function.Arguments，
+// Index为工具调用在本次回复中的序号。
+func readEvents(r io.Reader, onChunk func(types.Response)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	toolIndex := map[int]int{} // content block序号 -> 工具调用序号
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &e); err != nil {
+			return fmt.Errorf("解析事件失败: %v", err)
+		}
+
+		switch e.Type {
+		case "content_block_start":
+			if e.ContentBlock.Type == "tool_use" {
+				index := len(toolIndex)
+				toolIndex[e.Index] = index
+				onChunk(types.Response{ToolCalls: []types.ToolCall{{
+					ID:       e.ContentBlock.ID,
+					Type:     "function",
+					Function: types.FunctionCall{Name: e.ContentBlock.Name},
+					Index:    index,
+				}}})
+			}
+		case "content_block_delta":
+			switch e.Delta.Type {
+			case "text_delta":
+				if e.Delta.Text != "" {
+					onChunk(types.Response{Content: e.Delta.Text})
+				}
+			case "input_json_delta":
+				if e.Delta.PartialJSON != "" {
+					onChunk(types.Response{ToolCalls: []types.ToolCall{{
+						Type:     "function",
+						Function: types.FunctionCall{Arguments: e.Delta.PartialJSON},
+						Index:    toolIndex[e.Index],
+					}}})
+				}
+			}
+		case "message_delta":
+			if e.Delta.StopReason != "" {
+				onChunk(types.Response{StopReason: e.Delta.StopReason})
+			}
+		case "message_stop":
+			return nil
+		case "error":
+			return fmt.Errorf("%s: %s", e.Error.Type, e.Error.Message)
+		}
+	}
+	return scanner.Err()
+}
+
+// convertMessages 将对话消息转换为Messages API格式。
+// system消息合并为顶层system参数；assistant的工具调用转为tool_use块，
+// tool消息转为user角色的tool_result块；相邻的同角色消息合并为一条。
+func convertMessages(messages []types.Message) (string, []message) {
+	var system []string
+	var result []message
+	for _, msg := range messages {
+		role := msg.Role
+		var blocks []contentBlock
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, contentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		default:
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, contentBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+		} else {
+			result = append(result, message{Role: role, Content: blocks})
+		}
+	}
+	return strings.Join(system, "\n\n"), result
+}
+
+// convertTools 将OpenAI格式的函数定义转换为Anthropic工具定义
+func convertTools(tools []openai.Tool) []tool {
+	result := make([]tool, 0, len(tools))
+	for _, t := range tools {
+		if t.Function == nil {
+			continue
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		result = append(result, tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const toolUseStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[]}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"好的"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"北京\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestResponseWithFunctions(t *testing.T) {
+	var got messagesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != apiVersion {
+			http.Error(w, `{"type":"error"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, toolUseStream)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&llm.Config{BaseURL: server.URL, APIKey: "key", ModelName: "claude"})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get_weather"}}}
+	responses, err := provider.ResponseWithFunctions(context.Background(), "", []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京天气"},
+	}, tools)
+	if err != nil {
+		t.Fatalf("ResponseWithFunctions() error = %v", err)
+	}
+
+	// 按genResponseByLLM的方式合并工具调用
+	var content, stopReason string
+	var toolCall types.ToolCall
+	for r := range responses {
+		if r.Error != "" {
+			t.Fatalf("响应错误: %s", r.Error)
+		}
+		content += r.Content
+		if r.StopReason != "" {
+			stopReason = r.StopReason
+		}
+		if len(r.ToolCalls) > 0 {
+			if r.ToolCalls[0].ID != "" {
+				toolCall.ID = r.ToolCalls[0].ID
+			}
+			if r.ToolCalls[0].Function.Name != "" {
+				toolCall.Function.Name = r.ToolCalls[0].Function.Name
+			}
+			toolCall.Function.Arguments += r.ToolCalls[0].Function.Arguments
+		}
+	}
+
+	if content != "好的" || stopReason != "tool_use" {
+		t.Errorf("content = %q, stopReason = %q", content, stopReason)
+	}
+	want := types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}
+	if toolCall.ID != "toolu_1" || toolCall.Function != want {
+		t.Errorf("toolCall = %+v", toolCall)
+	}
+	if got.System != "你是小智" || len(got.Messages) != 1 || !got.Stream || got.MaxTokens != defaultMaxTokens {
+		t.Errorf("请求 = %+v", got)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != "get_weather" || got.Tools[0].InputSchema == nil {
+		t.Errorf("工具 = %+v", got.Tools)
+	}
+}
+
+func TestConvertMessages(t *testing.T) {
+	messages := []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京和上海天气"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: "toolu_1", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+			{ID: "toolu_2", Function: types.FunctionCall{Name: "get_weather"}},
+		}},
+		{Role: "tool", ToolCallID: "toolu_1", Content: "晴"},
+		{Role: "tool", ToolCallID: "toolu_2", Content: "雨"},
+		{Role: "assistant", Content: ""},
+		{Role: "user", Content: "谢谢"},
+	}
+	system, got := convertMessages(messages)
+	want := []message{
+		{Role: "user", Content: []contentBlock{{Type: "text", Text: "北京和上海天气"}}},
+		{Role: "assistant", Content: []contentBlock{
+			{Type: "tool_use", ID: "toolu_1", Name: "get_weather", Input: json.RawMessage(`{"city":"北京"}`)},
+			{Type: "tool_use", ID: "toolu_2", Name: "get_weather", Input: json.RawMessage(`{}`)},
+		}},
+		{Role: "user", Content: []contentBlock{
+			{Type: "tool_result", ToolUseID: "toolu_1", Content: "晴"},
+			{Type: "tool_result", ToolUseID: "toolu_2", Content: "雨"},
+			{Type: "text", Text: "谢谢"},
+		}},
+	}
+	if system != "你是小智" || !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("convertMessages() = %q, %s", system, gotJSON)
+	}
+}
+
+func TestNewProviderEndpoint(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "", want: "https://api.anthropic.com/v1/messages"},
+		{url: "https://proxy.example.com/", want: "https://proxy.example.com/v1/messages"},
+		{url: "https://proxy.example.com/v1", want: "https://proxy.example.com/v1/messages"},
+		{url: "https://proxy.example.com/v1/messages", want: "https://proxy.example.com/v1/messages"},
+	}
+	for _, tt := range tests {
+		provider, _ := NewProvider(&llm.Config{BaseURL: tt.url})
+		if got := provider.(*Provider).endpoint; got != tt.want {
+			t.Errorf("NewProvider(%q).endpoint = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
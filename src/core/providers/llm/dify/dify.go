@@ -0,0 +1,237 @@
+package dify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const defaultBaseURL = "https://api.dify.ai/v1"
+
+// errConversationNotFound 会话在Dify中已被删除或不属于当前用户
+var errConversationNotFound = errors.New("conversation not exists")
+
+// Provider Dify应用提供者，调用聊天助手/Agent/Chatflow应用的 chat-messages 流式接口。
+// 对话历史由Dify按conversation_id保存，每次只发送最后一条用户消息；
+// 工具和知识库在Dify应用中配置，ResponseWithFunctions忽略传入的tools。
+type Provider struct {
+	*llm.BaseProvider
+	endpoint string
+	userID   string                 // 未设置身份标识时使用的用户标识
+	inputs   map[string]interface{} // 应用定义的输入变量
+	client   *http.Client
+
+	mu       sync.Mutex
+	identity string // 通过SetIdentityFlag设置的设备或用户标识
+
+	sessionConversationMap sync.Map // sessionID -> conversation_id
+}
+
+// 注册提供者
+func init() {
+	llm.Register("dify", NewProvider)
+}
+
+// NewProvider 创建Dify提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	provider := &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		endpoint:     strings.TrimSuffix(baseURL, "/chat-messages") + "/chat-messages",
+		client:       &http.Client{},
+	}
+	if userID, ok := config.Extra["user_id"].(string); ok {
+		provider.userID = userID
+	}
+	if inputs, ok := config.Extra["inputs"].(map[string]interface{}); ok {
+		provider.inputs = inputs
+	}
+	return provider, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	if p.Config().APIKey == "" {
+		return fmt.Errorf("缺少Dify应用的api_key配置")
+	}
+	return nil
+}
+
+// SetIdentityFlag 设置设备或用户标识，作为Dify的user参数区分终端用户
+func (p *Provider) SetIdentityFlag(idType string, flag string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if flag == "" {
+		p.identity = ""
+		return
+	}
+	p.identity = idType + "-" + flag
+}
+
+// user 请求使用的用户标识：身份标识 > 配置的user_id > sessionID
+func (p *Provider) user(sessionID string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.identity != "" {
+		return p.identity
+	}
+	if p.userID != "" {
+		return p.userID
+	}
+	return sessionID
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		if err := p.chat(ctx, sessionID, messages, func(text string) {
+			responseChan <- text
+		}); err != nil {
+			responseChan <- fmt.Sprintf("【Dify服务响应异常: %v】", err)
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		if err := p.chat(ctx, sessionID, messages, func(text string) {
+			responseChan <- types.Response{Content: text}
+		}); err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Dify服务响应异常: %v】", err),
+				Error:   err.Error(),
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// chat 发送最后一条用户消息，会话不存在时新建会话重试一次
+func (p *Provider) chat(ctx context.Context, sessionID string, messages []types.Message, onText func(string)) error {
+	var query string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			query = messages[i].Content
+			break
+		}
+	}
+	if query == "" {
+		return fmt.Errorf("没有用户消息")
+	}
+
+	conversationID := ""
+	if id, ok := p.sessionConversationMap.Load(sessionID); ok {
+		conversationID = id.(string)
+	}
+	err := p.stream(ctx, sessionID, query, conversationID, onText)
+	if errors.Is(err, errConversationNotFound) && conversationID != "" {
+		p.sessionConversationMap.Delete(sessionID)
+		err = p.stream(ctx, sessionID, query, "", onText)
+	}
+	return err
+}
+
+// stream 调用chat-messages流式接口。
+// message/agent_message事件的answer直接输出；agent_thought事件的thought
+// 只有在本轮推理没有输出过answer时才输出，避免与agent_message重复播报。
+func (p *Provider) stream(ctx context.Context, sessionID, query, conversationID string, onText func(string)) error {
+	inputs := p.inputs
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+	body, err := json.Marshal(chatRequest{
+		Inputs:         inputs,
+		Query:          query,
+		ResponseMode:   "streaming",
+		ConversationID: conversationID,
+		User:           p.user(sessionID),
+	})
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.Config().APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		if resp.StatusCode == http.StatusNotFound && json.Unmarshal(data, &apiErr) == nil && apiErr.Code == "not_found" {
+			return errConversationNotFound
+		}
+		return fmt.Errorf("状态码%d: %s", resp.StatusCode, data)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	answered := false // 本轮推理是否已输出answer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &e); err != nil {
+			return fmt.Errorf("解析事件失败: %v", err)
+		}
+		if e.ConversationID != "" && e.ConversationID != conversationID {
+			conversationID = e.ConversationID
+			p.sessionConversationMap.Store(sessionID, conversationID)
+		}
+
+		switch e.Event {
+		case "message", "agent_message":
+			if e.Answer != "" {
+				answered = true
+				onText(e.Answer)
+			}
+		case "agent_thought":
+			if e.Thought != "" && !answered {
+				onText(e.Thought)
+			}
+			answered = false
+		case "message_end":
+			return nil
+		case "error":
+			return fmt.Errorf("%s: %s", e.Code, e.Message)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,108 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+)
+
+func TestResponseWithFunctions(t *testing.T) {
+	requests := make(chan chatRequest, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat-messages" || r.Header.Get("Authorization") != "Bearer key" {
+			http.NotFound(w, r)
+			return
+		}
+		var req chatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+		if req.ConversationID == "deleted" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"not_found","message":"Conversation Not Exists.","status":404}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch req.Query {
+		case "查一下天气":
+			// Agent应用：第一轮调用工具，thought与agent_message重复；第二轮只有thought
+			fmt.Fprint(w, `data: {"event":"agent_thought","conversation_id":"conv-1","thought":""}
+
+data: {"event":"agent_message","conversation_id":"conv-1","answer":"我查一下。"}
+
+data: {"event":"agent_thought","conversation_id":"conv-1","thought":"我查一下。","tool":"weather"}
+
+data: {"event":"agent_thought","conversation_id":"conv-1","thought":"北京晴。"}
+
+data: {"event":"message_end","conversation_id":"conv-1"}
+
+`)
+		default:
+			fmt.Fprint(w, `event: ping
+
+data: {"event":"message","conversation_id":"conv-1","answer":"你好"}
+
+data: {"event":"message","conversation_id":"conv-1","answer":"，我是小智"}
+
+data: {"event":"message_end","conversation_id":"conv-1"}
+
+`)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&llm.Config{BaseURL: server.URL + "/v1", APIKey: "key"})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	provider.SetIdentityFlag("device", "aa:bb")
+
+	tests := []struct {
+		name             string
+		query            string
+		conversationID   string // 请求前预置的会话
+		wantConversation []string
+		want             string
+	}{
+		{name: "新会话", query: "你好", wantConversation: []string{""}, want: "你好，我是小智"},
+		{name: "沿用会话", query: "查一下天气", wantConversation: []string{"conv-1"}, want: "我查一下。北京晴。"},
+		{name: "会话不存在时重建", query: "你好", conversationID: "deleted", wantConversation: []string{"deleted", ""}, want: "你好，我是小智"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.conversationID != "" {
+				provider.(*Provider).sessionConversationMap.Store("session", tt.conversationID)
+			}
+			responses, err := provider.ResponseWithFunctions(context.Background(), "session", []types.Message{
+				{Role: "system", Content: "你是小智"},
+				{Role: "user", Content: tt.query},
+			}, nil)
+			if err != nil {
+				t.Fatalf("ResponseWithFunctions() error = %v", err)
+			}
+			var got string
+			for r := range responses {
+				if r.Error != "" {
+					t.Fatalf("响应错误: %s", r.Error)
+				}
+				got += r.Content
+			}
+			if got != tt.want {
+				t.Errorf("回复 = %q, want %q", got, tt.want)
+			}
+			for _, want := range tt.wantConversation {
+				req := <-requests
+				if req.ConversationID != want || req.User != "device-aa:bb" || req.Query != tt.query || req.ResponseMode != "streaming" {
+					t.Errorf("请求 = %+v, want conversation_id %q", req, want)
+				}
+			}
+			if id, _ := provider.(*Provider).sessionConversationMap.Load("session"); id != "conv-1" {
+				t.Errorf("conversation_id = %v, want conv-1", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package dify
+
+// chatRequest chat-messages 请求体
+type chatRequest struct {
+	Inputs         map[string]interface{} `json:"inputs"`
+	Query          string                 `json:"query"`
+	ResponseMode   string                 `json:"response_mode"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	User           string                 `json:"user"`
+}
+
+// event 流式响应的SSE事件
+type event struct {
+	Event          string `json:"event"`
+	ConversationID string `json:"conversation_id"`
+
+	// message、agent_message
+	Answer string `json:"answer"`
+
+	// agent_thought
+	Thought string `json:"thought"`
+
+	// error
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,187 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 流式输出时每个片段的字符数
+const chunkRunes = 4
+
+// reply 预设的一次回复，calls不为空时表示工具调用
+type reply struct {
+	text  string
+	calls []call
+}
+
+type call struct {
+	tool      string
+	arguments string
+}
+
+// Provider 离线测试用的LLM，不调用任何服务。
+// 每次请求按顺序返回replies中的下一条回复，用完后从头循环：
+// 字符串按片段流式输出，{tool, arguments}输出一次工具调用，
+// {tools: [{tool, arguments}, ...]}在一次回复中输出多个工具调用。
+type Provider struct {
+	*llm.BaseProvider
+	replies []reply
+
+	mu   sync.Mutex
+	next int // 下一条回复的序号
+}
+
+// 注册提供者
+func init() {
+	llm.Register("fake", NewProvider)
+}
+
+// NewProvider 创建fake LLM提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	provider := &Provider{BaseProvider: llm.NewBaseProvider(config)}
+
+	list, _ := config.Extra["replies"].([]interface{})
+	for _, item := range list {
+		r, err := parseReply(item)
+		if err != nil {
+			return nil, err
+		}
+		provider.replies = append(provider.replies, r)
+	}
+	if len(provider.replies) == 0 {
+		provider.replies = []reply{{text: "你好，我是小智。"}}
+	}
+	return provider, nil
+}
+
+func parseReply(item interface{}) (reply, error) {
+	switch v := item.(type) {
+	case string:
+		return reply{text: v}, nil
+	case map[string]interface{}:
+		tools, ok := v["tools"].([]interface{})
+		if !ok {
+			tools = []interface{}{v}
+		}
+		var r reply
+		for _, item := range tools {
+			c, err := parseCall(item)
+			if err != nil {
+				return reply{}, err
+			}
+			r.calls = append(r.calls, c)
+		}
+		if len(r.calls) == 0 {
+			return reply{}, fmt.Errorf("工具调用列表为空: %v", v)
+		}
+		return r, nil
+	default:
+		return reply{}, fmt.Errorf("不支持的回复格式: %v", item)
+	}
+}
+
+func parseCall(item interface{}) (call, error) {
+	v, _ := item.(map[string]interface{})
+	name, _ := v["tool"].(string)
+	if name == "" {
+		return call{}, fmt.Errorf("工具调用缺少tool: %v", item)
+	}
+	arguments := "{}"
+	if args, ok := v["arguments"]; ok {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return call{}, fmt.Errorf("工具调用参数序列化失败: %v", err)
+		}
+		arguments = string(data)
+	}
+	return call{tool: name, arguments: arguments}, nil
+}
+
+// nextReply 取下一条回复，textOnly为true时跳过工具调用
+func (p *Provider) nextReply(textOnly bool) reply {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for range p.replies {
+		r := p.replies[p.next%len(p.replies)]
+		p.next++
+		if !textOnly || len(r.calls) == 0 {
+			return r
+		}
+	}
+	return reply{}
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+	r := p.nextReply(true)
+
+	go func() {
+		defer close(responseChan)
+		for _, chunk := range splitRunes(r.text, chunkRunes) {
+			select {
+			case responseChan <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+	r := p.nextReply(false)
+
+	go func() {
+		defer close(responseChan)
+
+		if len(r.calls) > 0 {
+			toolCalls := make([]types.ToolCall, len(r.calls))
+			for i, c := range r.calls {
+				toolCalls[i] = types.ToolCall{
+					ID:   uuid.New().String(),
+					Type: "function",
+					Function: types.FunctionCall{
+						Name:      c.tool,
+						Arguments: c.arguments,
+					},
+					Index: i,
+				}
+			}
+			responseChan <- types.Response{ToolCalls: toolCalls}
+			return
+		}
+
+		for _, chunk := range splitRunes(r.text, chunkRunes) {
+			select {
+			case responseChan <- types.Response{Content: chunk}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// splitRunes 按字符数切分文本，模拟流式输出
+func splitRunes(text string, size int) []string {
+	runes := []rune(text)
+	chunks := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); start += size {
+		end := min(start+size, len(runes))
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
@@ -0,0 +1,357 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	maxSignatures  = 256
+)
+
+// Provider Google Gemini提供者，使用原生streamGenerateContent接口，支持函数调用
+type Provider struct {
+	*llm.BaseProvider
+	baseURL string
+	client  *http.Client
+
+	// 思考模型的函数调用带有thoughtSignature，回传历史时需要原样带上
+	mu         sync.Mutex
+	signatures map[string]string // 工具调用ID -> thoughtSignature
+}
+
+// 注册提供者
+func init() {
+	llm.Register("gemini", NewProvider)
+}
+
+// NewProvider 创建Gemini提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		baseURL:      baseURL,
+		client:       &http.Client{},
+		signatures:   make(map[string]string),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Gemini API key")
+	}
+	if config.ModelName == "" {
+		return fmt.Errorf("missing Gemini model_name")
+	}
+	return nil
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		err := p.stream(ctx, messages, nil, func(chunk types.Response) {
+			if chunk.Content != "" {
+				responseChan <- chunk.Content
+			}
+		})
+		if err != nil {
+			responseChan <- fmt.Sprintf("【Gemini服务响应异常: %v】", err)
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+
+		err := p.stream(ctx, messages, tools, func(chunk types.Response) {
+			responseChan <- chunk
+		})
+		if err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Gemini服务响应异常: %v】", err),
+				Error:   err.Error(),
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// stream 发起流式请求，将响应转换为types.Response交给onChunk
+func (p *Provider) stream(ctx context.Context, messages []types.Message, tools []openai.Tool, onChunk func(types.Response)) error {
+	config := p.Config()
+	system, contents := p.convertMessages(messages)
+	request := generateRequest{
+		Contents:          contents,
+		SystemInstruction: system,
+	}
+	if config.Temperature > 0 || config.TopP > 0 || config.MaxTokens > 0 {
+		request.GenerationConfig = &generationConfig{MaxOutputTokens: config.MaxTokens}
+		if config.Temperature > 0 {
+			request.GenerationConfig.Temperature = &config.Temperature
+		}
+		if config.TopP > 0 {
+			request.GenerationConfig.TopP = &config.TopP
+		}
+	}
+	if declarations := convertTools(tools); len(declarations) > 0 {
+		request.Tools = []tool{{FunctionDeclarations: declarations}}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.baseURL, config.ModelName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", config.APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("状态码%d: %s", resp.StatusCode, data)
+	}
+	return p.readEvents(resp.Body, onChunk)
+}
+
+// readEvents 解析SSE数据块。
+// Gemini的函数调用一次性返回完整参数且可能没有ID，这里为每个调用生成ID，
+// 保证genResponseByLLM按原生工具调用处理。
+func (p *Provider) readEvents(r io.Reader, onChunk func(types.Response)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	toolIndex := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var chunk generateResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &chunk); err != nil {
+			return fmt.Errorf("解析响应失败: %v", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s: %s", chunk.Error.Status, chunk.Error.Message)
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				call := part.FunctionCall
+				id := call.ID
+				if id == "" {
+					id = "call_" + uuid.New().String()
+				}
+				if part.ThoughtSignature != "" {
+					p.saveSignature(id, part.ThoughtSignature)
+				}
+				arguments := "{}"
+				if len(call.Args) > 0 && string(call.Args) != "null" {
+					arguments = string(call.Args)
+				}
+				onChunk(types.Response{ToolCalls: []types.ToolCall{{
+					ID:       id,
+					Type:     "function",
+					Function: types.FunctionCall{Name: call.Name, Arguments: arguments},
+					Index:    toolIndex,
+				}}})
+				toolIndex++
+			case part.Thought:
+				// 思考过程不播报
+			case part.Text != "":
+				onChunk(types.Response{Content: part.Text})
+			}
+		}
+		if candidate.FinishReason != "" {
+			onChunk(types.Response{StopReason: candidate.FinishReason})
+		}
+	}
+	return scanner.Err()
+}
+
+func (p *Provider) saveSignature(id, signature string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 只有最近几轮的签名有用，超出上限时直接清空
+	if len(p.signatures) >= maxSignatures {
+		p.signatures = make(map[string]string)
+	}
+	p.signatures[id] = signature
+}
+
+func (p *Provider) signature(id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.signatures[id]
+}
+
+// convertMessages 将对话消息转换为Gemini格式。
+// system消息合并为systemInstruction；assistant对应model角色，工具调用转为functionCall；
+// tool消息转为user角色的functionResponse，函数名从之前的工具调用中按ID查找；
+// 相邻的同角色消息合并为一条。
+func (p *Provider) convertMessages(messages []types.Message) (*content, []content) {
+	var system []part
+	var result []content
+	toolNames := make(map[string]string)
+	for _, msg := range messages {
+		role := "user"
+		var parts []part
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, part{Text: msg.Content})
+			}
+			continue
+		case "tool":
+			parts = append(parts, part{FunctionResponse: &functionResponse{
+				Name:     toolNames[msg.ToolCallID],
+				Response: toolResult(msg.Content),
+			}})
+		case "assistant":
+			role = "model"
+			fallthrough
+		default:
+			if msg.Content != "" {
+				parts = append(parts, part{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, part{
+					FunctionCall:     &functionCall{Name: tc.Function.Name, Args: args},
+					ThoughtSignature: p.signature(tc.ID),
+				})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Parts = append(result[n-1].Parts, parts...)
+		} else {
+			result = append(result, content{Role: role, Parts: parts})
+		}
+	}
+
+	if len(system) == 0 {
+		return nil, result
+	}
+	return &content{Parts: system}, result
+}
+
+// toolResult functionResponse.response必须是JSON对象，非对象的结果包装为{"result": ...}
+func toolResult(text string) json.RawMessage {
+	var object map[string]interface{}
+	if json.Unmarshal([]byte(text), &object) == nil && object != nil {
+		return json.RawMessage(text)
+	}
+	data, _ := json.Marshal(map[string]string{"result": text})
+	return data
+}
+
+// convertTools 将OpenAI格式的函数定义转换为Gemini函数声明
+func convertTools(tools []openai.Tool) []functionDeclaration {
+	var result []functionDeclaration
+	for _, t := range tools {
+		if t.Function == nil {
+			continue
+		}
+		result = append(result, functionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  convertSchema(t.Function.Parameters),
+		})
+	}
+	return result
+}
+
+// convertSchema Gemini只支持OpenAPI Schema的子集，去掉不支持的字段；
+// 没有属性的对象参数直接省略，否则接口会报错
+func convertSchema(parameters interface{}) interface{} {
+	if parameters == nil {
+		return nil
+	}
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil || schema == nil {
+		return nil
+	}
+	if properties, _ := schema["properties"].(map[string]interface{}); len(properties) == 0 {
+		return nil
+	}
+	return cleanSchema(schema)
+}
+
+func cleanSchema(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		delete(v, "$schema")
+		delete(v, "additionalProperties")
+		for key, child := range v {
+			if key == "properties" {
+				// properties的键是参数名，不能当作schema字段过滤
+				if properties, ok := child.(map[string]interface{}); ok {
+					for name, property := range properties {
+						properties[name] = cleanSchema(property)
+					}
+				}
+				continue
+			}
+			v[key] = cleanSchema(child)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = cleanSchema(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,141 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const functionCallStream = `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"好的，"}]}}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"北京"}},"thoughtSignature":"sig"}]},"finishReason":"STOP"}]}
+
+`
+
+func TestResponseWithFunctions(t *testing.T) {
+	var got generateRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path + "?" + r.URL.RawQuery
+		if r.Header.Get("x-goog-api-key") != "key" {
+			http.Error(w, `{"error":{"code":403}}`, http.StatusForbidden)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, functionCallStream)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&llm.Config{BaseURL: server.URL + "/v1beta/", APIKey: "key", ModelName: "gemini-flash"})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+		Name: "get_weather",
+		Parameters: map[string]interface{}{
+			"$schema":              "http://json-schema.org/draft-07/schema#",
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{"type": "string"},
+			},
+		},
+	}}}
+	responses, err := provider.ResponseWithFunctions(context.Background(), "", []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京天气"},
+	}, tools)
+	if err != nil {
+		t.Fatalf("ResponseWithFunctions() error = %v", err)
+	}
+
+	var content, stopReason string
+	var toolCalls []types.ToolCall
+	for r := range responses {
+		if r.Error != "" {
+			t.Fatalf("响应错误: %s", r.Error)
+		}
+		content += r.Content
+		toolCalls = append(toolCalls, r.ToolCalls...)
+		if r.StopReason != "" {
+			stopReason = r.StopReason
+		}
+	}
+
+	if path != "/v1beta/models/gemini-flash:streamGenerateContent?alt=sse" {
+		t.Errorf("请求地址 = %s", path)
+	}
+	if content != "好的，" || stopReason != "STOP" {
+		t.Errorf("content = %q, stopReason = %q", content, stopReason)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].ID == "" || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"city":"北京"}` {
+		t.Fatalf("toolCalls = %+v", toolCalls)
+	}
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "你是小智" || len(got.Contents) != 1 {
+		t.Errorf("请求 = %+v", got)
+	}
+	wantSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+	}
+	if len(got.Tools) != 1 || !reflect.DeepEqual(got.Tools[0].FunctionDeclarations[0].Parameters, wantSchema) {
+		t.Errorf("工具 = %+v", got.Tools)
+	}
+
+	// 回传历史时带上函数调用的thoughtSignature
+	_, contents := provider.(*Provider).convertMessages([]types.Message{{Role: "assistant", ToolCalls: toolCalls}})
+	if contents[0].Parts[0].ThoughtSignature != "sig" {
+		t.Errorf("thoughtSignature = %q, want sig", contents[0].Parts[0].ThoughtSignature)
+	}
+}
+
+func TestConvertMessages(t *testing.T) {
+	provider, _ := NewProvider(&llm.Config{})
+	system, got := provider.(*Provider).convertMessages([]types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京天气"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: "call_1", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: "晴"},
+		{Role: "user", Content: "谢谢"},
+		{Role: "assistant", Content: "不客气"},
+	})
+	want := []content{
+		{Role: "user", Parts: []part{{Text: "北京天气"}}},
+		{Role: "model", Parts: []part{{FunctionCall: &functionCall{Name: "get_weather", Args: json.RawMessage(`{"city":"北京"}`)}}}},
+		{Role: "user", Parts: []part{
+			{FunctionResponse: &functionResponse{Name: "get_weather", Response: json.RawMessage(`{"result":"晴"}`)}},
+			{Text: "谢谢"},
+		}},
+		{Role: "model", Parts: []part{{Text: "不客气"}}},
+	}
+	if system == nil || system.Parts[0].Text != "你是小智" || !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("convertMessages() = %s", gotJSON)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	provider, _ := NewProvider(&llm.Config{BaseURL: server.URL, APIKey: "key", ModelName: "gemini-flash"})
+	responses, _ := provider.ResponseWithFunctions(context.Background(), "", []types.Message{{Role: "user", Content: "你好"}}, nil)
+	r := <-responses
+	if !strings.Contains(r.Error, "API key not valid") || !strings.Contains(r.Content, "服务响应异常") {
+		t.Errorf("response = %+v", r)
+	}
+}
@@ -220,6 +220,11 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 								Name:      tc.Function.Name,
 								Arguments: tc.Function.Arguments,
 							},
+							Index: i,
+						}
+						// 并行工具调用时按index区分属于哪个调用的增量
+						if tc.Index != nil {
+							toolCalls[i].Index = *tc.Index
 						}
 					}
 					responseChan <- types.Response{
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	defaultMaxEntries = 20
+	defaultQueryLimit = 5
+	summaryTimeout    = 30 * time.Second
+)
+
+// summaryPrompt 总结对话生成记忆的提示词
+const summaryPrompt = `请将下面用户与助手的对话总结为一条简洁的长期记忆，只保留值得在以后对话中记住的内容，` +
+	`例如用户的称呼、个人信息、喜好、计划和约定。使用第三人称描述用户，不超过200字。` +
+	`如果没有值得记住的内容，只回复“无”。`
+
+// Config 记忆配置结构
+type Config struct {
+	Name       string // 记忆提供者名称
+	Type       string
+	MaxEntries int // 每个设备最多保留的记忆条数
+	QueryLimit int // 每次注入对话的记忆条数
+}
+
+// Provider 记忆提供者接口
+type Provider interface {
+	chat.MemoryInterface
+}
+
+// BaseProvider 记忆基础实现，负责调用LLM总结对话
+type BaseProvider struct {
+	config   *Config
+	deviceID string
+	logger   *utils.Logger
+}
+
+// NewBaseProvider 创建记忆基础提供者
+func NewBaseProvider(config *Config, deviceID string, logger *utils.Logger) *BaseProvider {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultMaxEntries
+	}
+	if config.QueryLimit <= 0 {
+		config.QueryLimit = defaultQueryLimit
+	}
+	return &BaseProvider{
+		config:   config,
+		deviceID: deviceID,
+		logger:   logger,
+	}
+}
+
+// Config 获取配置
+func (p *BaseProvider) Config() *Config {
+	return p.config
+}
+
+// DeviceID 获取记忆所属的设备ID
+func (p *BaseProvider) DeviceID() string {
+	return p.deviceID
+}
+
+// Logger 获取日志
+func (p *BaseProvider) Logger() *utils.Logger {
+	return p.logger
+}
+
+// Summarize 使用LLM将对话总结为一条记忆，没有值得记住的内容时返回空字符串
+func (p *BaseProvider) Summarize(llm types.LLMProvider, dialogue []chat.Message) (string, error) {
+	if llm == nil {
+		return "", fmt.Errorf("未配置LLM，无法总结对话")
+	}
+
+	var sb strings.Builder
+	userMessages := 0
+	for _, msg := range dialogue {
+		if msg.Content == "" || len(msg.ToolCalls) > 0 {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			userMessages++
+			sb.WriteString("用户: ")
+		case "assistant":
+			sb.WriteString("助手: ")
+		default:
+			continue
+		}
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+	if userMessages == 0 {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+
+	messages := []types.Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: sb.String()},
+	}
+	responses, err := llm.Response(ctx, "memory-"+p.deviceID, messages)
+	if err != nil {
+		return "", fmt.Errorf("LLM总结对话失败: %v", err)
+	}
+
+	var result strings.Builder
+	for content := range responses {
+		result.WriteString(content)
+	}
+
+	summary := strings.TrimSpace(result.String())
+	if summary == "" || strings.Trim(summary, "。. ") == "无" {
+		return "", nil
+	}
+	return summary, nil
+}
+
+// FormatMemories 将记忆格式化为注入对话的系统消息
+func FormatMemories(memories []string) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("以下是你与该用户以往对话的记忆，回答时可以参考，但不要主动复述：\n")
+	for _, memory := range memories {
+		sb.WriteString("- ")
+		sb.WriteString(memory)
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Factory 记忆工厂函数类型
+type Factory func(config *Config, deviceID string, logger *utils.Logger) (Provider, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册记忆提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建记忆提供者实例
+func Create(name string, config *Config, deviceID string, logger *utils.Logger) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的记忆提供者: %s", name)
+	}
+
+	provider, err := factory(config, deviceID, logger)
+	if err != nil {
+		return nil, fmt.Errorf("创建记忆提供者失败: %v", err)
+	}
+	return provider, nil
+}
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/providers/memory"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Provider 基于SQLite的长期记忆，按设备ID存储LLM总结的记忆
+type Provider struct {
+	*memory.BaseProvider
+	db *gorm.DB
+}
+
+// NewProvider 创建SQLite记忆提供者
+func NewProvider(config *memory.Config, deviceID string, logger *utils.Logger) (*Provider, error) {
+	if deviceID == "" {
+		return nil, fmt.Errorf("设备ID为空，无法使用长期记忆")
+	}
+	if database.DB == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	return &Provider{
+		BaseProvider: memory.NewBaseProvider(config, deviceID, logger),
+		db:           database.DB,
+	}, nil
+}
+
+// QueryMemory 查询与query相关的记忆，query为空时返回最近的记忆
+func (p *Provider) QueryMemory(query string) (string, error) {
+	var records []models.Memory
+	err := p.db.Where("device_id = ?", p.DeviceID()).
+		Order("created_at DESC").
+		Limit(p.Config().MaxEntries).
+		Find(&records).Error
+	if err != nil {
+		return "", fmt.Errorf("查询记忆失败: %v", err)
+	}
+
+	records = rankMemories(records, query, p.Config().QueryLimit)
+	contents := make([]string, 0, len(records))
+	for _, record := range records {
+		contents = append(contents, record.Content)
+	}
+	return memory.FormatMemories(contents), nil
+}
+
+// SaveMemory 使用llm总结对话并保存，超出max_entries时删除最早的记忆
+func (p *Provider) SaveMemory(llm types.LLMProvider, dialogue []chat.Message) error {
+	summary, err := p.Summarize(llm, dialogue)
+	if err != nil {
+		return err
+	}
+	if summary == "" {
+		return nil
+	}
+
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.Memory{DeviceID: p.DeviceID(), Content: summary}).Error; err != nil {
+			return fmt.Errorf("保存记忆失败: %v", err)
+		}
+
+		// 只保留最近的max_entries条记忆
+		var expired []uint
+		err := tx.Model(&models.Memory{}).
+			Where("device_id = ?", p.DeviceID()).
+			Order("created_at DESC").
+			Offset(p.Config().MaxEntries).
+			Pluck("id", &expired).Error
+		if err != nil {
+			return fmt.Errorf("查询过期记忆失败: %v", err)
+		}
+		if len(expired) > 0 {
+			if err := tx.Delete(&models.Memory{}, expired).Error; err != nil {
+				return fmt.Errorf("删除过期记忆失败: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ClearMemory 清空该设备的所有记忆
+func (p *Provider) ClearMemory() error {
+	if err := p.db.Where("device_id = ?", p.DeviceID()).Delete(&models.Memory{}).Error; err != nil {
+		return fmt.Errorf("清空记忆失败: %v", err)
+	}
+	return nil
+}
+
+// rankMemories 按与query共有的字符二元组数量排序，相同时保持时间倒序，返回前limit条
+func rankMemories(records []models.Memory, query string, limit int) []models.Memory {
+	if query != "" {
+		queryGrams := bigrams(query)
+		scores := make(map[uint]int, len(records))
+		for _, record := range records {
+			for gram := range bigrams(record.Content) {
+				if _, ok := queryGrams[gram]; ok {
+					scores[record.ID]++
+				}
+			}
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return scores[records[i].ID] > scores[records[j].ID]
+		})
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
+
+func bigrams(text string) map[string]struct{} {
+	runes := []rune(strings.ToLower(utils.RemoveAllPunctuation(text)))
+	grams := make(map[string]struct{}, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] == ' ' || runes[i+1] == ' ' {
+			continue
+		}
+		grams[string(runes[i:i+2])] = struct{}{}
+	}
+	return grams
+}
+
+func init() {
+	memory.Register("sqlite", func(config *memory.Config, deviceID string, logger *utils.Logger) (memory.Provider, error) {
+		return NewProvider(config, deviceID, logger)
+	})
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/providers/memory"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/sashabaranov/go-openai"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeLLM 直接返回固定的总结内容
+type fakeLLM struct {
+	summary string
+}
+
+func (f *fakeLLM) Initialize() error { return nil }
+func (f *fakeLLM) Cleanup() error    { return nil }
+
+func (f *fakeLLM) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	ch := make(chan string, 1)
+	ch <- f.summary
+	close(ch)
+	return ch, nil
+}
+
+func (f *fakeLLM) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	return nil, nil
+}
+
+func (f *fakeLLM) GetSessionID() string                       { return "" }
+func (f *fakeLLM) SetIdentityFlag(idType string, flag string) {}
+
+func TestSaveAndQueryMemory(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Memory{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	origin := database.DB
+	database.DB = db
+	defer func() { database.DB = origin }()
+
+	llm := &fakeLLM{}
+	provider, err := NewProvider(&memory.Config{Type: "sqlite", MaxEntries: 2, QueryLimit: 1}, "aa:bb", nil)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	dialogue := []chat.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "我叫小明"},
+		{Role: "assistant", Content: "你好小明"},
+	}
+
+	for _, summary := range []string{"用户喜欢踢足球", "用户叫小明", "用户养了一只猫", "无"} {
+		llm.summary = summary
+		if err := provider.SaveMemory(llm, dialogue); err != nil {
+			t.Fatalf("SaveMemory() error = %v", err)
+		}
+	}
+
+	var count int64
+	db.Model(&models.Memory{}).Where("device_id = ?", "aa:bb").Count(&count)
+	if count != 2 {
+		t.Errorf("记忆条数 = %d, want 2", count)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "用户养了一只猫"},
+		{"小明今天想做什么", "用户叫小明"},
+	}
+	for _, tt := range tests {
+		got, err := provider.QueryMemory(tt.query)
+		if err != nil {
+			t.Fatalf("QueryMemory(%q) error = %v", tt.query, err)
+		}
+		if !strings.Contains(got, tt.want) || strings.Count(got, "\n- ") != 1 {
+			t.Errorf("QueryMemory(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	if err := provider.ClearMemory(); err != nil {
+		t.Fatalf("ClearMemory() error = %v", err)
+	}
+	if got, _ := provider.QueryMemory(""); got != "" {
+		t.Errorf("清空后QueryMemory() = %q, want empty", got)
+	}
+}
@@ -2,12 +2,14 @@ package deepgram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
+	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/providers/tts"
 
 	"github.com/gorilla/websocket"
@@ -34,13 +36,80 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 
 // ToTTS 实现文本到语音的转换
 func (p *Provider) ToTTS(text string) (string, error) {
+	// 创建临时文件
+	outputDir := p.Config().OutputDir
+	if outputDir == "" {
+		outputDir = "tmp"
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	// ext := getFileExtension(p.Config().Encoding)
+	ext := "mp3"
+	tempFile := filepath.Join(outputDir, fmt.Sprintf("deepgram_tts_%d.%s", time.Now().UnixNano(), ext))
+	// 接收音频数据
+	var audioBuffer bytes.Buffer
+	err := p.synthesize(context.Background(), p.baseURL, text, func(audio []byte) error {
+		// 缓冲到内存以备完整性检查
+		audioBuffer.Write(audio)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// 写入音频文件
+	if err := os.WriteFile(tempFile, audioBuffer.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+
+	return tempFile, nil
+}
+
+// ToTTSStream 流式合成，请求无容器的linear16编码，收到的PCM数据直接写入通道
+func (p *Provider) ToTTSStream(ctx context.Context, text string, sampleRate int) (<-chan providers.AudioChunk, error) {
+	u := fmt.Sprintf("%s&encoding=linear16&sample_rate=%d&container=none", p.baseURL, sampleRate)
+	conn, err := p.dial(ctx, u, text)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan providers.AudioChunk, 16)
+	go func() {
+		defer close(ch)
+		err := p.receive(ctx, conn, func(audio []byte) error {
+			select {
+			case ch <- providers.AudioChunk{Data: audio}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			ch <- providers.AudioChunk{Err: err}
+		}
+	}()
+	return ch, nil
+}
+
+// synthesize 发起一次合成请求，收到的音频数据依次交给onAudio处理
+func (p *Provider) synthesize(ctx context.Context, u string, text string, onAudio func([]byte) error) error {
+	conn, err := p.dial(ctx, u, text)
+	if err != nil {
+		return err
+	}
+	return p.receive(ctx, conn, onAudio)
+}
+
+// dial 建立WebSocket连接，发送Speak和Flush请求
+func (p *Provider) dial(ctx context.Context, u string, text string) (*websocket.Conn, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("token %s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u, header)
 	if err != nil {
-		return "", fmt.Errorf("连接Deepgram TTS服务器失败: %v", err)
+		return nil, fmt.Errorf("连接Deepgram TTS服务器失败: %v", err)
 	}
-	defer conn.Close()
 
 	// 发送文本消息
 	speakRequest := map[string]string{
@@ -49,41 +118,41 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	}
 	requestBytes, err := json.Marshal(speakRequest)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
 	}
 
 	if err := conn.WriteMessage(websocket.TextMessage, requestBytes); err != nil {
-		return "", fmt.Errorf("发送speak请求失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("发送speak请求失败: %v", err)
 	}
 
 	// 发送Flush控制消息确保所有音频数据返回
 	flushRequest := map[string]string{"type": "Flush"}
 	if err := conn.WriteJSON(flushRequest); err != nil {
-		return "", fmt.Errorf("发送Flush请求失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("发送Flush请求失败: %v", err)
 	}
+	return conn, nil
+}
 
-	// 创建临时文件
-	outputDir := p.Config().OutputDir
-	if outputDir == "" {
-		outputDir = "tmp"
-	}
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败: %v", err)
-	}
+// receive 接收音频数据直到Flushed，ctx取消时关闭连接以中断读取
+func (p *Provider) receive(ctx context.Context, conn *websocket.Conn, onAudio func([]byte) error) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
-	// ext := getFileExtension(p.Config().Encoding)
-	ext := "mp3"
-	tempFile := filepath.Join(outputDir, fmt.Sprintf("deepgram_tts_%d.%s", time.Now().UnixNano(), ext))
-	// 接收音频数据
 	var lastSeqID int
-	// 接收音频数据
-	var audioBuffer bytes.Buffer
+	received := 0
 loop:
 	for {
 		messageType, message, err := conn.ReadMessage()
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
-				return "", fmt.Errorf("接收响应异常: %v", err)
+				return fmt.Errorf("接收响应异常: %v", err)
 			}
 			break // 正常关闭
 		}
@@ -98,7 +167,7 @@ loop:
 			}
 
 			if err := json.Unmarshal(message, &response); err != nil {
-				return "", fmt.Errorf("解析控制消息失败: %v", err)
+				return fmt.Errorf("解析控制消息失败: %v", err)
 			}
 
 			switch response.Type {
@@ -110,13 +179,14 @@ loop:
 				// 服务器确认关闭
 				break loop
 			case "error":
-				return "", fmt.Errorf("Deepgram TTS错误: %s", response.Error)
+				return fmt.Errorf("Deepgram TTS错误: %s", response.Error)
 			}
 		case websocket.BinaryMessage:
 			// 二进制音频数据
-			// 直接写入二进制音频数据到文件
-			// 同时缓冲到内存以备完整性检查
-			audioBuffer.Write(message)
+			received += len(message)
+			if err := onAudio(message); err != nil {
+				return err
+			}
 		case websocket.CloseMessage:
 			break loop
 		}
@@ -124,16 +194,10 @@ loop:
 
 	// 验证音频完整性（可选）
 	// 检查是否接收到音频数据
-	if lastSeqID > 0 && audioBuffer.Len() == 0 {
-		return "", fmt.Errorf("音频数据不完整，最后接收序列号: %d", lastSeqID)
+	if lastSeqID > 0 && received == 0 {
+		return fmt.Errorf("音频数据不完整，最后接收序列号: %d", lastSeqID)
 	}
-
-	// 写入音频文件
-	if err := os.WriteFile(tempFile, audioBuffer.Bytes(), 0644); err != nil {
-		return "", fmt.Errorf("写入音频文件失败: %v", err)
-	}
-
-	return tempFile, nil
+	return nil
 }
 
 // getFileExtension 根据编码获取文件扩展名
@@ -3,6 +3,7 @@ package doubao
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/providers/tts"
 
 	"github.com/google/uuid"
@@ -67,13 +69,92 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 
 // ToTTS 实现文本到语音的转换
 func (p *Provider) ToTTS(text string) (string, error) {
+	// 创建临时文件
+	outputDir := p.Config().OutputDir
+	if outputDir == "" {
+		outputDir = "tmp"
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	tempFile := filepath.Join(outputDir, fmt.Sprintf("doubao_tts_%d.mp3", time.Now().UnixNano()))
+	var audioData []byte
+
+	audioParams := map[string]interface{}{"encoding": "mp3"}
+	err := p.synthesize(context.Background(), text, audioParams, func(audio []byte) error {
+		audioData = append(audioData, audio...)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// 写入音频文件
+	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+
+	return tempFile, nil
+}
+
+// ToTTSStream 流式合成，服务端返回的PCM数据直接写入通道
+func (p *Provider) ToTTSStream(ctx context.Context, text string, sampleRate int) (<-chan providers.AudioChunk, error) {
+	audioParams := map[string]interface{}{
+		"encoding": "pcm",
+		"rate":     sampleRate,
+	}
+	conn, err := p.dial(ctx, text, audioParams)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan providers.AudioChunk, 16)
+	go func() {
+		defer close(ch)
+		err := p.receive(ctx, conn, func(audio []byte) error {
+			select {
+			case ch <- providers.AudioChunk{Data: audio}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			ch <- providers.AudioChunk{Err: err}
+		}
+	}()
+	return ch, nil
+}
+
+// synthesize 发起一次合成请求，收到的音频数据依次交给onAudio处理
+func (p *Provider) synthesize(ctx context.Context, text string, audioParams map[string]interface{}, onAudio func([]byte) error) error {
+	conn, err := p.dial(ctx, text, audioParams)
+	if err != nil {
+		return err
+	}
+	return p.receive(ctx, conn, onAudio)
+}
+
+// dial 建立WebSocket连接并发送合成请求，audioParams覆盖默认的音频参数
+func (p *Provider) dial(ctx context.Context, text string, audioParams map[string]interface{}) (*websocket.Conn, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer;%s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.baseURL, header)
 	if err != nil {
-		return "", fmt.Errorf("连接WebSocket服务器失败: %v", err)
+		return nil, fmt.Errorf("连接WebSocket服务器失败: %v", err)
+	}
+
+	audio := map[string]interface{}{
+		"voice_type":   p.Config().Voice,
+		"encoding":     "mp3",
+		"speed_ratio":  1.0,
+		"volume_ratio": 1.0,
+		"pitch_ratio":  1.0,
+	}
+	for key, value := range audioParams {
+		audio[key] = value
 	}
-	defer conn.Close()
 
 	// 准备请求参数
 	reqParams := map[string]map[string]interface{}{
@@ -85,13 +166,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		"user": {
 			"uid": "uid",
 		},
-		"audio": {
-			"voice_type":   p.Config().Voice,
-			"encoding":     "mp3",
-			"speed_ratio":  1.0,
-			"volume_ratio": 1.0,
-			"pitch_ratio":  1.0,
-		},
+		"audio": audio,
 		"request": {
 			"reqid":     uuid.New().String(),
 			"text":      text,
@@ -103,13 +178,15 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	// 序列化并压缩请求参数
 	jsonData, err := json.Marshal(reqParams)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求参数失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("序列化请求参数失败: %v", err)
 	}
 
 	var b bytes.Buffer
 	w := gzip.NewWriter(&b)
 	if _, err := w.Write(jsonData); err != nil {
-		return "", fmt.Errorf("压缩请求数据失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("压缩请求数据失败: %v", err)
 	}
 	w.Close()
 	compressed := b.Bytes()
@@ -124,45 +201,41 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 	// 发送请求
 	if err := conn.WriteMessage(websocket.BinaryMessage, request); err != nil {
-		return "", fmt.Errorf("发送请求失败: %v", err)
-	}
-
-	// 创建临时文件
-	outputDir := p.Config().OutputDir
-	if outputDir == "" {
-		outputDir = "tmp"
-	}
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
+	return conn, nil
+}
 
-	tempFile := filepath.Join(outputDir, fmt.Sprintf("doubao_tts_%d.mp3", time.Now().UnixNano()))
-	var audioData []byte
+// receive 接收音频数据直到最后一个分片，ctx取消时关闭连接以中断读取
+func (p *Provider) receive(ctx context.Context, conn *websocket.Conn, onAudio func([]byte) error) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
-	// 接收音频数据
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			return "", fmt.Errorf("接收响应失败: %v", err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("接收响应失败: %v", err)
 		}
 
 		resp, err := p.parseResponse(message)
 		if err != nil {
-			return "", fmt.Errorf("解析响应失败: %v", err)
+			return fmt.Errorf("解析响应失败: %v", err)
 		}
 
-		audioData = append(audioData, resp.Audio...)
+		if len(resp.Audio) > 0 {
+			if err := onAudio(resp.Audio); err != nil {
+				return err
+			}
+		}
 		if resp.IsLast {
-			break
+			return nil
 		}
 	}
-
-	// 写入音频文件
-	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
-		return "", fmt.Errorf("写入音频文件失败: %v", err)
-	}
-
-	return tempFile, nil
 }
 
 // parseResponse 解析服务器响应
@@ -0,0 +1,62 @@
+package fake
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	sampleRate    = 24000 // 与服务端下发音频的采样率一致
+	toneHz        = 440
+	msPerRune     = 50  // 每个字符对应的音频时长
+	minDuration   = 200 // 最短音频时长(毫秒)
+	toneAmplitude = 0.3 * math.MaxInt16
+)
+
+// Provider 离线测试用的TTS，不调用任何服务。
+// 按文本长度生成正弦波WAV文件，每个字符50毫秒。
+type Provider struct {
+	*tts.BaseProvider
+}
+
+// NewProvider 创建fake TTS提供者
+func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
+	if config.OutputDir == "" {
+		config.OutputDir = os.TempDir()
+	}
+	return &Provider{BaseProvider: tts.NewBaseProvider(config, deleteFile)}, nil
+}
+
+// ToTTS 生成正弦波音频文件，并返回文件路径
+func (p *Provider) ToTTS(text string) (string, error) {
+	duration := max(utf8.RuneCountInString(text)*msPerRune, minDuration)
+	tempFile := filepath.Join(p.Config().OutputDir, fmt.Sprintf("fake_tts_%d.wav", time.Now().UnixNano()))
+	if err := utils.SaveAudioToWavFile(sineWave(duration), tempFile, sampleRate, 1, 16); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+	return tempFile, nil
+}
+
+// sineWave 生成指定时长的16位单声道正弦波PCM数据
+func sineWave(durationMs int) []byte {
+	samples := sampleRate * durationMs / 1000
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		value := int16(toneAmplitude * math.Sin(2*math.Pi*toneHz*float64(i)/sampleRate))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(value))
+	}
+	return pcm
+}
+
+func init() {
+	tts.Register("fake", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+		return NewProvider(config, deleteFile)
+	})
+}
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/providers/tts"
+)
+
+const (
+	defaultURL     = "https://api.openai.com/v1"
+	defaultModel   = "tts-1"
+	defaultVoice   = "alloy"
+	defaultFormat  = "mp3"
+	requestTimeout = 30 * time.Second
+	speechPath     = "/audio/speech"
+)
+
+// Provider OpenAI兼容的TTS提供者，调用 /v1/audio/speech 接口。
+// CosyVoice、Kokoro、openedai-speech、vLLM等提供该接口的服务都可以使用。
+type Provider struct {
+	*tts.BaseProvider
+	endpoint string
+	client   *http.Client
+}
+
+// speechRequest /audio/speech 请求体
+type speechRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	ResponseFormat string  `json:"response_format"`
+	Speed          float64 `json:"speed,omitempty"`
+}
+
+// NewProvider 创建OpenAI兼容的TTS提供者
+func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
+	if config.URL == "" {
+		config.URL = defaultURL
+	}
+	if config.Model == "" {
+		config.Model = defaultModel
+	}
+	if config.Voice == "" {
+		config.Voice = defaultVoice
+	}
+	if config.ResponseFormat == "" {
+		config.ResponseFormat = defaultFormat
+	}
+	// 服务端只能解码mp3和wav文件
+	if config.ResponseFormat != "mp3" && config.ResponseFormat != "wav" {
+		return nil, fmt.Errorf("不支持的response_format: %s，仅支持mp3和wav", config.ResponseFormat)
+	}
+
+	// url可以是基础地址，也可以是完整的接口地址
+	endpoint := strings.TrimRight(config.URL, "/")
+	if !strings.HasSuffix(endpoint, speechPath) {
+		endpoint += speechPath
+	}
+
+	return &Provider{
+		BaseProvider: tts.NewBaseProvider(config, deleteFile),
+		endpoint:     endpoint,
+		client:       &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// ToTTS 将文本转换为音频文件，并返回文件路径
+func (p *Provider) ToTTS(text string) (string, error) {
+	config := p.Config()
+	outputDir := config.OutputDir
+	if outputDir == "" {
+		outputDir = "tmp"
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	body, err := json.Marshal(speechRequest{
+		Model:          config.Model,
+		Input:          text,
+		Voice:          config.Voice,
+		ResponseFormat: config.ResponseFormat,
+		Speed:          config.Speed,
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求TTS服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	audioData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取音频数据失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("TTS服务返回错误: %d, %s", resp.StatusCode, audioData)
+	}
+	if len(audioData) == 0 {
+		return "", fmt.Errorf("TTS服务返回的音频为空")
+	}
+
+	tempFile := filepath.Join(outputDir, fmt.Sprintf("openai_tts_%d.%s", time.Now().UnixNano(), config.ResponseFormat))
+	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+	return tempFile, nil
+}
+
+func init() {
+	tts.Register("openai", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+		return NewProvider(config, deleteFile)
+	})
+}
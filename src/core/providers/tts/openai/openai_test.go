@@ -0,0 +1,82 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers/tts"
+)
+
+func TestToTTS(t *testing.T) {
+	var got speechRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Input == "" {
+			http.Error(w, "input is required", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		text    string
+		wantErr bool
+	}{
+		{name: "基础地址", url: server.URL + "/v1/", text: "你好"},
+		{name: "完整接口地址", url: server.URL + "/v1/audio/speech", text: "你好"},
+		{name: "服务端返回错误", url: server.URL + "/v1", text: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewProvider(&tts.Config{
+				URL:       tt.url,
+				APIKey:    "key",
+				Speed:     1.2,
+				OutputDir: t.TempDir(),
+				SupportedVoices: []configs.VoiceInfo{
+					{Name: "nova", DisplayName: "诺娃"},
+				},
+			}, true)
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			if err := provider.SetVoice("诺娃"); err != nil {
+				t.Fatalf("SetVoice() error = %v", err)
+			}
+
+			file, err := provider.ToTTS(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToTTS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if data, _ := os.ReadFile(file); string(data) != "audio" || !strings.HasSuffix(file, ".mp3") {
+				t.Errorf("音频文件 %s 内容 = %q", file, data)
+			}
+			want := speechRequest{Model: "tts-1", Input: tt.text, Voice: "nova", ResponseFormat: "mp3", Speed: 1.2}
+			if got != want || auth != "Bearer key" {
+				t.Errorf("请求 = %+v, %s, want %+v", got, auth, want)
+			}
+		})
+	}
+}
+
+func TestNewProviderFormat(t *testing.T) {
+	if _, err := NewProvider(&tts.Config{ResponseFormat: "opus"}, true); err == nil {
+		t.Error("response_format为opus时应返回错误")
+	}
+}
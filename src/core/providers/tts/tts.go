@@ -20,6 +20,11 @@ type Config struct {
 	AppID           string              `yaml:"appid"`
 	Token           string              `yaml:"token"`
 	Cluster         string              `yaml:"cluster"`
+	URL             string              `yaml:"url"`
+	APIKey          string              `yaml:"api_key"`
+	Model           string              `yaml:"model"`
+	Speed           float64             `yaml:"speed"`
+	ResponseFormat  string              `yaml:"response_format"`
 	SupportedVoices []configs.VoiceInfo `yaml:"supported_voices"` // 支持的语音列表
 }
 
@@ -3,12 +3,16 @@ package transport
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
 	"xiaozhi-server-go/src/core"
 	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
 	"xiaozhi-server-go/src/task"
 )
 
@@ -34,12 +38,13 @@ func NewConnectionContextAdapter(
 	taskMgr *task.TaskManager,
 	logger *utils.Logger,
 	req *http.Request,
+	setting *models.UserSetting,
 ) *ConnectionContextAdapter {
 	clientID := conn.GetID()
 	connCtx, connCancel := context.WithCancel(context.Background())
 
 	// 创建ConnectionHandler
-	handler := core.NewConnectionHandler(config, providerSet, logger, req, connCtx)
+	handler := core.NewConnectionHandler(config, providerSet, logger, req, setting, connCtx)
 
 	adapter := &ConnectionContextAdapter{
 		handler:     handler,
@@ -146,6 +151,7 @@ func (a *ConnectionContextAdapter) CreateSafeCallback() func(func(*core.Connecti
 // DefaultConnectionHandlerFactory 默认连接处理器工厂
 type DefaultConnectionHandlerFactory struct {
 	config      *configs.Config
+	configMu    sync.RWMutex
 	poolManager *pool.PoolManager
 	taskMgr     *task.TaskManager
 	logger      *utils.Logger
@@ -166,28 +172,89 @@ func NewDefaultConnectionHandlerFactory(
 	}
 }
 
+// SetConfig 替换新会话使用的配置，已建立的会话不受影响
+func (f *DefaultConnectionHandlerFactory) SetConfig(config *configs.Config) {
+	f.configMu.Lock()
+	defer f.configMu.Unlock()
+	f.config = config
+}
+
 // CreateHandler 实现ConnectionHandlerFactory接口
 func (f *DefaultConnectionHandlerFactory) CreateHandler(
 	conn Connection,
 	req *http.Request,
 ) ConnectionHandler {
+	f.touchDevice(req)
+
+	// 设备绑定了用户时，按用户设置选择提供者
+	setting := f.loadUserSetting(req.Header.Get("Device-Id"))
+	var selected map[string]string
+	if setting != nil {
+		selected = map[string]string{
+			"ASR":   setting.SelectedASR,
+			"LLM":   setting.SelectedLLM,
+			"TTS":   setting.SelectedTTS,
+			"VLLLM": setting.SelectedVLLLM,
+		}
+	}
+
 	// 从资源池获取提供者集合
-	providerSet, err := f.poolManager.GetProviderSet()
+	providerSet, err := f.poolManager.GetProviderSet(selected)
 	if err != nil {
 		f.logger.Error(fmt.Sprintf("获取提供者集合失败: %v", err))
 		return nil
 	}
 
+	f.configMu.RLock()
+	config := f.config
+	f.configMu.RUnlock()
+
 	// 创建连接上下文适配器
 	adapter := NewConnectionContextAdapter(
 		conn,
-		f.config,
+		config,
 		providerSet,
 		f.poolManager,
 		f.taskMgr,
 		f.logger,
 		req,
+		setting,
 	)
 
 	return adapter
 }
+
+// loadUserSetting 获取设备所属用户的设置，设备未绑定用户或数据库不可用时返回nil
+func (f *DefaultConnectionHandlerFactory) loadUserSetting(deviceID string) *models.UserSetting {
+	userDB := database.GetUserDB()
+	if deviceID == "" || userDB == nil {
+		return nil
+	}
+	setting, err := userDB.DeviceSetting(deviceID)
+	if err != nil {
+		f.logger.Error("获取设备 %s 的用户设置失败: %v", deviceID, err)
+		return nil
+	}
+	return setting
+}
+
+// touchDevice 登记建立会话的设备，更新客户端ID、来源IP和最后在线时间
+func (f *DefaultConnectionHandlerFactory) touchDevice(req *http.Request) {
+	deviceDB := database.GetDeviceDB()
+	deviceID := req.Header.Get("Device-Id")
+	if deviceID == "" || deviceDB == nil {
+		return
+	}
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	err := deviceDB.TouchDevice(models.Device{
+		DeviceID: deviceID,
+		ClientID: req.Header.Get("Client-Id"),
+		LastIP:   ip,
+	})
+	if err != nil {
+		f.logger.Error("登记设备 %s 失败: %v", deviceID, err)
+	}
+}
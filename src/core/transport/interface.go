@@ -16,6 +16,10 @@ type Transport interface {
 	SetConnectionHandler(handler ConnectionHandlerFactory)
 	// 获取活跃连接数
 	GetActiveConnectionCount() (int, int)
+	// 获取在线设备的ID
+	GetOnlineDevices() []string
+	// 获取已建立的会话
+	GetSessions() []ConnectionHandler
 	// 获取传输类型
 	GetType() string
 }
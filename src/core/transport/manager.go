@@ -7,6 +7,12 @@ import (
 	"xiaozhi-server-go/src/core/utils"
 )
 
+// ActiveSession 传输层上已建立的会话
+type ActiveSession struct {
+	Transport string // 传输类型
+	Handler   ConnectionHandler
+}
+
 // TransportManager 传输管理器
 type TransportManager struct {
 	transports map[string]Transport
@@ -72,3 +78,44 @@ func (m *TransportManager) GetTransport(name string) Transport {
 	defer m.mu.RUnlock()
 	return m.transports[name]
 }
+
+// GetOnlineDevices 获取所有传输层的在线设备ID
+func (m *TransportManager) GetOnlineDevices() map[string]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	online := make(map[string]bool)
+	for _, transport := range m.transports {
+		for _, deviceID := range transport.GetOnlineDevices() {
+			online[deviceID] = true
+		}
+	}
+	return online
+}
+
+// GetSessions 获取所有传输层已建立的会话
+func (m *TransportManager) GetSessions() []ActiveSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []ActiveSession
+	for _, transport := range m.transports {
+		for _, handler := range transport.GetSessions() {
+			sessions = append(sessions, ActiveSession{Transport: transport.GetType(), Handler: handler})
+		}
+	}
+	return sessions
+}
+
+// GetConnectionStats 获取各传输层的活跃连接数和会话数
+func (m *TransportManager) GetConnectionStats() map[string]map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[string]map[string]int, len(m.transports))
+	for name, transport := range m.transports {
+		connections, sessions := transport.GetActiveConnectionCount()
+		stats[name] = map[string]int{"connections": connections, "sessions": sessions}
+	}
+	return stats
+}
@@ -0,0 +1,183 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/core/auth"
+)
+
+// 与WebSocket保持一致的消息类型
+const (
+	textMessage   = 1
+	binaryMessage = 2
+)
+
+// inboundMessage 设备上行消息
+type inboundMessage struct {
+	messageType int
+	data        []byte
+}
+
+// MqttUDPConnection MQTT+UDP连接适配器
+// 控制消息（JSON）通过MQTT收发，音频通过加密UDP收发，
+// 对ConnectionHandler而言与WebSocket连接没有区别。
+type MqttUDPConnection struct {
+	id         string
+	session    string // 密钥会话ID
+	client     *mqttClient
+	udp        *udpServer
+	udpServer  string // 下发给设备的UDP地址
+	udpPort    int
+	keys       *auth.SessionKeys
+	cipher     *udpCipher
+	ssrc       uint32
+	inbox      chan inboundMessage
+	closeChan  chan struct{}
+	closed     int32
+	lastActive int64
+
+	udpMu     sync.Mutex
+	remote    *net.UDPAddr
+	startTime time.Time
+	sendSeq   uint32
+	recvSeq   uint32
+
+	onClose func(*MqttUDPConnection)
+}
+
+// WriteMessage 发送消息：文本走MQTT，音频走UDP
+func (c *MqttUDPConnection) WriteMessage(messageType int, data []byte) error {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return fmt.Errorf("连接已关闭")
+	}
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+
+	if messageType == binaryMessage {
+		return c.writeAudio(data)
+	}
+	return c.client.publish(data)
+}
+
+// writeAudio 加密并通过UDP发送音频帧
+func (c *MqttUDPConnection) writeAudio(data []byte) error {
+	c.udpMu.Lock()
+	remote := c.remote
+	if remote == nil {
+		c.udpMu.Unlock()
+		// 设备尚未发送过UDP包，无法得知其地址
+		return nil
+	}
+	c.sendSeq++
+	timestamp := uint32(time.Since(c.startTime).Milliseconds())
+	packet := c.cipher.Encrypt(data, timestamp, c.sendSeq)
+	c.udpMu.Unlock()
+
+	return c.udp.writeTo(packet, remote)
+}
+
+// ReadMessage 读取消息
+func (c *MqttUDPConnection) ReadMessage(stopChan <-chan struct{}) (int, []byte, error) {
+	select {
+	case msg := <-c.inbox:
+		return msg.messageType, msg.data, nil
+	case <-c.closeChan:
+		return 0, nil, fmt.Errorf("连接已关闭")
+	case <-stopChan:
+		return 0, nil, fmt.Errorf("连接已停止")
+	}
+}
+
+// deliver 投递设备上行消息
+func (c *MqttUDPConnection) deliver(messageType int, data []byte) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return
+	}
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+	select {
+	case c.inbox <- inboundMessage{messageType: messageType, data: data}:
+	case <-c.closeChan:
+	}
+}
+
+// handleUDPPacket 处理设备上行的UDP音频包
+func (c *MqttUDPConnection) handleUDPPacket(packet []byte, addr *net.UDPAddr) {
+	payload, sequence, err := c.cipher.Decrypt(packet)
+	if err != nil {
+		c.client.transport.logger.Debug("客户端 %s UDP包解析失败: %v", c.id, err)
+		return
+	}
+
+	c.udpMu.Lock()
+	if sequence != 0 && sequence <= c.recvSeq {
+		// 乱序或重放的包直接丢弃
+		c.udpMu.Unlock()
+		return
+	}
+	c.recvSeq = sequence
+	if c.remote == nil || c.remote.String() != addr.String() {
+		c.remote = addr
+	}
+	c.udpMu.Unlock()
+
+	c.deliver(binaryMessage, payload)
+}
+
+// HelloParams 附加到hello响应中的传输参数
+func (c *MqttUDPConnection) HelloParams() map[string]interface{} {
+	return map[string]interface{}{
+		"transport": "udp",
+		"udp": map[string]interface{}{
+			"server": c.udpServer,
+			"port":   c.udpPort,
+			"key":    c.keys.Key,
+			"nonce":  c.cipher.NonceHex(),
+		},
+	}
+}
+
+// Close 关闭连接，通知设备关闭音频通道
+func (c *MqttUDPConnection) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	close(c.closeChan)
+
+	goodbye, _ := json.Marshal(map[string]interface{}{
+		"type": "goodbye",
+	})
+	err := c.client.publish(goodbye)
+
+	if c.onClose != nil {
+		c.onClose(c)
+	}
+	return err
+}
+
+// GetID 获取连接ID
+func (c *MqttUDPConnection) GetID() string {
+	return c.id
+}
+
+// GetType 获取连接类型
+func (c *MqttUDPConnection) GetType() string {
+	return "mqtt_udp"
+}
+
+// IsClosed 检查连接是否已关闭
+func (c *MqttUDPConnection) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// GetLastActiveTime 获取最后活跃时间
+func (c *MqttUDPConnection) GetLastActiveTime() time.Time {
+	return time.Unix(atomic.LoadInt64(&c.lastActive), 0)
+}
+
+// IsStale 检查连接是否过期
+func (c *MqttUDPConnection) IsStale(timeout time.Duration) bool {
+	return time.Since(c.GetLastActiveTime()) > timeout
+}
@@ -0,0 +1,288 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 控制报文类型
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetPubrec      byte = 5
+	packetPubrel      byte = 6
+	packetPubcomp     byte = 7
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+// CONNACK 返回码
+const (
+	connackAccepted          byte = 0
+	connackBadProtocol       byte = 1
+	connackIdentifierInvalid byte = 2
+	connackServerUnavailable byte = 3
+	connackBadCredentials    byte = 4
+	connackNotAuthorized     byte = 5
+)
+
+// 单个报文最大长度，控制消息都是JSON，足够使用
+const maxPacketSize = 1 << 20
+
+// packet 解析后的MQTT报文
+type packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// connectPacket CONNECT报文内容
+type connectPacket struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	CleanSession  bool
+	KeepAlive     uint16
+	ClientID      string
+	Username      string
+	Password      string
+}
+
+// publishPacket PUBLISH报文内容
+type publishPacket struct {
+	Topic    string
+	QoS      byte
+	PacketID uint16
+	Payload  []byte
+}
+
+// subscribePacket SUBSCRIBE/UNSUBSCRIBE报文内容
+type subscribePacket struct {
+	PacketID uint16
+	Topics   []string
+	QoS      []byte
+}
+
+// readPacket 从连接中读取一个完整报文
+func readPacket(r *bufio.Reader) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length := 0
+	multiplier := 1
+	for i := 0; ; i++ {
+		if i >= 4 {
+			return nil, errors.New("剩余长度字段格式错误")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("报文过大: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{Type: header >> 4, Flags: header & 0x0f, Body: body}, nil
+}
+
+// encodePacket 编码报文（固定头 + 剩余长度 + 报文体）
+func encodePacket(packetType, flags byte, body []byte) []byte {
+	buf := make([]byte, 0, len(body)+5)
+	buf = append(buf, packetType<<4|flags)
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, body...)
+}
+
+// packetReader 报文体读取辅助
+type packetReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *packetReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *packetReader) readUint16() (uint16, error) {
+	if r.pos+2 > len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint16(r.data[r.pos:])
+	r.pos += 2
+	return v, nil
+}
+
+func (r *packetReader) readBytes() ([]byte, error) {
+	n, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if r.pos+int(n) > len(r.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *packetReader) readString() (string, error) {
+	b, err := r.readBytes()
+	return string(b), err
+}
+
+func (r *packetReader) remaining() []byte {
+	return r.data[r.pos:]
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// parseConnect 解析CONNECT报文
+func parseConnect(p *packet) (*connectPacket, error) {
+	r := &packetReader{data: p.Body}
+	c := &connectPacket{}
+	var err error
+
+	if c.ProtocolName, err = r.readString(); err != nil {
+		return nil, err
+	}
+	if c.ProtocolLevel, err = r.readByte(); err != nil {
+		return nil, err
+	}
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if c.KeepAlive, err = r.readUint16(); err != nil {
+		return nil, err
+	}
+	c.CleanSession = flags&0x02 != 0
+
+	if c.ClientID, err = r.readString(); err != nil {
+		return nil, err
+	}
+	if flags&0x04 != 0 { // Will Flag，遗嘱消息不支持，仅跳过
+		if _, err = r.readString(); err != nil {
+			return nil, err
+		}
+		if _, err = r.readBytes(); err != nil {
+			return nil, err
+		}
+	}
+	if flags&0x80 != 0 {
+		if c.Username, err = r.readString(); err != nil {
+			return nil, err
+		}
+	}
+	if flags&0x40 != 0 {
+		if c.Password, err = r.readString(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// parsePublish 解析PUBLISH报文
+func parsePublish(p *packet) (*publishPacket, error) {
+	r := &packetReader{data: p.Body}
+	pub := &publishPacket{QoS: (p.Flags >> 1) & 0x03}
+	var err error
+
+	if pub.Topic, err = r.readString(); err != nil {
+		return nil, err
+	}
+	if pub.QoS > 0 {
+		if pub.PacketID, err = r.readUint16(); err != nil {
+			return nil, err
+		}
+	}
+	pub.Payload = r.remaining()
+	return pub, nil
+}
+
+// parseSubscribe 解析SUBSCRIBE/UNSUBSCRIBE报文，UNSUBSCRIBE没有QoS字段
+func parseSubscribe(p *packet, withQoS bool) (*subscribePacket, error) {
+	r := &packetReader{data: p.Body}
+	sub := &subscribePacket{}
+	var err error
+
+	if sub.PacketID, err = r.readUint16(); err != nil {
+		return nil, err
+	}
+	for len(r.remaining()) > 0 {
+		topic, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		sub.Topics = append(sub.Topics, topic)
+		if withQoS {
+			qos, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			sub.QoS = append(sub.QoS, qos)
+		}
+	}
+	return sub, nil
+}
+
+// encodeConnack 编码CONNACK报文
+func encodeConnack(returnCode byte) []byte {
+	return encodePacket(packetConnack, 0, []byte{0, returnCode})
+}
+
+// encodePublish 编码QoS 0的PUBLISH报文
+func encodePublish(topic string, payload []byte) []byte {
+	body := appendString(make([]byte, 0, len(topic)+len(payload)+2), topic)
+	return encodePacket(packetPublish, 0, append(body, payload...))
+}
+
+// encodeAck 编码只携带报文ID的应答报文（PUBACK/PUBREC/PUBCOMP/UNSUBACK）
+func encodeAck(packetType, flags byte, packetID uint16) []byte {
+	return encodePacket(packetType, flags, binary.BigEndian.AppendUint16(nil, packetID))
+}
+
+// encodeSuback 编码SUBACK报文
+func encodeSuback(packetID uint16, granted []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	return encodePacket(packetSuback, 0, append(body, granted...))
+}
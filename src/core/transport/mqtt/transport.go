@@ -0,0 +1,583 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/google/uuid"
+)
+
+// SessionKeyManager 会话密钥管理接口，AuthManager和CryptoManager均已实现
+type SessionKeyManager interface {
+	GenerateSessionKeys(sessionID string) (*auth.SessionKeys, error)
+	RevokeSessionKeys(sessionID string) error
+}
+
+// MqttUDPTransport MQTT+UDP传输层实现
+// 内置一个精简的MQTT 3.1.1服务端，设备直接连接，无需额外部署MQTT Broker。
+type MqttUDPTransport struct {
+	config       *configs.Config
+	logger       *utils.Logger
+	keyManager   SessionKeyManager
+	connHandler  transport.ConnectionHandlerFactory
+	authVerifier atomic.Pointer[auth.HandshakeVerifier] // 为nil时不校验CONNECT，配置重载时替换
+
+	listener net.Listener
+	udp      *udpServer
+	clients  sync.Map // clientID -> *mqttClient
+	sessions sync.Map // clientID -> transport.ConnectionHandler
+	stopOnce sync.Once
+}
+
+// NewMqttUDPTransport 创建新的MQTT+UDP传输层
+// authManager用于生成UDP会话密钥，为nil时使用独立的内存密钥管理器
+func NewMqttUDPTransport(config *configs.Config, logger *utils.Logger, authManager *auth.AuthManager) *MqttUDPTransport {
+	t := &MqttUDPTransport{
+		config: config,
+		logger: logger,
+	}
+	if authManager != nil {
+		t.keyManager = authManager
+	} else {
+		t.keyManager = auth.NewCryptoManager(logger, 0)
+	}
+	return t
+}
+
+// Start 启动MQTT+UDP传输层
+func (t *MqttUDPTransport) Start(ctx context.Context) error {
+	cfg := t.config.Transport.MqttUDP
+	udpAddr := fmt.Sprintf("%s:%d", cfg.UDPIP, cfg.UDPPort)
+	udp, err := newUDPServer(udpAddr, t.logger)
+	if err != nil {
+		return fmt.Errorf("MQTT+UDP传输层启动失败: %v", err)
+	}
+	t.udp = udp
+
+	addr := fmt.Sprintf("%s:%d", cfg.IP, cfg.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.close()
+		return fmt.Errorf("MQTT+UDP传输层启动失败: %v", err)
+	}
+	t.listener = listener
+
+	t.logger.Info("启动MQTT+UDP传输层 mqtt://%s, udp://%s", addr, udpAddr)
+
+	go t.udp.serve()
+
+	// 监听关闭信号
+	go func() {
+		<-ctx.Done()
+		t.Stop()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if isClosedErr(err) {
+				return nil
+			}
+			return fmt.Errorf("MQTT连接接收失败: %v", err)
+		}
+		go t.serveClient(conn)
+	}
+}
+
+// Stop 停止MQTT+UDP传输层
+func (t *MqttUDPTransport) Stop() error {
+	var err error
+	t.stopOnce.Do(func() {
+		t.logger.Info("正在停止MQTT+UDP传输层...")
+
+		if t.listener != nil {
+			err = t.listener.Close()
+		}
+
+		// 关闭所有活动会话和MQTT连接
+		t.sessions.Range(func(key, value interface{}) bool {
+			if handler, ok := value.(transport.ConnectionHandler); ok {
+				handler.Close()
+			}
+			t.sessions.Delete(key)
+			return true
+		})
+		t.clients.Range(func(key, value interface{}) bool {
+			value.(*mqttClient).close()
+			return true
+		})
+
+		if t.udp != nil {
+			t.udp.close()
+		}
+	})
+	return err
+}
+
+// SetAuthVerifier 设置CONNECT认证器，传入nil表示关闭认证
+func (t *MqttUDPTransport) SetAuthVerifier(verifier *auth.HandshakeVerifier) {
+	t.authVerifier.Store(verifier)
+}
+
+// SetConnectionHandler 设置连接处理器工厂
+func (t *MqttUDPTransport) SetConnectionHandler(handler transport.ConnectionHandlerFactory) {
+	t.connHandler = handler
+}
+
+// GetActiveConnectionCount 获取活跃连接数，分别返回MQTT连接数和语音会话数
+func (t *MqttUDPTransport) GetActiveConnectionCount() (int, int) {
+	clients, sessions := 0, 0
+	t.clients.Range(func(key, value interface{}) bool {
+		clients++
+		return true
+	})
+	t.sessions.Range(func(key, value interface{}) bool {
+		sessions++
+		return true
+	})
+	return clients, sessions
+}
+
+// GetOnlineDevices 获取已连接MQTT的设备ID，不要求已建立语音会话
+func (t *MqttUDPTransport) GetOnlineDevices() []string {
+	var devices []string
+	t.clients.Range(func(key, value interface{}) bool {
+		if deviceID := value.(*mqttClient).deviceID; deviceID != "" {
+			devices = append(devices, deviceID)
+		}
+		return true
+	})
+	return devices
+}
+
+// GetSessions 获取已建立的语音会话
+func (t *MqttUDPTransport) GetSessions() []transport.ConnectionHandler {
+	var sessions []transport.ConnectionHandler
+	t.sessions.Range(func(key, value interface{}) bool {
+		if handler, ok := value.(transport.ConnectionHandler); ok {
+			sessions = append(sessions, handler)
+		}
+		return true
+	})
+	return sessions
+}
+
+// GetType 获取传输类型
+func (t *MqttUDPTransport) GetType() string {
+	return "mqtt_udp"
+}
+
+// serveClient 处理单个MQTT连接
+func (t *MqttUDPTransport) serveClient(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	// 第一个报文必须是CONNECT
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(reader)
+	if err != nil || p.Type != packetConnect {
+		t.logger.Warn("MQTT连接 %s 未发送CONNECT报文，关闭连接", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	connect, err := parseConnect(p)
+	if err != nil {
+		t.logger.Warn("MQTT连接 %s CONNECT报文解析失败: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if connect.ProtocolLevel != 3 && connect.ProtocolLevel != 4 {
+		conn.Write(encodeConnack(connackBadProtocol))
+		conn.Close()
+		return
+	}
+	if connect.ClientID == "" {
+		conn.Write(encodeConnack(connackIdentifierInvalid))
+		conn.Close()
+		return
+	}
+	deviceID := connectDeviceID(connect)
+	if code, err := t.authenticate(connect.Password, deviceID); err != nil {
+		t.logger.Warn("MQTT客户端 %s 认证失败: device=%s, remote=%s, reason=%v",
+			connect.ClientID, deviceID, conn.RemoteAddr(), err)
+		conn.Write(encodeConnack(code))
+		conn.Close()
+		return
+	}
+
+	client := &mqttClient{
+		transport: t,
+		conn:      conn,
+		clientID:  connect.ClientID,
+		deviceID:  deviceID,
+		keepAlive: time.Duration(connect.KeepAlive) * time.Second,
+	}
+
+	// 同一客户端ID重复连接时，踢掉旧连接
+	if old, loaded := t.clients.Swap(client.clientID, client); loaded {
+		t.logger.Info("MQTT客户端 %s 重复连接，关闭旧连接", client.clientID)
+		old.(*mqttClient).close()
+	}
+
+	if err := client.write(encodeConnack(connackAccepted)); err != nil {
+		t.clients.CompareAndDelete(client.clientID, client)
+		conn.Close()
+		return
+	}
+	t.logger.Info("MQTT客户端 %s 已连接，设备: %s，来源: %s", client.clientID, client.deviceID, conn.RemoteAddr())
+
+	defer func() {
+		t.clients.CompareAndDelete(client.clientID, client)
+		t.closeSession(client)
+		client.close()
+		t.logger.Info("MQTT客户端 %s 已断开", client.clientID)
+	}()
+
+	for {
+		if client.keepAlive > 0 {
+			conn.SetReadDeadline(time.Now().Add(client.keepAlive * 3 / 2))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		p, err := readPacket(reader)
+		if err != nil {
+			if !isClosedErr(err) {
+				t.logger.Debug("MQTT客户端 %s 读取失败: %v", client.clientID, err)
+			}
+			return
+		}
+		if !t.handlePacket(client, p) {
+			return
+		}
+	}
+}
+
+// authenticate 使用与WebSocket握手相同的规则校验CONNECT，密码作为token，失败时返回CONNACK返回码
+func (t *MqttUDPTransport) authenticate(token, deviceID string) (byte, error) {
+	verifier := t.authVerifier.Load()
+	if verifier == nil {
+		return connackAccepted, nil
+	}
+	status, err := verifier.Verify(token, deviceID)
+	switch {
+	case err == nil:
+		return connackAccepted, nil
+	case status == http.StatusUnauthorized:
+		return connackBadCredentials, err
+	case status == http.StatusForbidden:
+		return connackNotAuthorized, err
+	default:
+		return connackServerUnavailable, err
+	}
+}
+
+// handlePacket 处理报文，返回false表示需要断开连接
+func (t *MqttUDPTransport) handlePacket(client *mqttClient, p *packet) bool {
+	switch p.Type {
+	case packetPublish:
+		pub, err := parsePublish(p)
+		if err != nil {
+			t.logger.Warn("MQTT客户端 %s PUBLISH报文解析失败: %v", client.clientID, err)
+			return false
+		}
+		switch pub.QoS {
+		case 1:
+			client.write(encodeAck(packetPuback, 0, pub.PacketID))
+		case 2:
+			client.write(encodeAck(packetPubrec, 0, pub.PacketID))
+		}
+		t.handleDeviceMessage(client, pub.Payload)
+	case packetPubrel:
+		if len(p.Body) >= 2 {
+			client.write(encodeAck(packetPubcomp, 0, binary.BigEndian.Uint16(p.Body)))
+		}
+	case packetPuback, packetPubrec, packetPubcomp:
+		// 服务端只以QoS 0下发，忽略
+	case packetSubscribe:
+		sub, err := parseSubscribe(p, true)
+		if err != nil {
+			t.logger.Warn("MQTT客户端 %s SUBSCRIBE报文解析失败: %v", client.clientID, err)
+			return false
+		}
+		granted := make([]byte, len(sub.Topics))
+		for i, topic := range sub.Topics {
+			client.subscribe(topic)
+			granted[i] = 0
+		}
+		client.write(encodeSuback(sub.PacketID, granted))
+	case packetUnsubscribe:
+		sub, err := parseSubscribe(p, false)
+		if err != nil {
+			return false
+		}
+		for _, topic := range sub.Topics {
+			client.unsubscribe(topic)
+		}
+		client.write(encodeAck(packetUnsuback, 0, sub.PacketID))
+	case packetPingreq:
+		client.write(encodePacket(packetPingresp, 0, nil))
+	case packetDisconnect:
+		return false
+	default:
+		t.logger.Warn("MQTT客户端 %s 发送了不支持的报文类型: %d", client.clientID, p.Type)
+		return false
+	}
+	return true
+}
+
+// handleDeviceMessage 处理设备通过MQTT上报的JSON消息
+func (t *MqttUDPTransport) handleDeviceMessage(client *mqttClient, payload []byte) {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.logger.Warn("MQTT客户端 %s 消息格式错误: %v", client.clientID, err)
+		return
+	}
+
+	switch msg.Type {
+	case "hello":
+		// hello开启新的语音会话，旧会话先关闭
+		t.closeSession(client)
+		conn, err := t.openSession(client)
+		if err != nil {
+			t.logger.Error("MQTT客户端 %s 创建会话失败: %v", client.clientID, err)
+			return
+		}
+		conn.deliver(textMessage, payload)
+	case "goodbye":
+		t.closeSession(client)
+	default:
+		conn := client.currentConnection()
+		if conn == nil {
+			t.logger.Warn("MQTT客户端 %s 没有活动会话，忽略消息: %s", client.clientID, msg.Type)
+			return
+		}
+		conn.deliver(textMessage, payload)
+	}
+}
+
+// openSession 为客户端创建语音会话：生成UDP密钥并交由ConnectionHandler处理
+func (t *MqttUDPTransport) openSession(client *mqttClient) (*MqttUDPConnection, error) {
+	if t.connHandler == nil {
+		return nil, fmt.Errorf("连接处理器工厂未设置")
+	}
+
+	keySession := uuid.New().String()
+	keys, err := t.keyManager.GenerateSessionKeys(keySession)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn *MqttUDPConnection
+	for {
+		ssrc := uuid.New().ID()
+		cipher, err := newUDPCipher(keys.Key, keys.Nonce, ssrc)
+		if err != nil {
+			t.keyManager.RevokeSessionKeys(keySession)
+			return nil, err
+		}
+		conn = &MqttUDPConnection{
+			id:         client.clientID,
+			session:    keySession,
+			client:     client,
+			udp:        t.udp,
+			udpServer:  t.udpServerAddress(client),
+			udpPort:    t.config.Transport.MqttUDP.UDPPort,
+			keys:       keys,
+			cipher:     cipher,
+			ssrc:       ssrc,
+			inbox:      make(chan inboundMessage, 100),
+			closeChan:  make(chan struct{}),
+			lastActive: time.Now().Unix(),
+			startTime:  time.Now(),
+			onClose:    t.releaseConnection,
+		}
+		if t.udp.register(ssrc, conn) {
+			break
+		}
+	}
+
+	// 构造与WebSocket握手一致的请求头，ConnectionHandler从中读取设备信息
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Device-Id", client.deviceID)
+	req.Header.Set("Client-Id", client.clientID)
+	req.Header.Set("Transport-Type", "mqtt_udp")
+	req.RemoteAddr = client.conn.RemoteAddr().String()
+
+	handler := t.connHandler.CreateHandler(conn, req)
+	if handler == nil {
+		conn.onClose = nil
+		t.releaseConnection(conn)
+		return nil, fmt.Errorf("创建连接处理器失败")
+	}
+
+	client.setConnection(conn)
+	t.sessions.Store(client.clientID, handler)
+	t.logger.Info("MQTT客户端 %s 语音会话已建立，资源已分配", client.clientID)
+
+	go func() {
+		defer func() {
+			t.sessions.CompareAndDelete(client.clientID, handler)
+			handler.Close()
+		}()
+		handler.Handle()
+	}()
+	return conn, nil
+}
+
+// closeSession 关闭客户端当前的语音会话
+func (t *MqttUDPTransport) closeSession(client *mqttClient) {
+	conn := client.currentConnection()
+	if conn == nil {
+		return
+	}
+	if value, ok := t.sessions.LoadAndDelete(client.clientID); ok {
+		value.(transport.ConnectionHandler).Close()
+	}
+	conn.Close()
+}
+
+// releaseConnection 连接关闭后释放UDP会话和密钥
+func (t *MqttUDPTransport) releaseConnection(conn *MqttUDPConnection) {
+	t.udp.unregister(conn.ssrc, conn)
+	conn.client.clearConnection(conn)
+	if err := t.keyManager.RevokeSessionKeys(conn.session); err != nil {
+		t.logger.Debug("撤销会话密钥失败: %v", err)
+	}
+}
+
+// udpServerAddress 下发给设备的UDP地址
+func (t *MqttUDPTransport) udpServerAddress(client *mqttClient) string {
+	if server := t.config.Transport.MqttUDP.UDPServer; server != "" {
+		return server
+	}
+	if addr, ok := client.conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return t.config.Transport.MqttUDP.UDPIP
+}
+
+// connectDeviceID CONNECT报文对应的设备ID，客户端ID不是xiaozhi固件格式时使用用户名
+func connectDeviceID(connect *connectPacket) string {
+	if !strings.Contains(connect.ClientID, "@@@") && connect.Username != "" {
+		return connect.Username
+	}
+	return parseDeviceID(connect.ClientID)
+}
+
+// parseDeviceID 从客户端ID中解析设备ID
+// xiaozhi固件的客户端ID格式为 GID_xxx@@@mac_address@@@uuid，mac中的冒号被替换为下划线
+func parseDeviceID(clientID string) string {
+	parts := strings.Split(clientID, "@@@")
+	if len(parts) >= 2 && parts[1] != "" {
+		return strings.ReplaceAll(parts[1], "_", ":")
+	}
+	return clientID
+}
+
+// isClosedErr 判断是否为连接关闭导致的错误
+func isClosedErr(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled)
+}
+
+// mqttClient 一个MQTT客户端连接
+type mqttClient struct {
+	transport *MqttUDPTransport
+	conn      net.Conn
+	clientID  string
+	deviceID  string
+	keepAlive time.Duration
+
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	topics    []string
+	session   *MqttUDPConnection
+	closeOnce sync.Once
+}
+
+// write 发送原始报文
+func (c *mqttClient) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(data)
+	return err
+}
+
+// publish 向设备下发消息，优先使用设备订阅的主题
+func (c *mqttClient) publish(payload []byte) error {
+	return c.write(encodePublish(c.replyTopic(), payload))
+}
+
+func (c *mqttClient) replyTopic() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range c.topics {
+		if !strings.ContainsAny(topic, "+#") {
+			return topic
+		}
+	}
+	return "devices/p2p/" + c.clientID
+}
+
+func (c *mqttClient) subscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.topics {
+		if t == topic {
+			return
+		}
+	}
+	c.topics = append(c.topics, topic)
+}
+
+func (c *mqttClient) unsubscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.topics {
+		if t == topic {
+			c.topics = append(c.topics[:i], c.topics[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *mqttClient) currentConnection() *MqttUDPConnection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+func (c *mqttClient) setConnection(conn *MqttUDPConnection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = conn
+}
+
+func (c *mqttClient) clearConnection(conn *MqttUDPConnection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == conn {
+		c.session = nil
+	}
+}
+
+func (c *mqttClient) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+	})
+}
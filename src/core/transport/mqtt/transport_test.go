@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// encodeConnect 构造CONNECT报文，password为空时不带用户名密码
+func encodeConnect(clientID, username, password string) []byte {
+	body := appendString(nil, "MQTT")
+	flags := byte(0x02)
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	body = append(body, 4, flags, 0, 60)
+	body = appendString(body, clientID)
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	return encodePacket(packetConnect, 0, body)
+}
+
+func TestMqttConnectAuth(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Device{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	userID := uint(1)
+	db.Create(&models.Device{DeviceID: "aa:bb:cc:dd:ee:01", UserID: &userID})
+	db.Create(&models.Device{DeviceID: "aa:bb:cc:dd:ee:02"})
+	db.Create(&models.Device{DeviceID: "aa:bb:cc:dd:ee:ff", UserID: &userID})
+	database.NewDeviceDB(db)
+
+	config := &configs.Config{}
+	config.Server.Auth.Enabled = true
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: "device-token"}}
+	config.Server.Auth.AllowedDevices = []string{"aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:02"}
+
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+	transport := NewMqttUDPTransport(config, logger, nil)
+	transport.SetAuthVerifier(auth.NewHandshakeVerifier(config))
+
+	tests := []struct {
+		name     string
+		clientID string
+		username string
+		password string
+		expected byte
+	}{
+		{"已激活设备token正确", "GID_test@@@aa_bb_cc_dd_ee_01@@@uuid", "user", "device-token", connackAccepted},
+		{"缺少密码", "GID_test@@@aa_bb_cc_dd_ee_01@@@uuid", "", "", connackBadCredentials},
+		{"密码错误", "GID_test@@@aa_bb_cc_dd_ee_01@@@uuid", "user", "bad-token", connackBadCredentials},
+		{"未激活设备", "GID_test@@@aa_bb_cc_dd_ee_02@@@uuid", "user", "device-token", connackNotAuthorized},
+		{"白名单设备", "GID_test@@@aa_bb_cc_dd_ee_ff@@@uuid", "", "", connackAccepted},
+		{"白名单设备未激活", "GID_test@@@aa_bb_cc_dd_ee_02@@@uuid", "", "", connackNotAuthorized},
+		{"非固件格式客户端ID使用用户名作为设备ID", "client-1", "aa:bb:cc:dd:ee:01", "device-token", connackAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			go transport.serveClient(server)
+
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := client.Write(encodeConnect(tt.clientID, tt.username, tt.password)); err != nil {
+				t.Fatalf("发送CONNECT失败: %v", err)
+			}
+			p, err := readPacket(bufio.NewReader(client))
+			if err != nil || p.Type != packetConnack || len(p.Body) != 2 {
+				t.Fatalf("读取CONNACK失败: %+v, %v", p, err)
+			}
+			if p.Body[1] != tt.expected {
+				t.Errorf("CONNACK返回码 = %d, 期望 %d", p.Body[1], tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// UDP音频包格式（与xiaozhi固件一致）：
+//
+//	|type 1B|flags 1B|payload_len 2B|ssrc 4B|timestamp 4B|sequence 4B|payload...|
+//
+// 前16字节既是包头也是AES-128-CTR的计数器初始值，payload为加密后的Opus数据。
+const (
+	udpHeaderSize     = 16
+	udpPacketTypeOpus = 0x01
+)
+
+// udpCipher 会话音频加解密器
+type udpCipher struct {
+	block cipher.Block
+	nonce [udpHeaderSize]byte
+}
+
+// newUDPCipher 根据十六进制的key和nonce创建加解密器，ssrc写入nonce用于区分会话
+func newUDPCipher(keyHex, nonceHex string, ssrc uint32) (*udpCipher, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, fmt.Errorf("解析AES密钥失败: %v", err)
+	}
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil {
+		return nil, fmt.Errorf("解析AES nonce失败: %v", err)
+	}
+	if len(nonce) != udpHeaderSize {
+		return nil, fmt.Errorf("AES nonce长度错误: %d", len(nonce))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密器失败: %v", err)
+	}
+
+	c := &udpCipher{block: block}
+	copy(c.nonce[:], nonce)
+	// 规范化nonce：类型字段、长度清零，并写入连接标识，设备会原样回传用于路由
+	c.nonce[0] = udpPacketTypeOpus
+	c.nonce[1] = 0
+	binary.BigEndian.PutUint16(c.nonce[2:], 0)
+	binary.BigEndian.PutUint32(c.nonce[4:], ssrc)
+	return c, nil
+}
+
+// NonceHex 返回下发给设备的nonce
+func (c *udpCipher) NonceHex() string {
+	return hex.EncodeToString(c.nonce[:])
+}
+
+// Encrypt 加密音频数据，返回完整的UDP包
+func (c *udpCipher) Encrypt(payload []byte, timestamp, sequence uint32) []byte {
+	packet := make([]byte, udpHeaderSize+len(payload))
+	copy(packet, c.nonce[:])
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(payload)))
+	binary.BigEndian.PutUint32(packet[8:], timestamp)
+	binary.BigEndian.PutUint32(packet[12:], sequence)
+	cipher.NewCTR(c.block, packet[:udpHeaderSize]).XORKeyStream(packet[udpHeaderSize:], payload)
+	return packet
+}
+
+// Decrypt 解密UDP包，返回音频数据和序号
+func (c *udpCipher) Decrypt(packet []byte) ([]byte, uint32, error) {
+	if len(packet) < udpHeaderSize {
+		return nil, 0, fmt.Errorf("UDP包长度不足: %d", len(packet))
+	}
+	if packet[0] != udpPacketTypeOpus {
+		return nil, 0, fmt.Errorf("未知的UDP包类型: %d", packet[0])
+	}
+	size := int(binary.BigEndian.Uint16(packet[2:]))
+	if len(packet)-udpHeaderSize < size {
+		return nil, 0, fmt.Errorf("UDP包数据不完整: %d/%d", len(packet)-udpHeaderSize, size)
+	}
+	sequence := binary.BigEndian.Uint32(packet[12:])
+	payload := make([]byte, size)
+	cipher.NewCTR(c.block, packet[:udpHeaderSize]).XORKeyStream(payload, packet[udpHeaderSize:udpHeaderSize+size])
+	return payload, sequence, nil
+}
+
+// udpServer 所有会话共用的UDP音频服务，按包头中的ssrc分发到对应连接
+type udpServer struct {
+	conn     *net.UDPConn
+	logger   *utils.Logger
+	sessions sync.Map // ssrc -> *MqttUDPConnection
+}
+
+func newUDPServer(addr string, logger *utils.Logger) (*udpServer, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("解析UDP地址失败: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("UDP监听失败: %v", err)
+	}
+	return &udpServer{conn: conn, logger: logger}, nil
+}
+
+// register 注册会话
+func (s *udpServer) register(ssrc uint32, conn *MqttUDPConnection) bool {
+	_, loaded := s.sessions.LoadOrStore(ssrc, conn)
+	return !loaded
+}
+
+// unregister 注销会话
+func (s *udpServer) unregister(ssrc uint32, conn *MqttUDPConnection) {
+	s.sessions.CompareAndDelete(ssrc, conn)
+}
+
+// serve 接收循环，直到socket关闭
+func (s *udpServer) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !isClosedErr(err) {
+				s.logger.Error("UDP读取失败: %v", err)
+			}
+			return
+		}
+		if n < udpHeaderSize {
+			continue
+		}
+		ssrc := binary.BigEndian.Uint32(buf[4:8])
+		value, ok := s.sessions.Load(ssrc)
+		if !ok {
+			s.logger.Debug("收到未知会话的UDP包: ssrc=%d, from=%s", ssrc, addr)
+			continue
+		}
+		value.(*MqttUDPConnection).handleUDPPacket(buf[:n], addr)
+	}
+}
+
+// writeTo 发送UDP包
+func (s *udpServer) writeTo(data []byte, addr *net.UDPAddr) error {
+	_, err := s.conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (s *udpServer) close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestUDPCipherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{
+			name:    "空数据",
+			payload: []byte{},
+		},
+		{
+			name:    "短数据",
+			payload: []byte("opus"),
+		},
+		{
+			name:    "跨多个AES块",
+			payload: bytes.Repeat([]byte{0xab, 0xcd}, 100),
+		},
+	}
+
+	c, err := newUDPCipher("000102030405060708090a0b0c0d0e0f", "ffffffffffffffffffffffffffffffff", 42)
+	if err != nil {
+		t.Fatalf("newUDPCipher() error = %v", err)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := c.Encrypt(tt.payload, 1000, uint32(i+1))
+			if packet[0] != udpPacketTypeOpus {
+				t.Errorf("包类型 = %d, 期望 %d", packet[0], udpPacketTypeOpus)
+			}
+			if ssrc := binary.BigEndian.Uint32(packet[4:8]); ssrc != 42 {
+				t.Errorf("ssrc = %d, 期望 42", ssrc)
+			}
+			payload, seq, err := c.Decrypt(packet)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if seq != uint32(i+1) {
+				t.Errorf("sequence = %d, 期望 %d", seq, i+1)
+			}
+			if !bytes.Equal(payload, tt.payload) {
+				t.Errorf("解密结果不一致")
+			}
+		})
+	}
+}
+
+func TestPublishPacketRoundTrip(t *testing.T) {
+	data := encodePublish("devices/p2p/test", []byte(`{"type":"hello"}`))
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("readPacket() error = %v", err)
+	}
+	pub, err := parsePublish(p)
+	if err != nil {
+		t.Fatalf("parsePublish() error = %v", err)
+	}
+	if pub.Topic != "devices/p2p/test" || string(pub.Payload) != `{"type":"hello"}` {
+		t.Errorf("parsePublish() = %q %q", pub.Topic, pub.Payload)
+	}
+}
+
+func TestParseDeviceID(t *testing.T) {
+	tests := []struct {
+		clientID string
+		expected string
+	}{
+		{"GID_test@@@d8_3b_da_01_02_03@@@uuid", "d8:3b:da:01:02:03"},
+		{"plain-client", "plain-client"},
+	}
+	for _, tt := range tests {
+		if got := parseDeviceID(tt.clientID); got != tt.expected {
+			t.Errorf("parseDeviceID(%q) = %q, 期望 %q", tt.clientID, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/iot"
+	"xiaozhi-server-go/src/core/pool"
+	_ "xiaozhi-server-go/src/core/providers/asr/fake"
+	_ "xiaozhi-server-go/src/core/providers/llm/fake"
+	_ "xiaozhi-server-go/src/core/providers/tts/fake"
+	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/task"
+
+	"github.com/gorilla/websocket"
+)
+
+const asrFrames = 3 // fake ASR每收到几帧音频返回一次识别结果
+
+// e2eConfig 使用fake提供者的最小配置
+func e2eConfig(t *testing.T) *configs.Config {
+	config := &configs.Config{
+		DefaultPrompt: "你是小智",
+		DeleteAudio:   true,
+		SelectedModule: map[string]string{
+			"ASR": "FakeASR",
+			"LLM": "FakeLLM",
+			"TTS": "FakeTTS",
+		},
+		ASR: map[string]configs.ASRConfig{
+			"FakeASR": {
+				"type":        "fake",
+				"frames":      asrFrames,
+				"transcripts": []interface{}{"你好小智", "打开台灯"},
+			},
+		},
+		LLM: map[string]configs.LLMConfig{
+			"FakeLLM": {
+				Type: "fake",
+				Extra: map[string]interface{}{
+					"replies": []interface{}{
+						"你好，我是小智。",
+						map[string]interface{}{"tool": iot.ToolName("Lamp", "TurnOn")},
+						"台灯已打开。",
+					},
+				},
+			},
+		},
+		TTS: map[string]configs.TTSConfig{
+			"FakeTTS": {Type: "fake", OutputDir: t.TempDir()},
+		},
+	}
+	config.PoolConfig.PoolMinSize = 1
+	config.PoolConfig.PoolMaxSize = 2
+	config.McpPoolConfig.PoolMinSize = 1
+	config.McpPoolConfig.PoolMaxSize = 2
+	return config
+}
+
+// e2eClient 模拟设备的WebSocket客户端
+type e2eClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func (c *e2eClient) sendJSON(msg map[string]interface{}) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("发送消息失败: %v", err)
+	}
+}
+
+// sendAudio 发送n帧60ms的静音Opus音频
+func (c *e2eClient) sendAudio(n int) {
+	c.t.Helper()
+	encoder, err := utils.NewAudioFrameEncoder("opus", 16000, 1, 60)
+	if err != nil {
+		c.t.Fatalf("创建Opus编码器失败: %v", err)
+	}
+	defer encoder.Close()
+
+	frames, err := encoder.Encode(make([]byte, 16000*2*60/1000*n))
+	if err != nil {
+		c.t.Fatalf("编码音频失败: %v", err)
+	}
+	for _, frame := range frames {
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			c.t.Fatalf("发送音频失败: %v", err)
+		}
+	}
+}
+
+// sync 等待服务端处理完之前发送的文本消息。
+// 文本消息按顺序处理，服务端原样返回非JSON文本，收到回显说明之前的消息已处理完；
+// 音频走单独的队列，需要在listen生效后再发送。
+func (c *e2eClient) sync() {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte("sync")); err != nil {
+		c.t.Fatalf("发送消息失败: %v", err)
+	}
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("读取消息失败: %v", err)
+		}
+		if messageType == websocket.TextMessage && string(data) == "sync" {
+			return
+		}
+	}
+}
+
+// readMessage 读取下一条文本消息，跳过MCP消息，返回期间收到的音频帧数
+func (c *e2eClient) readMessage() (map[string]interface{}, int) {
+	c.t.Helper()
+	audioFrames := 0
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("读取消息失败: %v", err)
+		}
+		if messageType == websocket.BinaryMessage {
+			audioFrames++
+			continue
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.t.Fatalf("解析消息失败: %v, %s", err, data)
+		}
+		if msg["type"] == "mcp" {
+			continue
+		}
+		return msg, audioFrames
+	}
+}
+
+// readRound 读取一轮对话的消息直到tts stop，返回消息摘要和合成的回复文本。
+// 摘要格式为 type[:state][:text]，句子的音频帧数不为0时记为audio。
+func (c *e2eClient) readRound() ([]string, string) {
+	c.t.Helper()
+	var events []string
+	var reply strings.Builder
+	for {
+		msg, audioFrames := c.readMessage()
+		if audioFrames > 0 {
+			events = append(events, "audio")
+		}
+		event := fmt.Sprint(msg["type"])
+		switch msg["type"] {
+		case "stt":
+			event += ":" + fmt.Sprint(msg["text"])
+		case "llm":
+			event += ":" + fmt.Sprint(msg["emotion"])
+		case "iot":
+			commands, _ := msg["commands"].([]interface{})
+			for _, command := range commands {
+				command, _ := command.(map[string]interface{})
+				event += fmt.Sprintf(":%v.%v", command["name"], command["method"])
+			}
+		case "tts":
+			event += ":" + fmt.Sprint(msg["state"])
+			if msg["state"] == "sentence_start" {
+				reply.WriteString(fmt.Sprint(msg["text"]))
+			}
+		}
+		// 回复可能被分成多句，连续的句子合并为一个摘要
+		if n := len(events); n >= 2 && event == "tts:sentence_start" &&
+			events[n-1] == "tts:sentence_end" && events[n-2] == "audio" {
+			events = events[:n-2]
+		}
+		events = append(events, event)
+		if event == "tts:stop" {
+			return events, reply.String()
+		}
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	config := e2eConfig(t)
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	poolManager, err := pool.NewPoolManager(config, logger)
+	if err != nil {
+		t.Fatalf("NewPoolManager() error = %v", err)
+	}
+	defer poolManager.Close()
+
+	taskMgr := task.NewTaskManager(task.ResourceConfig{MaxWorkers: 2, MaxTasksPerClient: 5})
+	taskMgr.Start()
+	defer taskMgr.Stop()
+
+	wsTransport := NewWebSocketTransport(config, logger)
+	wsTransport.SetConnectionHandler(transport.NewDefaultConnectionHandlerFactory(config, poolManager, taskMgr, logger))
+	server := httptest.NewServer(http.HandlerFunc(wsTransport.handleWebSocket))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Device-Id", "e2e-device")
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("WebSocket连接失败: %v", err)
+	}
+	defer conn.Close()
+	client := &e2eClient{t: t, conn: conn}
+
+	// hello握手
+	client.sendJSON(map[string]interface{}{
+		"type":      "hello",
+		"version":   1,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    16000,
+			"channels":       1,
+			"frame_duration": 60,
+		},
+	})
+	hello, _ := client.readMessage()
+	if hello["type"] != "hello" || hello["session_id"] == "" {
+		t.Fatalf("hello响应 = %v", hello)
+	}
+	if params, _ := hello["audio_params"].(map[string]interface{}); params["format"] != "opus" {
+		t.Errorf("hello响应音频格式 = %v, want opus", hello["audio_params"])
+	}
+
+	client.sendJSON(map[string]interface{}{
+		"type": "iot",
+		"descriptors": []interface{}{map[string]interface{}{
+			"name":        "Lamp",
+			"description": "台灯",
+			"methods":     map[string]interface{}{"TurnOn": map[string]interface{}{"description": "打开台灯"}},
+		}},
+	})
+
+	rounds := []struct {
+		name       string
+		wantEvents []string
+		wantReply  string
+	}{
+		{
+			name:       "普通对话",
+			wantEvents: []string{"stt:你好小智", "tts:start", "llm:thinking", "tts:sentence_start", "audio", "tts:sentence_end", "tts:stop"},
+			wantReply:  "你好，我是小智。",
+		},
+		{
+			name:       "工具调用",
+			wantEvents: []string{"stt:打开台灯", "tts:start", "llm:thinking", "iot:Lamp.TurnOn", "tts:sentence_start", "audio", "tts:sentence_end", "tts:stop"},
+			wantReply:  "台灯已打开。",
+		},
+	}
+	for _, round := range rounds {
+		client.sendJSON(map[string]interface{}{"type": "listen", "state": "start", "mode": "auto"})
+		client.sync()
+		client.sendAudio(asrFrames)
+
+		events, reply := client.readRound()
+		if strings.Join(events, ",") != strings.Join(round.wantEvents, ",") {
+			t.Errorf("%s: 消息序列 = %v, want %v", round.name, events, round.wantEvents)
+		}
+		if reply != round.wantReply {
+			t.Errorf("%s: 回复 = %s, want %s", round.name, reply, round.wantReply)
+		}
+	}
+
+	// 会话管理接口读取的状态
+	sessions := wsTransport.GetSessions()
+	if len(sessions) != 1 {
+		t.Fatalf("GetSessions() = %d, want 1", len(sessions))
+	}
+	handler := sessions[0].(*transport.ConnectionContextAdapter).GetConnectionHandler()
+	info := handler.SessionInfo()
+	if info.DeviceID != "e2e-device" || info.Round != len(rounds) || info.ListenMode != "auto" || info.Providers["LLM"] == "" {
+		t.Errorf("SessionInfo() = %+v", info)
+	}
+	if dialogue := handler.RecentDialogue(1); len(dialogue) != 1 || dialogue[0].Content != "台灯已打开。" {
+		t.Errorf("RecentDialogue(1) = %+v", dialogue)
+	}
+
+	// 服务端关闭会话后客户端连接断开
+	sessions[0].Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Errorf("关闭会话后连接未断开")
+		}
+		break
+	}
+}
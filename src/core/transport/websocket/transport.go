@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/transport"
 	"xiaozhi-server-go/src/core/utils"
 
@@ -19,7 +21,9 @@ type WebSocketTransport struct {
 	logger            *utils.Logger
 	connHandler       transport.ConnectionHandlerFactory
 	activeConnections sync.Map
+	deviceIDs         sync.Map // clientID -> deviceID
 	upgrader          *websocket.Upgrader
+	authVerifier      atomic.Pointer[auth.HandshakeVerifier] // 为nil时不校验握手，配置重载时替换
 }
 
 // NewWebSocketTransport 创建新的WebSocket传输层
@@ -73,6 +77,7 @@ func (t *WebSocketTransport) Stop() error {
 				handler.Close()
 			}
 			t.activeConnections.Delete(key)
+			t.deviceIDs.Delete(key)
 			return true
 		})
 
@@ -81,6 +86,11 @@ func (t *WebSocketTransport) Stop() error {
 	return nil
 }
 
+// SetAuthVerifier 设置握手认证器，传入nil表示关闭握手认证
+func (t *WebSocketTransport) SetAuthVerifier(verifier *auth.HandshakeVerifier) {
+	t.authVerifier.Store(verifier)
+}
+
 // SetConnectionHandler 设置连接处理器工厂
 func (t *WebSocketTransport) SetConnectionHandler(handler transport.ConnectionHandlerFactory) {
 	t.connHandler = handler
@@ -96,6 +106,30 @@ func (t *WebSocketTransport) GetActiveConnectionCount() (int, int) {
 	return count, count
 }
 
+// GetOnlineDevices 获取已建立连接的设备ID
+func (t *WebSocketTransport) GetOnlineDevices() []string {
+	var devices []string
+	t.deviceIDs.Range(func(key, value interface{}) bool {
+		if deviceID := value.(string); deviceID != "" {
+			devices = append(devices, deviceID)
+		}
+		return true
+	})
+	return devices
+}
+
+// GetSessions 获取已建立的会话
+func (t *WebSocketTransport) GetSessions() []transport.ConnectionHandler {
+	var sessions []transport.ConnectionHandler
+	t.activeConnections.Range(func(key, value interface{}) bool {
+		if handler, ok := value.(transport.ConnectionHandler); ok {
+			sessions = append(sessions, handler)
+		}
+		return true
+	})
+	return sessions
+}
+
 // GetType 获取传输类型
 func (t *WebSocketTransport) GetType() string {
 	return "websocket"
@@ -103,12 +137,6 @@ func (t *WebSocketTransport) GetType() string {
 
 // handleWebSocket 处理WebSocket连接
 func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := t.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		t.logger.Error("WebSocket升级失败: %v", err)
-		return
-	}
-
 	deviceID := r.Header.Get("Device-Id")
 	clientID := r.Header.Get("Client-Id")
 	if deviceID == "" {
@@ -122,6 +150,30 @@ func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Requ
 		clientID = r.URL.Query().Get("client-id")
 		r.Header.Set("Client-Id", clientID)
 	}
+
+	// 升级前完成认证，失败直接返回HTTP错误
+	if verifier := t.authVerifier.Load(); verifier != nil {
+		if status, err := verifier.Verify(auth.TokenFromRequest(r), deviceID); err != nil {
+			t.logger.Warn("WebSocket握手认证失败: device=%s, client=%s, remote=%s, status=%d, reason=%v",
+				deviceID, clientID, r.RemoteAddr, status, err)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			reason := err.Error()
+			if status >= http.StatusInternalServerError {
+				reason = http.StatusText(status) // 不向设备暴露数据库错误
+			}
+			http.Error(w, reason, status)
+			return
+		}
+	}
+
+	conn, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		t.logger.Error("WebSocket升级失败: %v", err)
+		return
+	}
+
 	if clientID == "" {
 		clientID = fmt.Sprintf("%p", conn)
 	}
@@ -142,6 +194,7 @@ func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Requ
 	}
 
 	t.activeConnections.Store(clientID, handler)
+	t.deviceIDs.Store(clientID, deviceID)
 	t.logger.Info("WebSocket客户端 %s 连接已建立，资源已分配", clientID)
 
 	// 启动连接处理，并在结束时清理资源
@@ -149,6 +202,7 @@ func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Requ
 		defer func() {
 			// 连接结束时清理
 			t.activeConnections.Delete(clientID)
+			t.deviceIDs.Delete(clientID)
 			handler.Close()
 		}()
 
@@ -94,6 +94,30 @@ type FunctionCall struct {
 	Arguments string `json:"arguments"`
 }
 
+// MergeToolCall 合并流式响应中的工具调用增量。
+// 同一个调用的增量index相同，后续增量没有ID；index相同但ID不同时视为新的调用，
+// 兼容不返回index的接口。
+func MergeToolCall(calls []ToolCall, delta ToolCall) []ToolCall {
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := &calls[i]
+		if call.Index != delta.Index || (delta.ID != "" && call.ID != "" && delta.ID != call.ID) {
+			continue
+		}
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+		return calls
+	}
+	return append(calls, delta)
+}
+
 // Response LLM响应结构
 type Response struct {
 	Content    string     `json:"content,omitempty"`
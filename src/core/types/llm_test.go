@@ -0,0 +1,50 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeToolCall(t *testing.T) {
+	call := func(index int, id, name, arguments string) ToolCall {
+		return ToolCall{ID: id, Index: index, Function: FunctionCall{Name: name, Arguments: arguments}}
+	}
+	tests := []struct {
+		name   string
+		deltas []ToolCall
+		want   []ToolCall
+	}{
+		{
+			name:   "单个调用的参数增量",
+			deltas: []ToolCall{call(0, "a", "get_time", ""), call(0, "", "", `{"tz":`), call(0, "", "", `"cn"}`)},
+			want:   []ToolCall{call(0, "a", "get_time", `{"tz":"cn"}`)},
+		},
+		{
+			name: "按index区分并行调用",
+			deltas: []ToolCall{
+				call(0, "a", "get_time", ""), call(1, "b", "get_weather", ""),
+				call(1, "", "", `{"city":"北京"}`), call(0, "", "", `{}`),
+			},
+			want: []ToolCall{call(0, "a", "get_time", `{}`), call(1, "b", "get_weather", `{"city":"北京"}`)},
+		},
+		{
+			name: "没有index时按ID区分",
+			deltas: []ToolCall{
+				call(0, "a", "get_time", ""), call(0, "", "", `{}`),
+				call(0, "b", "get_weather", ""), call(0, "", "", `{"city":"北京"}`),
+			},
+			want: []ToolCall{call(0, "a", "get_time", `{}`), call(0, "b", "get_weather", `{"city":"北京"}`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ToolCall
+			for _, delta := range tt.deltas {
+				got = MergeToolCall(got, delta)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeToolCall() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -219,8 +220,17 @@ func SaveAudioToWavFile(data []byte, fileName string, sampleRate int, channels i
 	return nil
 }
 
+// PCMToWavData 为PCM数据加上WAV文件头
+func PCMToWavData(pcmData []byte, sampleRate int, channels int, bitsPerSample int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcmData))
+	writeWavHeader(&buf, len(pcmData), sampleRate, channels, bitsPerSample)
+	buf.Write(pcmData)
+	return buf.Bytes()
+}
+
 // 写入WAV文件头
-func writeWavHeader(file *os.File, dataSize int, sampleRate, channels, bitsPerSample int) error {
+func writeWavHeader(file io.Writer, dataSize int, sampleRate, channels, bitsPerSample int) error {
 	// RIFF块
 	header := make([]byte, 44)
 	copy(header[0:4], []byte("RIFF"))
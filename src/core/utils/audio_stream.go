@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+
+	opus "github.com/qrtc/opus-go"
+)
+
+// AudioFrameEncoder 将流式到达的16位PCM数据切分为固定时长的音频帧，
+// format为opus时逐帧编码为Opus数据包，为pcm时直接返回PCM帧
+type AudioFrameEncoder struct {
+	format        string
+	bytesPerFrame int
+	buffer        []byte
+	encoder       *opus.OpusEncoder
+}
+
+// NewAudioFrameEncoder 创建流式音频帧编码器
+func NewAudioFrameEncoder(format string, sampleRate, channels, frameDuration int) (*AudioFrameEncoder, error) {
+	if frameDuration <= 0 {
+		frameDuration = 60
+	}
+	e := &AudioFrameEncoder{
+		format:        format,
+		bytesPerFrame: sampleRate * frameDuration / 1000 * channels * 2,
+	}
+	if e.bytesPerFrame <= 0 {
+		return nil, fmt.Errorf("无效的音频参数: 采样率=%d, 声道数=%d", sampleRate, channels)
+	}
+
+	switch format {
+	case "pcm":
+	case "opus":
+		supportedRates := map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
+		if !supportedRates[sampleRate] {
+			return nil, fmt.Errorf("采样率 %dHz 不被Opus支持，仅支持8000/12000/16000/24000/48000Hz", sampleRate)
+		}
+		encoder, err := opus.CreateOpusEncoder(&opus.OpusEncoderConfig{
+			SampleRate:    sampleRate,
+			MaxChannels:   channels,
+			Application:   opus.AppVoIP,
+			FrameDuration: opusFrameSize(frameDuration),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+		}
+		e.encoder = encoder
+	default:
+		return nil, fmt.Errorf("不支持的音频格式: %s", format)
+	}
+	return e, nil
+}
+
+// Encode 追加PCM数据，返回已凑满的完整音频帧，不足一帧的数据留待下次处理
+func (e *AudioFrameEncoder) Encode(pcm []byte) ([][]byte, error) {
+	e.buffer = append(e.buffer, pcm...)
+
+	var frames [][]byte
+	for len(e.buffer) >= e.bytesPerFrame {
+		frame, err := e.encodeFrame(e.buffer[:e.bytesPerFrame])
+		if err != nil {
+			return frames, err
+		}
+		e.buffer = e.buffer[e.bytesPerFrame:]
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
+
+// Flush 将剩余数据补齐静音后编码为最后一帧，没有剩余数据时返回nil
+func (e *AudioFrameEncoder) Flush() ([]byte, error) {
+	if len(e.buffer) == 0 {
+		return nil, nil
+	}
+	framePcm := make([]byte, e.bytesPerFrame)
+	copy(framePcm, e.buffer)
+	e.buffer = nil
+	return e.encodeFrame(framePcm)
+}
+
+// Close 释放编码器
+func (e *AudioFrameEncoder) Close() error {
+	if e.encoder != nil {
+		return e.encoder.Close()
+	}
+	return nil
+}
+
+func (e *AudioFrameEncoder) encodeFrame(framePcm []byte) ([]byte, error) {
+	if e.encoder == nil {
+		frame := make([]byte, len(framePcm))
+		copy(frame, framePcm)
+		return frame, nil
+	}
+
+	outBuf := make([]byte, len(framePcm))
+	n, err := e.encoder.Encode(framePcm, outBuf)
+	if err != nil {
+		return nil, fmt.Errorf("Opus编码失败: %v", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return outBuf[:n], nil
+}
+
+// opusFrameSize 帧时长(毫秒)对应的Opus帧长参数
+func opusFrameSize(frameDuration int) opus.FrameSizeType {
+	switch frameDuration {
+	case 10:
+		return opus.Framesize10Ms
+	case 20:
+		return opus.Framesize20Ms
+	case 40:
+		return opus.Framesize40Ms
+	default:
+		return opus.Framesize60Ms
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import "testing"
+
+func TestAudioFrameEncoderPCM(t *testing.T) {
+	// 16kHz单声道20ms一帧，每帧640字节
+	tests := []struct {
+		name       string
+		chunks     []int
+		wantFrames int
+		wantFlush  bool
+	}{
+		{name: "不足一帧", chunks: []int{100}, wantFrames: 0, wantFlush: true},
+		{name: "恰好两帧", chunks: []int{640, 640}, wantFrames: 2, wantFlush: false},
+		{name: "跨片段拼帧", chunks: []int{300, 300, 300}, wantFrames: 1, wantFlush: true},
+		{name: "单片段多帧", chunks: []int{2000}, wantFrames: 3, wantFlush: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewAudioFrameEncoder("pcm", 16000, 1, 20)
+			if err != nil {
+				t.Fatalf("NewAudioFrameEncoder() error = %v", err)
+			}
+			defer encoder.Close()
+
+			frames := 0
+			for _, size := range tt.chunks {
+				got, err := encoder.Encode(make([]byte, size))
+				if err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+				for _, frame := range got {
+					if len(frame) != 640 {
+						t.Errorf("帧长度 = %d, want 640", len(frame))
+					}
+				}
+				frames += len(got)
+			}
+			if frames != tt.wantFrames {
+				t.Errorf("帧数 = %d, want %d", frames, tt.wantFrames)
+			}
+
+			last, err := encoder.Flush()
+			if err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+			if (last != nil) != tt.wantFlush {
+				t.Errorf("Flush() = %d bytes, want flush %v", len(last), tt.wantFlush)
+			}
+			if last != nil && len(last) != 640 {
+				t.Errorf("Flush() 帧长度 = %d, want 640", len(last))
+			}
+		})
+	}
+
+	if _, err := NewAudioFrameEncoder("mp3", 16000, 1, 20); err == nil {
+		t.Errorf("NewAudioFrameEncoder(mp3) 应返回错误")
+	}
+}
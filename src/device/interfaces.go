@@ -0,0 +1,13 @@
+package device
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceService 定义设备管理服务接口
+type DeviceService interface {
+	// 将设备管理的路由注册到 engine 与 apiGroup
+	Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error
+}
@@ -0,0 +1,217 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceResponse 设备接口统一响应
+type DeviceResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// DeviceInfo 设备信息及在线状态
+type DeviceInfo struct {
+	models.Device
+	Online bool `json:"online"`
+}
+
+// UpdateRequest 更新设备的请求，省略的字段不修改
+type UpdateRequest struct {
+	Alias   *string `json:"alias"`
+	Channel *string `json:"channel"` // OTA渠道stable/beta，为空表示stable
+	UserID  *uint   `json:"user_id"` // 0表示解除绑定
+}
+
+// ActivateRequest 使用激活码将设备绑定到用户的请求
+type ActivateRequest struct {
+	Code   string `json:"code"`
+	UserID uint   `json:"user_id"`
+}
+
+// OnlineFunc 返回当前在线的设备ID
+type OnlineFunc func() map[string]bool
+
+type DefaultDeviceService struct {
+	logger *utils.Logger
+	db     *database.DeviceDB
+	online OnlineFunc
+}
+
+// NewDefaultDeviceService 构造函数，online为nil时所有设备显示为离线
+func NewDefaultDeviceService(logger *utils.Logger, db *database.DeviceDB, online OnlineFunc) (*DefaultDeviceService, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	if online == nil {
+		online = func() map[string]bool { return nil }
+	}
+	return &DefaultDeviceService{
+		logger: logger,
+		db:     db,
+		online: online,
+	}, nil
+}
+
+// Start 注册设备管理路由
+func (s *DefaultDeviceService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/devices", auth.AdminAuthMiddleware())
+
+	group.GET("", s.handleList)
+	group.POST("/activate", s.handleActivate)
+	group.GET("/:device_id", s.handleGet)
+	group.PUT("/:device_id", s.handleUpdate)
+	group.DELETE("/:device_id", s.handleDelete)
+
+	s.logger.Info("设备管理HTTP服务路由注册完成")
+	return nil
+}
+
+// handleList 列出所有设备
+// @Summary 获取设备列表
+// @Description 列出OTA请求或建立过会话的设备及其在线状态，最近在线的在前
+// @Tags Device
+// @Produce json
+// @Success 200 {object} DeviceResponse
+// @Router /devices [get]
+func (s *DefaultDeviceService) handleList(c *gin.Context) {
+	devices, err := s.db.ListDevices()
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	online := s.online()
+	infos := make([]DeviceInfo, 0, len(devices))
+	for _, device := range devices {
+		infos = append(infos, DeviceInfo{Device: device, Online: online[device.DeviceID]})
+	}
+	c.JSON(http.StatusOK, DeviceResponse{Success: true, Data: infos})
+}
+
+// handleActivate 使用设备播报的激活码将设备绑定到用户
+// @Summary 激活设备
+// @Description 设备OTA请求时获得6位激活码并播报，管理员用激活码将设备绑定到用户后设备即可连接
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param body body ActivateRequest true "激活码和用户ID"
+// @Success 200 {object} DeviceResponse
+// @Failure 400 {object} DeviceResponse
+// @Failure 404 {object} DeviceResponse
+// @Router /devices/activate [post]
+func (s *DefaultDeviceService) handleActivate(c *gin.Context) {
+	var req ActivateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.respondError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	code := strings.TrimSpace(req.Code)
+	if code == "" || req.UserID == 0 {
+		s.respondError(c, http.StatusBadRequest, "激活码和用户ID不能为空")
+		return
+	}
+	deviceID, err := s.db.Activate(code, req.UserID)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if deviceID == "" {
+		s.respondError(c, http.StatusNotFound, "激活码无效")
+		return
+	}
+	s.logger.Info("设备 %s 已激活并绑定到用户 %d, client=%s", deviceID, req.UserID, c.ClientIP())
+	c.JSON(http.StatusOK, DeviceResponse{Success: true, Data: gin.H{"device_id": deviceID}, Message: "设备已激活"})
+}
+
+// handleGet 获取设备
+// @Summary 获取设备
+// @Tags Device
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} DeviceResponse
+// @Failure 404 {object} DeviceResponse
+// @Router /devices/{device_id} [get]
+func (s *DefaultDeviceService) handleGet(c *gin.Context) {
+	device, err := s.db.GetDevice(c.Param("device_id"))
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if device == nil {
+		s.respondError(c, http.StatusNotFound, "设备不存在")
+		return
+	}
+	info := DeviceInfo{Device: *device, Online: s.online()[device.DeviceID]}
+	c.JSON(http.StatusOK, DeviceResponse{Success: true, Data: info})
+}
+
+// handleUpdate 更新设备备注名、OTA渠道或绑定的用户
+// @Summary 更新设备
+// @Description 省略的字段不修改，user_id为0表示解除绑定，绑定的用户在设备下次连接时生效，OTA渠道在下次OTA请求时生效
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Param body body UpdateRequest true "设备信息"
+// @Success 200 {object} DeviceResponse
+// @Failure 400 {object} DeviceResponse
+// @Failure 404 {object} DeviceResponse
+// @Router /devices/{device_id} [put]
+func (s *DefaultDeviceService) handleUpdate(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	var req UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.respondError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	found, err := s.db.UpdateDevice(deviceID, req.Alias, req.Channel, req.UserID)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "设备不存在")
+		return
+	}
+	s.logger.Info("已更新设备 %s, client=%s", deviceID, c.ClientIP())
+	c.JSON(http.StatusOK, DeviceResponse{Success: true, Message: "设备已更新"})
+}
+
+// handleDelete 删除设备记录
+// @Summary 删除设备
+// @Description 删除设备记录及用户绑定，设备再次OTA请求或连接时重新登记
+// @Tags Device
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} DeviceResponse
+// @Failure 404 {object} DeviceResponse
+// @Router /devices/{device_id} [delete]
+func (s *DefaultDeviceService) handleDelete(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	found, err := s.db.DeleteDevice(deviceID)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "设备不存在")
+		return
+	}
+	s.logger.Info("已删除设备 %s, client=%s", deviceID, c.ClientIP())
+	c.JSON(http.StatusOK, DeviceResponse{Success: true, Message: "设备已删除"})
+}
+
+func (s *DefaultDeviceService) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, DeviceResponse{Success: false, Message: message})
+}
@@ -0,0 +1,13 @@
+package history
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HistoryService 定义对话历史服务接口
+type HistoryService interface {
+	// 将对话历史的路由注册到 engine 与 apiGroup
+	Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error
+}
@@ -0,0 +1,204 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 过期对话历史的清理间隔
+const purgeInterval = time.Hour
+
+// HistoryResponse 对话历史接口统一响应
+type HistoryResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// DialogueDetail 设备对话历史详情
+type DialogueDetail struct {
+	DeviceID  string         `json:"device_id"`
+	Messages  []chat.Message `json:"messages"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type DefaultHistoryService struct {
+	logger *utils.Logger
+	db     *database.DialogueDB
+}
+
+// NewDefaultHistoryService 构造函数
+func NewDefaultHistoryService(logger *utils.Logger, db *database.DialogueDB) (*DefaultHistoryService, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	return &DefaultHistoryService{
+		logger: logger,
+		db:     db,
+	}, nil
+}
+
+// Start 注册对话历史路由，并定期清理过期的对话历史
+func (s *DefaultHistoryService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/history", auth.AdminAuthMiddleware())
+
+	group.GET("", s.handleList)
+	group.GET("/:device_id", s.handleGet)
+	group.GET("/:device_id/export", s.handleExport)
+	group.DELETE("/:device_id", s.handleDelete)
+
+	go s.purgeLoop(ctx)
+
+	s.logger.Info("对话历史HTTP服务路由注册完成")
+	return nil
+}
+
+// handleList 列出保留时长内的设备对话历史
+// @Summary 获取对话历史列表
+// @Description 列出保留时长内有对话历史的设备，不包含对话内容
+// @Tags History
+// @Produce json
+// @Success 200 {object} HistoryResponse
+// @Router /history [get]
+func (s *DefaultHistoryService) handleList(c *gin.Context) {
+	records, err := s.db.ListDialogues(s.since())
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, HistoryResponse{Success: true, Data: records})
+}
+
+// handleGet 获取设备的对话历史
+// @Summary 获取设备对话历史
+// @Description 返回设备保留时长内的对话消息，不包含系统提示词
+// @Tags History
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} HistoryResponse
+// @Failure 404 {object} HistoryResponse
+// @Router /history/{device_id} [get]
+func (s *DefaultHistoryService) handleGet(c *gin.Context) {
+	detail, ok := s.loadDetail(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, HistoryResponse{Success: true, Data: detail})
+}
+
+// handleExport 以JSON文件导出设备的对话历史
+// @Summary 导出设备对话历史
+// @Description 以附件形式下载设备的对话历史JSON文件
+// @Tags History
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} DialogueDetail
+// @Failure 404 {object} HistoryResponse
+// @Router /history/{device_id}/export [get]
+func (s *DefaultHistoryService) handleExport(c *gin.Context) {
+	detail, ok := s.loadDetail(c)
+	if !ok {
+		return
+	}
+	data, err := json.MarshalIndent(detail, "", "  ")
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	filename := "dialogue_" + strings.NewReplacer(":", "_", "/", "_").Replace(detail.DeviceID) + ".json"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// handleDelete 删除设备的对话历史
+// @Summary 删除设备对话历史
+// @Tags History
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} HistoryResponse
+// @Failure 404 {object} HistoryResponse
+// @Router /history/{device_id} [delete]
+func (s *DefaultHistoryService) handleDelete(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	found, err := s.db.DeleteDialogue(deviceID)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "对话历史不存在")
+		return
+	}
+	s.logger.Info("已删除设备 %s 的对话历史, client=%s", deviceID, c.ClientIP())
+	c.JSON(http.StatusOK, HistoryResponse{Success: true, Message: "对话历史已删除"})
+}
+
+// loadDetail 加载设备的对话历史，失败时已写入响应
+func (s *DefaultHistoryService) loadDetail(c *gin.Context) (*DialogueDetail, bool) {
+	deviceID := c.Param("device_id")
+	record, err := s.db.LoadDialogue(deviceID, s.since())
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if record == nil {
+		s.respondError(c, http.StatusNotFound, "对话历史不存在")
+		return nil, false
+	}
+
+	dm := chat.NewDialogueManager(s.logger, nil)
+	if err := dm.LoadFromJSON(record.Content); err != nil {
+		s.respondError(c, http.StatusInternalServerError, fmt.Sprintf("解析对话历史失败: %v", err))
+		return nil, false
+	}
+	return &DialogueDetail{
+		DeviceID:  record.DeviceID,
+		Messages:  dm.GetLLMDialogue(),
+		UpdatedAt: record.UpdatedAt,
+	}, true
+}
+
+// purgeLoop 定期清理超过保留时长的对话历史
+func (s *DefaultHistoryService) purgeLoop(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.db.PurgeDialogues(s.since())
+			if err != nil {
+				s.logger.Error("清理过期对话历史失败: %v", err)
+			} else if count > 0 {
+				s.logger.Info("已清理 %d 条过期对话历史", count)
+			}
+		}
+	}
+}
+
+// since 保留时长的起始时间，始终以当前生效的配置为准
+func (s *DefaultHistoryService) since() time.Time {
+	retention := 72 * time.Hour
+	if config := configs.Current(); config != nil {
+		retention = config.DialogueRetention()
+	}
+	return time.Now().Add(-retention)
+}
+
+func (s *DefaultHistoryService) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, HistoryResponse{Success: false, Message: message})
+}
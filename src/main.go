@@ -7,10 +7,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"strconv"
 	"syscall"
 	"time"
@@ -20,13 +22,19 @@ import (
 	cfg "xiaozhi-server-go/src/configs/server"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/auth/store"
+	"xiaozhi-server-go/src/core/metrics"
 	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/transport/mqtt"
 	"xiaozhi-server-go/src/core/transport/websocket"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/device"
 	_ "xiaozhi-server-go/src/docs"
+	"xiaozhi-server-go/src/history"
 	"xiaozhi-server-go/src/ota"
+	"xiaozhi-server-go/src/session"
 	"xiaozhi-server-go/src/task"
+	"xiaozhi-server-go/src/user"
 	"xiaozhi-server-go/src/vision"
 
 	"github.com/gin-contrib/cors"
@@ -36,15 +44,24 @@ import (
 	// 导入所有providers以确保init函数被调用
 	_ "xiaozhi-server-go/src/core/providers/asr/deepgram"
 	_ "xiaozhi-server-go/src/core/providers/asr/doubao"
+	_ "xiaozhi-server-go/src/core/providers/asr/fake"
 	_ "xiaozhi-server-go/src/core/providers/asr/gosherpa"
+	_ "xiaozhi-server-go/src/core/providers/asr/openai"
 	_ "xiaozhi-server-go/src/core/providers/asr/stepfun"
+	_ "xiaozhi-server-go/src/core/providers/llm/anthropic"
 	_ "xiaozhi-server-go/src/core/providers/llm/coze"
+	_ "xiaozhi-server-go/src/core/providers/llm/dify"
+	_ "xiaozhi-server-go/src/core/providers/llm/fake"
+	_ "xiaozhi-server-go/src/core/providers/llm/gemini"
 	_ "xiaozhi-server-go/src/core/providers/llm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/llm/openai"
+	_ "xiaozhi-server-go/src/core/providers/memory/sqlite"
 	_ "xiaozhi-server-go/src/core/providers/tts/deepgram"
 	_ "xiaozhi-server-go/src/core/providers/tts/doubao"
 	_ "xiaozhi-server-go/src/core/providers/tts/edge"
+	_ "xiaozhi-server-go/src/core/providers/tts/fake"
 	_ "xiaozhi-server-go/src/core/providers/tts/gosherpa"
+	_ "xiaozhi-server-go/src/core/providers/tts/openai"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/openai"
 
@@ -136,20 +153,67 @@ func StartTransportServer(
 	enabledTransports := make([]string, 0)
 
 	// 检查WebSocket传输层配置
+	var wsTransport *websocket.WebSocketTransport
 	if config.Transport.WebSocket.Enabled {
-		wsTransport := websocket.NewWebSocketTransport(config, logger)
+		wsTransport = websocket.NewWebSocketTransport(config, logger)
 		wsTransport.SetConnectionHandler(handlerFactory)
+		if config.Server.Auth.Enabled {
+			wsTransport.SetAuthVerifier(auth.NewHandshakeVerifier(config))
+			logger.Info("WebSocket握手认证已启用")
+		}
 		transportManager.RegisterTransport("websocket", wsTransport)
 		enabledTransports = append(enabledTransports, "WebSocket")
 		logger.Debug("WebSocket传输层已注册")
 	}
 
+	// 检查MQTT+UDP传输层配置
+	var mqttTransport *mqtt.MqttUDPTransport
+	if config.Transport.MqttUDP.Enabled {
+		mqttTransport = mqtt.NewMqttUDPTransport(config, logger, authManager)
+		mqttTransport.SetConnectionHandler(handlerFactory)
+		if config.Server.Auth.Enabled {
+			mqttTransport.SetAuthVerifier(auth.NewHandshakeVerifier(config))
+			logger.Info("MQTT连接认证已启用")
+		}
+		transportManager.RegisterTransport("mqtt_udp", mqttTransport)
+		enabledTransports = append(enabledTransports, "MQTT+UDP")
+		logger.Debug("MQTT+UDP传输层已注册")
+	}
+
 	if len(enabledTransports) == 0 {
 		return nil, fmt.Errorf("没有启用任何传输层")
 	}
 
 	logger.Info("启用的传输层: %v", enabledTransports)
 
+	// 注册指标回调，抓取时读取连接、资源池和任务队列状态
+	metrics.RegisterConnectionStats(transportManager.GetConnectionStats)
+	metrics.RegisterPoolStats(poolManager.GetDetailedStats)
+	metrics.RegisterCircuitStates(poolManager.GetCircuitStates)
+	metrics.RegisterTaskQueueStats(taskMgr.GetQueueStats)
+
+	// 配置重载：按需重建资源池，新会话使用新的提示词、角色和快速回复，已建立的会话不受影响
+	configs.OnReload(func(newCfg, oldCfg *configs.Config) {
+		if err := poolManager.Reload(newCfg, oldCfg); err != nil {
+			logger.Error("配置重载时重建资源池失败: %v", err)
+		}
+		handlerFactory.SetConfig(newCfg)
+		var verifier *auth.HandshakeVerifier
+		if newCfg.Server.Auth.Enabled {
+			verifier = auth.NewHandshakeVerifier(newCfg)
+		}
+		if wsTransport != nil {
+			wsTransport.SetAuthVerifier(verifier)
+		}
+		if mqttTransport != nil {
+			mqttTransport.SetAuthVerifier(verifier)
+		}
+		if !reflect.DeepEqual(newCfg.Transport, oldCfg.Transport) ||
+			newCfg.Web.Port != oldCfg.Web.Port || newCfg.Log != oldCfg.Log {
+			logger.Warn("传输层、web端口和日志配置的修改需要重启服务后生效")
+		}
+	})
+
 	// 启动传输层服务
 	g.Go(func() error {
 		// 监听关闭信号
@@ -178,7 +242,7 @@ func StartTransportServer(
 	return transportManager, nil
 }
 
-func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.Group, groupCtx context.Context) (*http.Server, error) {
+func StartHttpServer(config *configs.Config, logger *utils.Logger, transportManager *transport.TransportManager, g *errgroup.Group, groupCtx context.Context) (*http.Server, error) {
 	// 初始化Gin引擎
 	if config.Log.LogLevel == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -233,7 +297,7 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 		}
 	}
 
-	cfgServer, err := cfg.NewDefaultCfgService(config, logger)
+	cfgServer, err := cfg.NewDefaultCfgService(config, logger, database.GetServerConfigDB())
 	if err != nil {
 		logger.Error("配置服务初始化失败 %v", err)
 		return nil, err
@@ -243,6 +307,42 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 		return nil, err
 	}
 
+	// 启动对话历史服务
+	historyService, err := history.NewDefaultHistoryService(logger, database.GetDialogueDB())
+	if err != nil {
+		logger.Warn("对话历史服务初始化失败 %v", err)
+	} else if err := historyService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("对话历史服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动用户管理服务
+	userService, err := user.NewDefaultUserService(logger, database.GetUserDB())
+	if err != nil {
+		logger.Warn("用户管理服务初始化失败 %v", err)
+	} else if err := userService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("用户管理服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动设备管理服务
+	deviceService, err := device.NewDefaultDeviceService(logger, database.GetDeviceDB(), transportManager.GetOnlineDevices)
+	if err != nil {
+		logger.Warn("设备管理服务初始化失败 %v", err)
+	} else if err := deviceService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("设备管理服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动会话管理服务
+	sessionService, err := session.NewDefaultSessionService(logger, transportManager)
+	if err != nil {
+		logger.Warn("会话管理服务初始化失败 %v", err)
+	} else if err := sessionService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("会话管理服务启动失败 %v", err)
+		return nil, err
+	}
+
 	// HTTP Server（支持优雅关机）
 	httpServer := &http.Server{
 		Addr:    ":" + strconv.Itoa(config.Web.Port),
@@ -252,6 +352,9 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	// 注册Swagger文档路由
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// 注册Prometheus指标路由
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	g.Go(func() error {
 		logger.Info(fmt.Sprintf("Gin 服务已启动，访问地址: http://0.0.0.0:%d", config.Web.Port))
 
@@ -282,6 +385,40 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	return httpServer, nil
 }
 
+// StartConfigReloader 监听SIGHUP信号和配置文件变化，重新加载配置
+func StartConfigReloader(logger *utils.Logger, groupCtx context.Context) {
+	reload := func(reason string) {
+		config, path, err := configs.ReloadConfig(database.GetServerConfigDB())
+		if errors.Is(err, configs.ErrConfigConflict) {
+			logger.Warn("未重新加载配置(%s): %v", reason, err)
+			return
+		}
+		if err != nil {
+			logger.Error("重新加载配置失败(%s): %v", reason, err)
+			return
+		}
+		logger.Info("配置已重新加载(%s), 配置文件路径: %s, 已选模块: %v", reason, path, config.SelectedModule)
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hupChan)
+		for {
+			select {
+			case <-groupCtx.Done():
+				return
+			case <-hupChan:
+				reload("SIGHUP")
+			}
+		}
+	}()
+
+	go configs.WatchConfigFile(groupCtx, 2*time.Second, func(path string) {
+		reload("文件变化 " + path)
+	})
+}
+
 func GracefulShutdown(cancel context.CancelFunc, logger *utils.Logger, g *errgroup.Group) {
 	// 监听系统信号
 	sigChan := make(chan os.Signal, 1)
@@ -322,15 +459,19 @@ func startServices(
 	groupCtx context.Context,
 ) error {
 	// 启动传输层服务
-	if _, err := StartTransportServer(config, logger, authManager, g, groupCtx); err != nil {
+	transportManager, err := StartTransportServer(config, logger, authManager, g, groupCtx)
+	if err != nil {
 		return fmt.Errorf("启动传输层服务失败: %w", err)
 	}
 
 	// 启动 Http 服务
-	if _, err := StartHttpServer(config, logger, g, groupCtx); err != nil {
+	if _, err := StartHttpServer(config, logger, transportManager, g, groupCtx); err != nil {
 		return fmt.Errorf("启动 Http 服务失败: %w", err)
 	}
 
+	// 启动配置热重载
+	StartConfigReloader(logger, groupCtx)
+
 	return nil
 }
 
@@ -2,6 +2,8 @@ package models
 
 import (
 	//"gorm.io/gorm"
+	"time"
+
 	"gorm.io/datatypes"
 )
 
@@ -20,23 +22,62 @@ type SystemConfig struct {
 
 // 用户
 type User struct {
-	ID       uint   `gorm:"primaryKey"`
-	Username string `gorm:"uniqueIndex;not null"`
-	Password string // 建议加密
-	Role     string // 可选值：admin/user
-	Setting  UserSetting
+	ID       uint        `gorm:"primaryKey"           json:"id"`
+	Username string      `gorm:"uniqueIndex;not null" json:"username"`
+	Password string      `                            json:"-"`    // bcrypt哈希
+	Role     string      `                            json:"role"` // 可选值：admin/user
+	Setting  UserSetting `                            json:"setting"`
+	Devices  []Device    `                            json:"devices"`
 }
 
-// 用户设置
+// 用户设置，设备连接时覆盖全局配置，为空的字段使用全局配置
 type UserSetting struct {
-	ID              uint `gorm:"primaryKey"`
-	UserID          uint `gorm:"uniqueIndex"` // 一对一
-	SelectedASR     string
-	SelectedTTS     string
-	SelectedLLM     string
-	SelectedVLLLM   string
-	PromptOverride  string `gorm:"type:text"`
-	QuickReplyWords datatypes.JSON
+	ID              uint           `gorm:"primaryKey"  json:"-"`
+	UserID          uint           `gorm:"uniqueIndex" json:"user_id"` // 一对一
+	SelectedASR     string         `                   json:"selected_asr"`
+	SelectedTTS     string         `                   json:"selected_tts"`
+	SelectedLLM     string         `                   json:"selected_llm"`
+	SelectedVLLLM   string         `                   json:"selected_vlllm"`
+	PromptOverride  string         `gorm:"type:text"   json:"prompt_override"`
+	QuickReplyWords datatypes.JSON `                   json:"quick_reply_words"`
+}
+
+// 设备，OTA请求或建立语音会话时自动登记，绑定用户后视为已激活
+type Device struct {
+	ID                  uint       `gorm:"primaryKey"           json:"id"`
+	DeviceID            string     `gorm:"uniqueIndex;not null" json:"device_id"` // 通常为MAC地址
+	ClientID            string     `                            json:"client_id"`
+	Alias               string     `                            json:"alias"` // 备注名
+	Board               string     `                            json:"board"` // 开发板类型
+	FirmwareVersion     string     `                            json:"firmware_version"`
+	Channel             string     `                            json:"channel"` // OTA渠道stable/beta，为空表示stable
+	LastIP              string     `                            json:"last_ip"`
+	LastSeen            time.Time  `gorm:"index"                json:"last_seen"`
+	UserID              *uint      `gorm:"index"                json:"user_id"`                         // 绑定的用户，未绑定时为空
+	ActivationCode      string     `gorm:"index"                json:"activation_code,omitempty"`       // 未激活设备的激活码
+	ActivationExpiresAt *time.Time `                            json:"activation_expires_at,omitempty"` // 激活码过期时间，过期后重新生成
+	CreatedAt           time.Time  `                            json:"created_at"`
+	UpdatedAt           time.Time  `                            json:"updated_at"`
+}
+
+// OTA渠道，beta渠道的设备同时接收stable固件
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// OTA固件，按开发板类型、渠道和灰度比例下发
+type Firmware struct {
+	ID          uint      `gorm:"primaryKey"                                      json:"id"`
+	Board       string    `gorm:"uniqueIndex:idx_firmware_board_version"          json:"board"` // 开发板类型，为空表示适用于所有开发板
+	Version     string    `gorm:"uniqueIndex:idx_firmware_board_version;not null" json:"version"`
+	Channel     string    `gorm:"index"                                           json:"channel"` // stable/beta
+	Rollout     int       `                                                       json:"rollout"` // 灰度比例0-100，按设备ID分桶
+	Filename    string    `gorm:"not null"                                        json:"filename"`
+	Size        int64     `                                                       json:"size"`
+	SHA256      string    `                                                       json:"sha256"`
+	Description string    `                                                       json:"description"`
+	CreatedAt   time.Time `                                                       json:"created_at"`
 }
 
 // 模块配置（可选）
@@ -50,7 +91,29 @@ type ModuleConfig struct {
 	Enabled     bool
 }
 
+// 设备长期记忆，会话结束时由LLM总结对话生成
+type Memory struct {
+	ID        uint      `gorm:"primaryKey"     json:"id"`
+	DeviceID  string    `gorm:"index;not null" json:"device_id"`
+	Content   string    `gorm:"type:text"      json:"content"`
+	CreatedAt time.Time `gorm:"index"          json:"created_at"`
+}
+
+// 设备对话历史，每个设备保存最近一次会话的对话
+type Dialogue struct {
+	ID           uint      `gorm:"primaryKey"           json:"id"`
+	DeviceID     string    `gorm:"uniqueIndex;not null" json:"device_id"`
+	Content      string    `gorm:"type:text"            json:"-"` // DialogueManager.ToJSON的结果
+	Summary      string    `gorm:"type:text"            json:"-"` // 超出上下文预算被丢弃的对话的摘要
+	MessageCount int       `                            json:"message_count"`
+	CreatedAt    time.Time `                            json:"created_at"`
+	UpdatedAt    time.Time `gorm:"index"                json:"updated_at"`
+}
+
+// 服务器配置，初始化后以数据库为准，配置文件修改后仅在未通过/api/cfg修改过时重新导入
 type ServerConfig struct {
-	ID     uint   `gorm:"primaryKey"`
-	CfgStr string `gorm:"type:text"`
+	ID       uint   `gorm:"primaryKey"`
+	CfgStr   string `gorm:"type:text"`
+	FileHash string // 最近一次导入的配置文件内容的SHA-256
+	Edited   bool   // 导入后是否通过/api/cfg修改过
 }
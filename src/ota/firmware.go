@@ -0,0 +1,402 @@
+package ota
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// firmwareDir 固件文件目录，未登记到数据库的*.bin文件视为适用于所有开发板的stable固件
+const firmwareDir = "ota_bin"
+
+var boardPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// fileChecksum 未登记固件文件的SHA-256，文件修改时间或大小变化时重新计算
+type fileChecksum struct {
+	modTime time.Time
+	size    int64
+	sha256  string
+}
+
+var (
+	checksumMu sync.Mutex
+	checksums  = map[string]fileChecksum{} // 文件路径 -> SHA-256
+)
+
+// FirmwareResponse 固件管理接口统一响应
+type FirmwareResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// FirmwareUpdateRequest 更新固件渠道和灰度比例的请求，省略的字段不修改
+type FirmwareUpdateRequest struct {
+	Channel *string `json:"channel"`
+	Rollout *int    `json:"rollout"`
+}
+
+// inRollout 设备是否在固件的灰度范围内，按版本号和设备ID哈希分桶，提高比例时已命中的设备保持命中
+func inRollout(deviceID string, firmware models.Firmware) bool {
+	if firmware.Rollout >= 100 {
+		return true
+	}
+	if firmware.Rollout <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(firmware.Version + "/" + deviceID))
+	return int(h.Sum32()%100) < firmware.Rollout
+}
+
+// selectFirmware 从候选固件中选出设备可升级的最高版本，beta渠道的设备同时接收stable固件，
+// 版本相同时优先指定了开发板的固件，没有可用固件时返回nil
+func selectFirmware(candidates []models.Firmware, deviceID, channel string) *models.Firmware {
+	var best *models.Firmware
+	for i := range candidates {
+		firmware := &candidates[i]
+		if firmware.Channel == models.ChannelBeta && channel != models.ChannelBeta {
+			continue
+		}
+		if !inRollout(deviceID, *firmware) {
+			continue
+		}
+		if best == nil {
+			best = firmware
+			continue
+		}
+		c := compareVersion(firmware.Version, best.Version)
+		if c > 0 || c == 0 && best.Board == "" && firmware.Board != "" {
+			best = firmware
+		}
+	}
+	return best
+}
+
+// latestFirmware 查找设备可升级的最新固件
+func latestFirmware(deviceID, board string) *models.Firmware {
+	_ = os.MkdirAll(firmwareDir, 0755)
+
+	var candidates []models.Firmware
+	managed := map[string]bool{}
+	channel := ""
+	if firmwareDB := database.GetFirmwareDB(); firmwareDB != nil {
+		firmwares, err := firmwareDB.FirmwaresForBoard(board)
+		if err != nil {
+			utils.DefaultLogger.Error("查询开发板 %s 的固件失败: %v", board, err)
+		}
+		candidates = append(candidates, firmwares...)
+		if managed, err = firmwareDB.ManagedFilenames(); err != nil {
+			utils.DefaultLogger.Error("查询已登记固件失败: %v", err)
+		}
+	}
+	if deviceDB := database.GetDeviceDB(); deviceDB != nil {
+		if device, err := deviceDB.GetDevice(deviceID); err == nil && device != nil {
+			channel = device.Channel
+		}
+	}
+	candidates = append(candidates, legacyFirmwares(firmwareDir, managed)...)
+	return selectFirmware(candidates, deviceID, channel)
+}
+
+// legacyFirmwares 固件目录中未登记的*.bin文件，文件名即版本号，无法计算SHA-256的文件不下发
+func legacyFirmwares(dir string, managed map[string]bool) []models.Firmware {
+	bins, _ := filepath.Glob(filepath.Join(dir, "*.bin"))
+	var firmwares []models.Firmware
+	for _, bin := range bins {
+		name := filepath.Base(bin)
+		version := strings.TrimSuffix(name, ".bin")
+		if managed[name] || !validVersion(version) {
+			continue
+		}
+		size, checksum, err := fileSHA256(bin)
+		if err != nil {
+			utils.DefaultLogger.Warn("计算固件 %s 的SHA-256失败，已跳过: %v", name, err)
+			continue
+		}
+		firmwares = append(firmwares, models.Firmware{
+			Version:  version,
+			Channel:  models.ChannelStable,
+			Rollout:  100,
+			Filename: name,
+			Size:     size,
+			SHA256:   checksum,
+		})
+	}
+	return firmwares
+}
+
+// fileSHA256 计算文件的大小和SHA-256，按修改时间和大小缓存，避免每次OTA请求都读取整个固件
+func fileSHA256(path string) (int64, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", err
+	}
+	checksumMu.Lock()
+	defer checksumMu.Unlock()
+	if cached, ok := checksums[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.size, cached.sha256, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	checksums[path] = fileChecksum{modTime: info.ModTime(), size: size, sha256: checksum}
+	return size, checksum, nil
+}
+
+// handleFirmwareList 列出已登记的固件
+// @Summary 获取固件列表
+// @Description 列出已上传的固件，最近上传的在前
+// @Tags Firmware
+// @Produce json
+// @Success 200 {object} FirmwareResponse
+// @Router /firmware [get]
+func handleFirmwareList(c *gin.Context) {
+	firmwareDB := database.GetFirmwareDB()
+	if firmwareDB == nil {
+		respondFirmwareError(c, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+	firmwares, err := firmwareDB.ListFirmwares()
+	if err != nil {
+		respondFirmwareError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, FirmwareResponse{Success: true, Data: firmwares})
+}
+
+// handleFirmwareUpload 上传固件
+// @Summary 上传固件
+// @Description 上传固件文件并登记版本、开发板、渠道和灰度比例，服务端计算SHA-256并在OTA响应中返回
+// @Tags Firmware
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "固件文件"
+// @Param version formData string true "版本号，如1.6.2"
+// @Param board formData string false "开发板类型，为空表示适用于所有开发板"
+// @Param channel formData string false "渠道stable/beta，默认stable"
+// @Param rollout formData int false "灰度比例0-100，默认100"
+// @Param description formData string false "说明"
+// @Success 200 {object} FirmwareResponse
+// @Failure 400 {object} FirmwareResponse
+// @Failure 409 {object} FirmwareResponse
+// @Router /firmware [post]
+func handleFirmwareUpload(c *gin.Context) {
+	firmwareDB := database.GetFirmwareDB()
+	if firmwareDB == nil {
+		respondFirmwareError(c, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	version := strings.TrimSpace(c.PostForm("version"))
+	board := strings.TrimSpace(c.PostForm("board"))
+	channel := c.DefaultPostForm("channel", models.ChannelStable)
+	rollout, err := strconv.Atoi(c.DefaultPostForm("rollout", "100"))
+	switch {
+	case !validVersion(version):
+		respondFirmwareError(c, http.StatusBadRequest, "无效的版本号")
+		return
+	case board != "" && !boardPattern.MatchString(board):
+		respondFirmwareError(c, http.StatusBadRequest, "无效的开发板类型")
+		return
+	case channel != models.ChannelStable && channel != models.ChannelBeta:
+		respondFirmwareError(c, http.StatusBadRequest, "渠道只能为stable或beta")
+		return
+	case err != nil || rollout < 0 || rollout > 100:
+		respondFirmwareError(c, http.StatusBadRequest, "灰度比例应为0-100")
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		respondFirmwareError(c, http.StatusBadRequest, "缺少固件文件")
+		return
+	}
+	defer file.Close()
+
+	filename := version + ".bin"
+	if board != "" {
+		filename = board + "_" + version + ".bin"
+	}
+	path := filepath.Join(firmwareDir, filename)
+	if _, err := os.Stat(path); err == nil {
+		respondFirmwareError(c, http.StatusConflict, "固件文件 "+filename+" 已存在")
+		return
+	}
+
+	size, checksum, err := saveFirmware(file, path)
+	if err != nil {
+		respondFirmwareError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if size == 0 {
+		os.Remove(path)
+		respondFirmwareError(c, http.StatusBadRequest, "固件文件为空")
+		return
+	}
+
+	firmware := &models.Firmware{
+		Board:       board,
+		Version:     version,
+		Channel:     channel,
+		Rollout:     rollout,
+		Filename:    filename,
+		Size:        size,
+		SHA256:      checksum,
+		Description: c.PostForm("description"),
+	}
+	if err := firmwareDB.CreateFirmware(firmware); err != nil {
+		os.Remove(path)
+		respondFirmwareError(c, http.StatusConflict, err.Error())
+		return
+	}
+	utils.DefaultLogger.Info("已上传固件 %s, board=%q, channel=%s, rollout=%d%%, client=%s",
+		version, board, channel, rollout, c.ClientIP())
+	c.JSON(http.StatusOK, FirmwareResponse{Success: true, Data: firmware, Message: "固件已上传"})
+}
+
+// saveFirmware 将固件写入临时文件后重命名到path，返回文件大小和SHA-256
+func saveFirmware(src io.Reader, path string) (int64, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, "", fmt.Errorf("创建固件目录失败: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("保存固件文件失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, "", fmt.Errorf("保存固件文件失败: %v", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// handleFirmwareUpdate 调整固件渠道或灰度比例
+// @Summary 更新固件
+// @Description 调整渠道或灰度比例，设备下次OTA请求时生效；提高灰度比例时已命中的设备保持命中
+// @Tags Firmware
+// @Accept json
+// @Produce json
+// @Param id path int true "固件ID"
+// @Param body body FirmwareUpdateRequest true "渠道和灰度比例"
+// @Success 200 {object} FirmwareResponse
+// @Failure 400 {object} FirmwareResponse
+// @Failure 404 {object} FirmwareResponse
+// @Router /firmware/{id} [put]
+func handleFirmwareUpdate(c *gin.Context) {
+	firmwareDB := database.GetFirmwareDB()
+	if firmwareDB == nil {
+		respondFirmwareError(c, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+	id, ok := firmwareID(c)
+	if !ok {
+		return
+	}
+	var req FirmwareUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondFirmwareError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	if req.Channel != nil && *req.Channel != models.ChannelStable && *req.Channel != models.ChannelBeta {
+		respondFirmwareError(c, http.StatusBadRequest, "渠道只能为stable或beta")
+		return
+	}
+	if req.Rollout != nil && (*req.Rollout < 0 || *req.Rollout > 100) {
+		respondFirmwareError(c, http.StatusBadRequest, "灰度比例应为0-100")
+		return
+	}
+	found, err := firmwareDB.UpdateFirmware(id, req.Channel, req.Rollout)
+	if err != nil {
+		respondFirmwareError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		respondFirmwareError(c, http.StatusNotFound, "固件不存在")
+		return
+	}
+	utils.DefaultLogger.Info("已更新固件 %d, client=%s", id, c.ClientIP())
+	c.JSON(http.StatusOK, FirmwareResponse{Success: true, Message: "固件已更新"})
+}
+
+// handleFirmwareDelete 删除固件记录及文件
+// @Summary 删除固件
+// @Tags Firmware
+// @Produce json
+// @Param id path int true "固件ID"
+// @Success 200 {object} FirmwareResponse
+// @Failure 404 {object} FirmwareResponse
+// @Router /firmware/{id} [delete]
+func handleFirmwareDelete(c *gin.Context) {
+	firmwareDB := database.GetFirmwareDB()
+	if firmwareDB == nil {
+		respondFirmwareError(c, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+	id, ok := firmwareID(c)
+	if !ok {
+		return
+	}
+	firmware, err := firmwareDB.DeleteFirmware(id)
+	if err != nil {
+		respondFirmwareError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if firmware == nil {
+		respondFirmwareError(c, http.StatusNotFound, "固件不存在")
+		return
+	}
+	if err := os.Remove(filepath.Join(firmwareDir, firmware.Filename)); err != nil && !os.IsNotExist(err) {
+		utils.DefaultLogger.Warn("删除固件文件 %s 失败: %v", firmware.Filename, err)
+	}
+	utils.DefaultLogger.Info("已删除固件 %s, board=%q, client=%s", firmware.Version, firmware.Board, c.ClientIP())
+	c.JSON(http.StatusOK, FirmwareResponse{Success: true, Message: "固件已删除"})
+}
+
+// firmwareID 解析路径中的固件ID，失败时已写入响应
+func firmwareID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		respondFirmwareError(c, http.StatusBadRequest, "无效的固件ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondFirmwareError(c *gin.Context, status int, message string) {
+	c.JSON(status, FirmwareResponse{Success: false, Message: message})
+}
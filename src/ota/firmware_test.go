@@ -0,0 +1,107 @@
+package ota
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+)
+
+func TestSelectFirmware(t *testing.T) {
+	candidates := []models.Firmware{
+		{Version: "1.9.0", Channel: models.ChannelStable, Rollout: 100, Filename: "1.9.0.bin"},
+		{Board: "esp-box-3", Version: "1.9.0", Channel: models.ChannelStable, Rollout: 100, Filename: "esp-box-3_1.9.0.bin"},
+		{Version: "1.10.0-beta", Channel: models.ChannelBeta, Rollout: 100, Filename: "1.10.0-beta.bin"},
+		{Version: "1.8.0", Channel: models.ChannelStable, Rollout: 100, Filename: "1.8.0.bin"},
+		{Version: "2.0.0", Channel: models.ChannelStable, Rollout: 0, Filename: "2.0.0.bin"},
+	}
+	tests := []struct {
+		name    string
+		channel string
+		want    string
+	}{
+		{"stable设备不接收beta固件", "", "esp-box-3_1.9.0.bin"},
+		{"beta设备接收更高的beta固件", models.ChannelBeta, "1.10.0-beta.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectFirmware(candidates, "aa:bb", tt.channel)
+			if got == nil || got.Filename != tt.want {
+				t.Errorf("selectFirmware() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+	if got := selectFirmware(nil, "aa:bb", ""); got != nil {
+		t.Errorf("selectFirmware() 没有候选固件应返回nil, got %+v", got)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	hits := func(rollout int) map[string]bool {
+		firmware := models.Firmware{Version: "1.9.0", Rollout: rollout}
+		hit := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			deviceID := fmt.Sprintf("device-%d", i)
+			if inRollout(deviceID, firmware) {
+				hit[deviceID] = true
+			}
+		}
+		return hit
+	}
+
+	if n := len(hits(0)); n != 0 {
+		t.Errorf("rollout=0 命中 %d 台设备, want 0", n)
+	}
+	if n := len(hits(100)); n != 1000 {
+		t.Errorf("rollout=100 命中 %d 台设备, want 1000", n)
+	}
+	small, large := hits(10), hits(50)
+	if n := len(small); n < 50 || n > 150 {
+		t.Errorf("rollout=10 命中 %d 台设备, want 约100", n)
+	}
+	for deviceID := range small {
+		if !large[deviceID] {
+			t.Errorf("提高灰度比例后设备 %s 不应失去命中", deviceID)
+		}
+	}
+}
+
+func TestLegacyFirmwares(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("写入固件失败: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("修改时间失败: %v", err)
+		}
+	}
+	checksum := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	modTime := time.Now().Add(-time.Hour)
+	write("1.8.0.bin", "firmware-1.8.0", modTime)
+	write("1.9.0.bin", "managed", modTime)
+	write("latest.bin", "invalid version", modTime)
+
+	firmwares := legacyFirmwares(dir, map[string]bool{"1.9.0.bin": true})
+	if len(firmwares) != 1 || firmwares[0].Version != "1.8.0" {
+		t.Fatalf("legacyFirmwares() = %+v, want 1.8.0", firmwares)
+	}
+	if firmwares[0].SHA256 != checksum("firmware-1.8.0") || firmwares[0].Size != int64(len("firmware-1.8.0")) {
+		t.Errorf("legacyFirmwares() SHA256 = %s, Size = %d", firmwares[0].SHA256, firmwares[0].Size)
+	}
+
+	// 文件被替换后重新计算
+	write("1.8.0.bin", "firmware-1.8.0-fixed", modTime.Add(time.Minute))
+	if firmwares := legacyFirmwares(dir, nil); len(firmwares) != 2 || firmwares[0].SHA256 != checksum("firmware-1.8.0-fixed") {
+		t.Errorf("文件替换后 legacyFirmwares() = %+v", firmwares)
+	}
+}
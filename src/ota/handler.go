@@ -4,10 +4,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
 	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,10 +23,22 @@ type OtaFirmwareResponse struct {
 	Firmware struct {
 		Version string `json:"version" example:"1.0.3"`
 		URL     string `json:"url" example:"/ota_bin/1.0.3.bin"`
+		SHA256  string `json:"sha256,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
 	} `json:"firmware"`
 	Websocket struct {
-		URL string `json:"url" example:"wss://example.com/ota"`
+		URL   string `json:"url" example:"wss://example.com/ota"`
+		Token string `json:"token,omitempty" example:"eyJhbGciOiJIUzI1NiIs..."` // 已激活设备建立连接使用的token
 	} `json:"websocket"`
+	Activation *OtaActivation `json:"activation,omitempty"`
+}
+
+// deviceTokenTTL 下发给已激活设备的连接token有效期，设备每次请求OTA时重新签发
+const deviceTokenTTL = 30 * 24 * time.Hour
+
+// OtaActivation 未激活设备的激活码，设备显示message并播报code
+type OtaActivation struct {
+	Code    string `json:"code" example:"123456"`
+	Message string `json:"message" example:"Amine AI Chat\n123456"`
 }
 
 // ErrorResponse 定义错误返回结构
@@ -59,10 +73,13 @@ type OtaRequest struct {
 	Application struct {
 		Version string `json:"version" example:"1.0.0"`
 	} `json:"application"`
+	Board struct {
+		Type string `json:"type" example:"bread-compact-wifi"`
+	} `json:"board"`
 }
 
 // @Summary 上传设备信息获取最新固件
-// @Description 设备上传信息后，返回最新固件版本和下载地址
+// @Description 设备上传信息后，按开发板类型、设备渠道和灰度比例返回最新固件版本、下载地址和SHA-256；启用server.auth时，未激活的设备还会收到激活码，已激活的设备收到建立连接使用的token
 // @Tags OTA
 // @Accept json
 // @Produce json
@@ -83,30 +100,24 @@ func handleOtaPost(c *gin.Context, updateURL string) {
 		return
 	}
 
+	touchDevice(c, deviceID, body)
+
 	version := body.Application.Version
 	if version == "" {
 		version = "1.0.0"
 	}
 
-	otaDir := filepath.Join(".", "ota_bin")
-	_ = os.MkdirAll(otaDir, 0755)
-	bins, _ := filepath.Glob(filepath.Join(otaDir, "*.bin"))
-	firmwareURL := ""
-	if len(bins) > 0 {
-		sort.Slice(bins, func(i, j int) bool {
-			return versionLess(bins[j], bins[i])
-		})
-		latest := filepath.Base(bins[0])
-		version = strings.TrimSuffix(latest, ".bin")
-		firmwareURL = "/ota_bin/" + latest
-	}
-
 	resp := OtaFirmwareResponse{}
 	resp.ServerTime.Timestamp = time.Now().UnixNano() / 1e6
 	resp.ServerTime.TimezoneOffset = 8 * 60
 	resp.Firmware.Version = version
-	resp.Firmware.URL = firmwareURL
+	if firmware := latestFirmware(deviceID, body.Board.Type); firmware != nil {
+		resp.Firmware.Version = firmware.Version
+		resp.Firmware.URL = "/ota_bin/" + firmware.Filename
+		resp.Firmware.SHA256 = firmware.SHA256
+	}
 	resp.Websocket.URL = updateURL
+	resp.Activation, resp.Websocket.Token = authorizeDevice(deviceID)
 	if resp.Websocket.URL == "" {
 		utils.DefaultLogger.Warn("===========================================================")
 		utils.DefaultLogger.Warn("=====  WebSocket URL 未配置，OTA 服务可能无法正常工作 =====")
@@ -117,6 +128,93 @@ func handleOtaPost(c *gin.Context, updateURL string) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// touchDevice 登记设备的开发板类型、固件版本和来源IP
+func touchDevice(c *gin.Context, deviceID string, body OtaRequest) {
+	deviceDB := database.GetDeviceDB()
+	if deviceDB == nil {
+		return
+	}
+	err := deviceDB.TouchDevice(models.Device{
+		DeviceID:        deviceID,
+		ClientID:        c.GetHeader("client-id"),
+		Board:           body.Board.Type,
+		FirmwareVersion: body.Application.Version,
+		LastIP:          c.ClientIP(),
+	})
+	if err != nil {
+		utils.DefaultLogger.Error("登记设备 %s 失败: %v", deviceID, err)
+	}
+}
+
+// authorizeDevice 启用server.auth时为未激活的设备返回激活码，为已激活的设备签发连接token，未启用认证时都为空
+func authorizeDevice(deviceID string) (*OtaActivation, string) {
+	config := configs.Current()
+	deviceDB := database.GetDeviceDB()
+	if config == nil || !config.Server.Auth.Enabled || deviceDB == nil {
+		return nil, ""
+	}
+	code, err := deviceDB.ActivationCode(deviceID)
+	if err != nil {
+		utils.DefaultLogger.Error("获取设备 %s 的激活码失败: %v", deviceID, err)
+		return nil, ""
+	}
+	if code == "" {
+		return nil, deviceToken(config, deviceID)
+	}
+	message := code
+	if config.Web.ActivateText != "" {
+		message = config.Web.ActivateText + "\n" + code
+	}
+	utils.DefaultLogger.Info("设备 %s 未激活，下发激活码 %s", deviceID, code)
+	return &OtaActivation{Code: code, Message: message}, ""
+}
+
+// deviceToken 使用server.token为设备签发连接token，server.token未配置时不签发
+func deviceToken(config *configs.Config, deviceID string) string {
+	if auth.IsPlaceholderToken(config.Server.Token) {
+		utils.DefaultLogger.Warn("未配置server.token，无法为设备 %s 签发连接token", deviceID)
+		return ""
+	}
+	token, err := auth.NewAuthToken(config.Server.Token).GenerateTokenWithTTL(deviceID, deviceTokenTTL)
+	if err != nil {
+		utils.DefaultLogger.Error("为设备 %s 签发连接token失败: %v", deviceID, err)
+		return ""
+	}
+	return token
+}
+
+// @Summary 查询设备激活状态
+// @Description 设备播报激活码后轮询此接口，已激活返回 200，未激活返回 202
+// @Tags OTA
+// @Produce json
+// @Param device-id header string true "设备ID"
+// @Success 200 {object} ErrorResponse
+// @Success 202 {object} ErrorResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /ota/activate [post]
+func handleOtaActivate(c *gin.Context) {
+	deviceID := c.GetHeader("device-id")
+	if deviceID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Success: false, Message: "缺少 device-id"})
+		return
+	}
+	deviceDB := database.GetDeviceDB()
+	if deviceDB == nil {
+		c.JSON(http.StatusOK, ErrorResponse{Success: true, Message: "success"})
+		return
+	}
+	activated, err := deviceDB.IsActivated(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if !activated {
+		c.JSON(http.StatusAccepted, ErrorResponse{Success: false, Message: "等待激活"})
+		return
+	}
+	c.JSON(http.StatusOK, ErrorResponse{Success: true, Message: "success"})
+}
+
 // @Summary 下载 OTA 固件文件
 // @Description 根据文件名下载 OTA 固件
 // @Tags OTA
@@ -127,7 +225,7 @@ func handleOtaPost(c *gin.Context, updateURL string) {
 // @Router /ota_bin/{filename} [get]
 func handleOtaBinDownload(c *gin.Context) {
 	fname := c.Param("filename")
-	p := filepath.Join("ota_bin", fname)
+	p := filepath.Join(firmwareDir, fname)
 	if _, err := os.Stat(p); os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Success: false, Message: "file not found"})
 		return
@@ -136,15 +234,3 @@ func handleOtaBinDownload(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename="+fname)
 	c.File(p)
 }
-
-// versionLess 比较版本号语义 a < b
-func versionLess(a, b string) bool {
-	aV := strings.Split(strings.TrimSuffix(filepath.Base(a), ".bin"), ".")
-	bV := strings.Split(strings.TrimSuffix(filepath.Base(b), ".bin"), ".")
-	for i := 0; i < len(aV) && i < len(bV); i++ {
-		if aV[i] != bV[i] {
-			return aV[i] < bV[i]
-		}
-	}
-	return len(aV) < len(bV)
-}
@@ -0,0 +1,64 @@
+package ota
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthorizeDevice(t *testing.T) {
+	origin := configs.Cfg
+	defer func() { configs.Cfg = origin }()
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	defer logger.Close()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Device{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	deviceDB := database.NewDeviceDB(db)
+
+	config := &configs.Config{}
+	config.Server.Token = "secret"
+	config.Server.Auth.Enabled = true
+	configs.Cfg = config
+
+	// 未激活设备收到激活码，没有token
+	activation, token := authorizeDevice("aa:bb")
+	if activation == nil || len(activation.Code) != 6 || token != "" {
+		t.Fatalf("authorizeDevice() 未激活设备 = %+v, %q", activation, token)
+	}
+
+	// 激活后收到以server.token签发、可通过握手认证的token
+	userID := uint(1)
+	db.Create(&models.User{Username: "mom"})
+	if _, err := deviceDB.Activate(activation.Code, userID); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	activation, token = authorizeDevice("aa:bb")
+	if activation != nil || token == "" {
+		t.Fatalf("authorizeDevice() 已激活设备 = %+v, %q", activation, token)
+	}
+	if valid, deviceID, err := auth.NewAuthToken("secret").VerifyToken(token); !valid || deviceID != "aa:bb" {
+		t.Errorf("VerifyToken() = %v, %s, %v", valid, deviceID, err)
+	}
+
+	// server.token为示例值时不签发token
+	config.Server.Token = "你的token"
+	if _, token := authorizeDevice("aa:bb"); token != "" {
+		t.Errorf("authorizeDevice() server.token未配置时不应签发token")
+	}
+}
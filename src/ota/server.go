@@ -3,6 +3,8 @@ package ota
 import (
 	"context"
 
+	"xiaozhi-server-go/src/core/auth"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -20,8 +22,15 @@ func (s *DefaultOTAService) Start(ctx context.Context, engine *gin.Engine, apiGr
 	apiGroup.OPTIONS("/ota/", handleOtaOptions)
 	apiGroup.GET("/ota/", func(c *gin.Context) { handleOtaGet(c, s.UpdateURL) })
 	apiGroup.POST("/ota/", func(c *gin.Context) { handleOtaPost(c, s.UpdateURL) })
+	apiGroup.POST("/ota/activate", handleOtaActivate)
 
 	engine.GET("/ota_bin/:filename", handleOtaBinDownload)
 
+	firmware := apiGroup.Group("/firmware", auth.AdminAuthMiddleware())
+	firmware.GET("", handleFirmwareList)
+	firmware.POST("", handleFirmwareUpload)
+	firmware.PUT("/:id", handleFirmwareUpdate)
+	firmware.DELETE("/:id", handleFirmwareDelete)
+
 	return nil
 }
@@ -0,0 +1,76 @@
+package ota
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFirmwareRoutesRequireAdminToken(t *testing.T) {
+	origin := configs.Cfg
+	defer func() { configs.Cfg = origin }()
+
+	// 默认配置：未启用设备认证，server.token为示例值
+	data, err := os.ReadFile("../../config.yaml")
+	if err != nil {
+		t.Fatalf("读取config.yaml失败: %v", err)
+	}
+	config := &configs.Config{}
+	if err := config.FromString(string(data)); err != nil {
+		t.Fatalf("解析config.yaml失败: %v", err)
+	}
+	configs.Cfg = config
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	if err := NewDefaultOTAService("").Start(context.Background(), engine, engine.Group("/api")); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	upload := func(token string) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("version", "9.9.9")
+		part, _ := writer.CreateFormFile("file", "evil.bin")
+		part.Write([]byte("firmware"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/firmware", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := upload(""); code != http.StatusServiceUnavailable {
+		t.Errorf("默认配置下未认证上传 = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if code := upload(config.Server.Token); code != http.StatusServiceUnavailable {
+		t.Errorf("默认配置下使用示例token上传 = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	config.Server.Token = "secret"
+	if code := upload(""); code != http.StatusUnauthorized {
+		t.Errorf("未认证上传 = %d, want %d", code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/api/firmware/1", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("未认证删除 = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if _, err := os.Stat(firmwareDir); err == nil {
+		t.Errorf("未认证请求不应创建固件目录")
+	}
+}
@@ -0,0 +1,96 @@
+package ota
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersion 按语义化版本比较a和b，a<b返回-1，相等返回0，a>b返回1。
+// 允许v前缀和省略的版本段（1.6视为1.6.0），预发布版本低于正式版本（1.6.0-beta < 1.6.0），忽略+之后的构建信息
+func compareVersion(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+	if c := compareIdentifiers(aCore, bCore, true); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == "" && bPre == "":
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareIdentifiers(strings.Split(aPre, "."), strings.Split(bPre, "."), false)
+}
+
+// validVersion 版本号是否为数字段组成的语义化版本，可带预发布和构建信息，只允许字母、数字和.-+
+func validVersion(v string) bool {
+	for _, r := range v {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '.' || r == '-' || r == '+') {
+			return false
+		}
+	}
+	core, _ := splitVersion(v)
+	for _, part := range core {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// splitVersion 拆分出主版本段和预发布标识
+func splitVersion(v string) ([]string, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	pre := ""
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	return strings.Split(v, "."), pre
+}
+
+// compareIdentifiers 逐段比较，数字段按数值比较且低于非数字段。
+// pad为true时缺少的段视为0，否则段数少的较低
+func compareIdentifiers(a, b []string, pad bool) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) || i >= len(b) {
+			if !pad {
+				if i >= len(a) {
+					return -1
+				}
+				return 1
+			}
+		}
+		x, y := "0", "0"
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		xn, xErr := strconv.ParseUint(x, 10, 64)
+		yn, yErr := strconv.ParseUint(y, 10, 64)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case xErr == nil:
+			return -1
+		case yErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
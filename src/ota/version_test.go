@@ -0,0 +1,48 @@
+package ota
+
+import "testing"
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0", "1.9.0", 1},
+		{"1.9", "1.10", -1},
+		{"1.6", "1.6.0", 0},
+		{"v1.6.2", "1.6.2", 0},
+		{"1.6.0-beta", "1.6.0", -1},
+		{"1.6.0-beta.2", "1.6.0-beta.10", -1},
+		{"1.6.0-beta.1", "1.6.0-alpha", 1},
+		{"1.6.0-rc", "1.6.0-rc.1", -1},
+		{"1.6.0+build.5", "1.6.0", 0},
+		{"2.0.0", "1.99.99", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersion(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestValidVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.6.2", true},
+		{"v2.0", true},
+		{"1.6.0-beta.1", true},
+		{"", false},
+		{"1.x", false},
+		{"../1.0", false},
+		{"1.0-beta/1", false},
+		{"1.0+../../x", false},
+		{"1..0", false},
+	}
+	for _, tt := range tests {
+		if got := validVersion(tt.version); got != tt.want {
+			t.Errorf("validVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
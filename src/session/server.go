@@ -0,0 +1,172 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDialogueLimit 会话详情默认返回的对话消息条数
+const defaultDialogueLimit = 20
+
+// SessionResponse 会话接口统一响应
+type SessionResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// SessionDetail 会话状态及最近的对话
+type SessionDetail struct {
+	core.SessionInfo
+	Dialogue []chat.Message `json:"dialogue"`
+}
+
+// session 已建立的会话及其连接处理器
+type session struct {
+	info    core.SessionInfo
+	handler *core.ConnectionHandler
+	conn    transport.ConnectionHandler
+}
+
+type DefaultSessionService struct {
+	logger           *utils.Logger
+	transportManager *transport.TransportManager
+}
+
+// NewDefaultSessionService 构造函数
+func NewDefaultSessionService(logger *utils.Logger, transportManager *transport.TransportManager) (*DefaultSessionService, error) {
+	if transportManager == nil {
+		return nil, fmt.Errorf("传输管理器未初始化")
+	}
+	return &DefaultSessionService{
+		logger:           logger,
+		transportManager: transportManager,
+	}, nil
+}
+
+// Start 注册会话管理路由
+func (s *DefaultSessionService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/sessions", auth.AdminAuthMiddleware())
+
+	group.GET("", s.handleList)
+	group.GET("/:id", s.handleGet)
+	group.DELETE("/:id", s.handleDelete)
+
+	s.logger.Info("会话管理HTTP服务路由注册完成")
+	return nil
+}
+
+// handleList 列出已建立的会话
+// @Summary 获取会话列表
+// @Description 列出各传输层已建立的语音会话，包括拾音模式、当前轮次、使用的提供者和音色，最早建立的在前
+// @Tags Session
+// @Produce json
+// @Success 200 {object} SessionResponse
+// @Router /sessions [get]
+func (s *DefaultSessionService) handleList(c *gin.Context) {
+	sessions := s.sessions()
+	infos := make([]core.SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		infos = append(infos, sess.info)
+	}
+	c.JSON(http.StatusOK, SessionResponse{Success: true, Data: infos})
+}
+
+// handleGet 获取会话状态及最近的对话
+// @Summary 获取会话
+// @Tags Session
+// @Produce json
+// @Param id path string true "会话ID"
+// @Param limit query int false "返回的对话消息条数，默认20，0表示全部"
+// @Success 200 {object} SessionResponse
+// @Failure 404 {object} SessionResponse
+// @Router /sessions/{id} [get]
+func (s *DefaultSessionService) handleGet(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDialogueLimit)))
+	if err != nil || limit < 0 {
+		s.respondError(c, http.StatusBadRequest, "无效的limit参数")
+		return
+	}
+	matched := s.find(c.Param("id"))
+	if len(matched) == 0 {
+		s.respondError(c, http.StatusNotFound, "会话不存在")
+		return
+	}
+	detail := SessionDetail{
+		SessionInfo: matched[0].info,
+		Dialogue:    matched[0].handler.RecentDialogue(limit),
+	}
+	if detail.Dialogue == nil {
+		detail.Dialogue = []chat.Message{}
+	}
+	c.JSON(http.StatusOK, SessionResponse{Success: true, Data: detail})
+}
+
+// handleDelete 断开会话
+// @Summary 断开会话
+// @Description 在后台关闭会话并断开设备连接，请求立即返回；对话历史和长期记忆照常保存，设备可重新连接
+// @Tags Session
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 202 {object} SessionResponse
+// @Failure 404 {object} SessionResponse
+// @Router /sessions/{id} [delete]
+func (s *DefaultSessionService) handleDelete(c *gin.Context) {
+	id := c.Param("id")
+	matched := s.find(id)
+	if len(matched) == 0 {
+		s.respondError(c, http.StatusNotFound, "会话不存在")
+		return
+	}
+	// 关闭时要清理音频队列、保存对话历史，不阻塞请求
+	for _, sess := range matched {
+		go sess.conn.Close()
+	}
+	s.logger.Info("正在断开会话 %s, device=%s, client=%s", id, matched[0].info.DeviceID, c.ClientIP())
+	c.JSON(http.StatusAccepted, SessionResponse{Success: true, Message: "正在断开会话"})
+}
+
+// sessions 获取已建立的会话，按建立时间排序
+func (s *DefaultSessionService) sessions() []session {
+	var sessions []session
+	for _, active := range s.transportManager.GetSessions() {
+		adapter, ok := active.Handler.(*transport.ConnectionContextAdapter)
+		if !ok || !adapter.IsActive() || adapter.GetConnectionHandler() == nil {
+			continue
+		}
+		handler := adapter.GetConnectionHandler()
+		info := handler.SessionInfo()
+		info.Transport = active.Transport
+		sessions = append(sessions, session{info: info, handler: handler, conn: active.Handler})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].info.ConnectedAt.Before(sessions[j].info.ConnectedAt)
+	})
+	return sessions
+}
+
+// find 查找会话ID对应的会话，同一设备重复连接时可能有多个
+func (s *DefaultSessionService) find(id string) []session {
+	var matched []session
+	for _, sess := range s.sessions() {
+		if sess.info.SessionID == id {
+			matched = append(matched, sess)
+		}
+	}
+	return matched
+}
+
+func (s *DefaultSessionService) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, SessionResponse{Success: false, Message: message})
+}
@@ -38,6 +38,20 @@ func (tm *TaskManager) Stop() {
 	tm.scheduledTasks.Stop()
 }
 
+// GetQueueStats returns the task queue depth and worker status
+func (tm *TaskManager) GetQueueStats() map[string]int {
+	tm.scheduledTasks.mu.RLock()
+	scheduled := len(tm.scheduledTasks.tasks)
+	tm.scheduledTasks.mu.RUnlock()
+
+	return map[string]int{
+		"queued":       len(tm.workerPool.taskQueue),
+		"scheduled":    scheduled,
+		"workers":      len(tm.workerPool.workers),
+		"idle_workers": len(tm.workerPool.idleWorkers),
+	}
+}
+
 // SubmitTask submits a task for execution
 func (tm *TaskManager) SubmitTask(clientID string, task *Task) error {
 	// 检查任务类型是否已注册
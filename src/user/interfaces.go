@@ -0,0 +1,13 @@
+package user
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserService 定义用户及用户设置服务接口
+type UserService interface {
+	// 将用户管理的路由注册到 engine 与 apiGroup
+	Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error
+}
@@ -0,0 +1,408 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserResponse 用户接口统一响应
+type UserResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// UserRequest 创建或更新用户的请求，更新时为空的字段不修改
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"` // admin/user，创建时默认为user
+}
+
+// SettingRequest 用户设置，为空的字段使用全局配置
+type SettingRequest struct {
+	SelectedASR     string   `json:"selected_asr"`
+	SelectedTTS     string   `json:"selected_tts"`
+	SelectedLLM     string   `json:"selected_llm"`
+	SelectedVLLLM   string   `json:"selected_vlllm"`
+	PromptOverride  string   `json:"prompt_override"`
+	QuickReplyWords []string `json:"quick_reply_words"`
+}
+
+// DeviceRequest 绑定设备的请求
+type DeviceRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+type DefaultUserService struct {
+	logger *utils.Logger
+	db     *database.UserDB
+}
+
+// NewDefaultUserService 构造函数
+func NewDefaultUserService(logger *utils.Logger, db *database.UserDB) (*DefaultUserService, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	return &DefaultUserService{
+		logger: logger,
+		db:     db,
+	}, nil
+}
+
+// Start 注册用户管理路由
+func (s *DefaultUserService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/users", auth.AdminAuthMiddleware())
+
+	group.GET("", s.handleList)
+	group.POST("", s.handleCreate)
+	group.GET("/:id", s.handleGet)
+	group.PUT("/:id", s.handleUpdate)
+	group.DELETE("/:id", s.handleDelete)
+	group.GET("/:id/setting", s.handleGetSetting)
+	group.PUT("/:id/setting", s.handleUpdateSetting)
+	group.POST("/:id/devices", s.handleBindDevice)
+	group.DELETE("/:id/devices/:device_id", s.handleUnbindDevice)
+
+	s.logger.Info("用户管理HTTP服务路由注册完成")
+	return nil
+}
+
+// handleList 列出所有用户
+// @Summary 获取用户列表
+// @Description 列出所有用户及其设置和绑定的设备
+// @Tags User
+// @Produce json
+// @Success 200 {object} UserResponse
+// @Router /users [get]
+func (s *DefaultUserService) handleList(c *gin.Context) {
+	users, err := s.db.ListUsers()
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, UserResponse{Success: true, Data: users})
+}
+
+// handleCreate 创建用户
+// @Summary 创建用户
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body UserRequest true "用户信息"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} UserResponse
+// @Router /users [post]
+func (s *DefaultUserService) handleCreate(c *gin.Context) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.respondError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		s.respondError(c, http.StatusBadRequest, "用户名和密码不能为空")
+		return
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+	if !validRole(req.Role) {
+		s.respondError(c, http.StatusBadRequest, "角色只能是admin或user")
+		return
+	}
+
+	user, err := s.db.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("已创建用户 %s, client=%s", user.Username, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Data: user})
+}
+
+// handleGet 获取用户
+// @Summary 获取用户
+// @Description 返回用户及其设置和绑定的设备
+// @Tags User
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id} [get]
+func (s *DefaultUserService) handleGet(c *gin.Context) {
+	user, ok := s.loadUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, UserResponse{Success: true, Data: user})
+}
+
+// handleUpdate 更新用户名、密码或角色
+// @Summary 更新用户
+// @Description 为空的字段不修改
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param body body UserRequest true "用户信息"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id} [put]
+func (s *DefaultUserService) handleUpdate(c *gin.Context) {
+	id, ok := s.userID(c)
+	if !ok {
+		return
+	}
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.respondError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	if req.Role != "" && !validRole(req.Role) {
+		s.respondError(c, http.StatusBadRequest, "角色只能是admin或user")
+		return
+	}
+
+	found, err := s.db.UpdateUser(id, strings.TrimSpace(req.Username), req.Password, req.Role)
+	if err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	s.logger.Info("已更新用户 %d, client=%s", id, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Message: "用户已更新"})
+}
+
+// handleDelete 删除用户及其设置和设备绑定
+// @Summary 删除用户
+// @Tags User
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id} [delete]
+func (s *DefaultUserService) handleDelete(c *gin.Context) {
+	id, ok := s.userID(c)
+	if !ok {
+		return
+	}
+	found, err := s.db.DeleteUser(id)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	s.logger.Info("已删除用户 %d, client=%s", id, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Message: "用户已删除"})
+}
+
+// handleGetSetting 获取用户设置
+// @Summary 获取用户设置
+// @Tags User
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id}/setting [get]
+func (s *DefaultUserService) handleGetSetting(c *gin.Context) {
+	user, ok := s.loadUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, UserResponse{Success: true, Data: user.Setting})
+}
+
+// handleUpdateSetting 更新用户设置，设备下次连接时生效
+// @Summary 更新用户设置
+// @Description 可选择任一已配置的提供者，为空的字段使用全局配置，设备下次连接时生效
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param body body SettingRequest true "用户设置"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id}/setting [put]
+func (s *DefaultUserService) handleUpdateSetting(c *gin.Context) {
+	id, ok := s.userID(c)
+	if !ok {
+		return
+	}
+	var req SettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.respondError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	if err := validateSelection(map[string]string{
+		"ASR":   req.SelectedASR,
+		"TTS":   req.SelectedTTS,
+		"LLM":   req.SelectedLLM,
+		"VLLLM": req.SelectedVLLLM,
+	}); err != nil {
+		s.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	setting := models.UserSetting{
+		SelectedASR:    req.SelectedASR,
+		SelectedTTS:    req.SelectedTTS,
+		SelectedLLM:    req.SelectedLLM,
+		SelectedVLLLM:  req.SelectedVLLLM,
+		PromptOverride: req.PromptOverride,
+	}
+	if len(req.QuickReplyWords) > 0 {
+		words, err := json.Marshal(req.QuickReplyWords)
+		if err != nil {
+			s.respondError(c, http.StatusBadRequest, "快速回复词格式错误")
+			return
+		}
+		setting.QuickReplyWords = words
+	}
+
+	found, err := s.db.SaveSetting(id, setting)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	s.logger.Info("已更新用户 %d 的设置, client=%s", id, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Message: "用户设置已更新，设备下次连接时生效"})
+}
+
+// handleBindDevice 将设备绑定到用户
+// @Summary 绑定设备
+// @Description 设备已绑定其他用户时改为绑定到该用户，设备下次连接时生效
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param body body DeviceRequest true "设备"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id}/devices [post]
+func (s *DefaultUserService) handleBindDevice(c *gin.Context) {
+	id, ok := s.userID(c)
+	if !ok {
+		return
+	}
+	var req DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.DeviceID) == "" {
+		s.respondError(c, http.StatusBadRequest, "设备ID不能为空")
+		return
+	}
+	deviceID := strings.TrimSpace(req.DeviceID)
+
+	found, err := s.db.BindDevice(id, deviceID)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	s.logger.Info("已将设备 %s 绑定到用户 %d, client=%s", deviceID, id, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Message: "设备已绑定"})
+}
+
+// handleUnbindDevice 解除设备与用户的绑定
+// @Summary 解绑设备
+// @Tags User
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse
+// @Router /users/{id}/devices/{device_id} [delete]
+func (s *DefaultUserService) handleUnbindDevice(c *gin.Context) {
+	id, ok := s.userID(c)
+	if !ok {
+		return
+	}
+	deviceID := c.Param("device_id")
+	found, err := s.db.UnbindDevice(id, deviceID)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		s.respondError(c, http.StatusNotFound, "设备未绑定该用户")
+		return
+	}
+	s.logger.Info("已解除设备 %s 与用户 %d 的绑定, client=%s", deviceID, id, c.ClientIP())
+	c.JSON(http.StatusOK, UserResponse{Success: true, Message: "设备已解绑"})
+}
+
+// loadUser 加载路径中的用户，失败时已写入响应
+func (s *DefaultUserService) loadUser(c *gin.Context) (*models.User, bool) {
+	id, ok := s.userID(c)
+	if !ok {
+		return nil, false
+	}
+	user, err := s.db.GetUser(id)
+	if err != nil {
+		s.respondError(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if user == nil {
+		s.respondError(c, http.StatusNotFound, "用户不存在")
+		return nil, false
+	}
+	return user, true
+}
+
+// userID 解析路径中的用户ID，失败时已写入响应
+func (s *DefaultUserService) userID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		s.respondError(c, http.StatusBadRequest, "无效的用户ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (s *DefaultUserService) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, UserResponse{Success: false, Message: message})
+}
+
+func validRole(role string) bool {
+	return role == "admin" || role == "user"
+}
+
+// validateSelection 检查选择的提供者是否已配置，不在故障转移链中的提供者在会话使用时按需创建资源池
+func validateSelection(selected map[string]string) error {
+	config := configs.Current()
+	if config == nil {
+		return nil
+	}
+	for _, module := range []string{"ASR", "TTS", "LLM", "VLLLM"} {
+		name := selected[module]
+		if name != "" && !config.HasProvider(module, name) {
+			return fmt.Errorf("未配置%s提供者 %s", module, name)
+		}
+	}
+	return nil
+}